@@ -0,0 +1,69 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// MutationAudit describes a completed mutation for an audit trail.
+type MutationAudit struct {
+	RequestSummary
+	// Variables are the variables of the mutation, with the values of
+	// the redacted ones replaced by "REDACTED". They are decoded from
+	// their JSON encoding, so structs appear as maps.
+	Variables map[string]interface{}
+}
+
+// WithMutationAudit calls audit after every Run or RunStream call of a
+// mutation, whatever its outcome, for compliance logging of write
+// operations. The values of the variables named in redact, matched
+// case-insensitively at any depth, are replaced by "REDACTED".
+func WithMutationAudit(audit func(ctx context.Context, a MutationAudit), redact ...string) ClientOption {
+	return func(client *Client) {
+		client.audit = audit
+		client.auditRedacted = make(map[string]bool, len(redact))
+		for _, name := range redact {
+			client.auditRedacted[strings.ToLower(name)] = true
+		}
+	}
+}
+
+// audits reports whether req is audited.
+func (c *Client) audits(req *Request) bool {
+	return c.audit != nil && req.OperationType() == OperationMutation
+}
+
+// auditVariables returns the variables of req as recorded in the audit
+// trail, nil if they can't be encoded.
+func (c *Client) auditVariables(req *Request) map[string]interface{} {
+	b, err := json.Marshal(req.vars)
+	if err != nil {
+		return nil
+	}
+	var vars map[string]interface{}
+	if err := json.Unmarshal(b, &vars); err != nil {
+		return nil
+	}
+	c.redactVariables(vars)
+	return vars
+}
+
+// redactVariables replaces the values of the redacted keys of v, and of
+// the maps it contains.
+func (c *Client) redactVariables(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if c.auditRedacted[strings.ToLower(key)] {
+				v[key] = "REDACTED"
+				continue
+			}
+			c.redactVariables(value)
+		}
+	case []interface{}:
+		for _, value := range v {
+			c.redactVariables(value)
+		}
+	}
+}
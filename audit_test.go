@@ -0,0 +1,42 @@
+package graphql
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestMutationAudit(t *testing.T) {
+	srv, _ := sequenceServer(200, 400)
+	defer srv.Close()
+	var audits []MutationAudit
+	client := NewClient(srv.URL, WithMutationAudit(func(ctx context.Context, a MutationAudit) {
+		audits = append(audits, a)
+	}, "password"))
+	mutation := NewRequest("mutation SetUser($user: UserInput) { setUser(user: $user) }")
+	mutation.Var("user", map[string]interface{}{
+		"name":     "ann",
+		"friends":  []interface{}{map[string]interface{}{"Password": "x"}},
+		"password": "secret",
+	})
+	if err := client.Run(context.Background(), mutation, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Run(context.Background(), NewRequest("query { a }"), nil); err == nil {
+		t.Fatal("expected the 400")
+	}
+	if err := client.Run(context.Background(), NewRequest("mutation Fail { a }"), nil); err == nil {
+		t.Fatal("expected the 400")
+	}
+	if len(audits) != 2 {
+		t.Fatalf("got %d audits, want one per mutation", len(audits))
+	}
+	user := audits[0].Variables["user"].(map[string]interface{})
+	friend := user["friends"].([]interface{})[0].(map[string]interface{})
+	if audits[0].OperationName != "SetUser" || user["name"] != "ann" || user["password"] != "REDACTED" || friend["Password"] != "REDACTED" {
+		t.Errorf("got %+v, want the passwords redacted", audits[0])
+	}
+	if audits[1].OperationName != "Fail" || audits[1].Err == nil || audits[1].StatusCode != http.StatusBadRequest {
+		t.Errorf("got %+v, want the failure audited", audits[1])
+	}
+}
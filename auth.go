@@ -0,0 +1,49 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// CredentialRefresher is called when the server answers a request with 401
+// or 403. It can refresh the credentials, typically replacing the
+// Authorization entry of req.Header, and reports whether the request is to
+// be sent once more with them.
+type CredentialRefresher func(ctx context.Context, req *Request, statusCode int) (retry bool, err error)
+
+// WithCredentialRefresh calls refresh on 401 and 403 responses and sends
+// the request once more when it asks to, for expiring tokens in long
+// running workers. Requests with files are not sent again as their readers
+// are consumed; refresh is still called so later requests get the new
+// credentials.
+func WithCredentialRefresh(refresh CredentialRefresher) ClientOption {
+	return func(client *Client) {
+		client.refreshCredentials = refresh
+	}
+}
+
+// withCredentialRefresh wraps send to refresh the credentials and send
+// again after an authentication failure.
+func (c *Client) withCredentialRefresh(ctx context.Context, req *Request, send func(endpoint string) error) func(endpoint string) error {
+	if c.refreshCredentials == nil {
+		return send
+	}
+	return func(endpoint string) error {
+		err := send(endpoint)
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || (statusErr.StatusCode != http.StatusUnauthorized && statusErr.StatusCode != http.StatusForbidden) {
+			return err
+		}
+		retry, refreshErr := c.refreshCredentials(ctx, req, statusErr.StatusCode)
+		if refreshErr != nil {
+			return fmt.Errorf("refresh credentials: %w", refreshErr)
+		}
+		if !retry || req.hasFiles() {
+			return err
+		}
+		c.logDebugw(ctx, "credentials refreshed, sending again", "operation", req.OperationName(), "status", statusErr.StatusCode)
+		return send(endpoint)
+	}
+}
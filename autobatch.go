@@ -0,0 +1,170 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithAutoBatching collects the queries run within window of each other
+// and sends them in a single batched request, as with RunBatch, returning
+// its result to each caller transparently, to cut the round trips of
+// code resolving many small queries at once, DataLoader style. A batch is
+// sent once window elapsed since its first query, or as soon as it holds
+// maxSize queries if maxSize is positive. Only queries with the same
+// endpoint, headers and timeout are batched together, the retry settings
+// of the first one applying to the batch; a query alone in its window is
+// sent as usual. Mutations and requests with files are never batched.
+func WithAutoBatching(window time.Duration, maxSize int) ClientOption {
+	return func(client *Client) {
+		client.autoBatch = &autoBatcher{client: client, window: window, maxSize: maxSize}
+	}
+}
+
+// autoBatcher gathers the calls to send in batches.
+type autoBatcher struct {
+	client  *Client
+	window  time.Duration
+	maxSize int
+
+	mu sync.Mutex
+	// pending are the batches being collected by key.
+	pending map[string]*pendingBatch
+}
+
+// pendingBatch is a batch being collected.
+type pendingBatch struct {
+	calls []*batchedCall
+	timer *time.Timer
+}
+
+// batchedCall is a Run call waiting for its batch.
+type batchedCall struct {
+	ctx context.Context
+	req *Request
+	// data receives the data of the response, decoded by the caller so
+	// its response object is untouched once it gave up.
+	data json.RawMessage
+	done chan error
+}
+
+// accepts reports whether req is batched.
+func (b *autoBatcher) accepts(req *Request) bool {
+	return !req.hasFiles() && req.OperationType() == OperationQuery
+}
+
+// run adds req to a batch and waits for its result, decoded into resp.
+func (b *autoBatcher) run(ctx context.Context, req *Request, resp interface{}) error {
+	call := &batchedCall{ctx: ctx, req: req, done: make(chan error, 1)}
+	key := batchKey(req)
+	b.mu.Lock()
+	if b.pending == nil {
+		b.pending = make(map[string]*pendingBatch)
+	}
+	batch := b.pending[key]
+	if batch == nil {
+		batch = &pendingBatch{}
+		b.pending[key] = batch
+		batch.timer = time.AfterFunc(b.window, func() { b.flush(key, batch) })
+	}
+	batch.calls = append(batch.calls, call)
+	full := b.maxSize > 0 && len(batch.calls) >= b.maxSize
+	if full {
+		delete(b.pending, key)
+	}
+	b.mu.Unlock()
+	if full {
+		batch.timer.Stop()
+		go b.send(batch)
+	}
+	select {
+	case err := <-call.done:
+		if resp != nil && len(call.data) > 0 {
+			if decodeErr := json.Unmarshal(call.data, resp); decodeErr != nil && err == nil {
+				err = decodeErr
+			}
+		}
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush sends batch, collected under key, once its window elapsed,
+// unless it was already sent for being full.
+func (b *autoBatcher) flush(key string, batch *pendingBatch) {
+	b.mu.Lock()
+	if b.pending[key] != batch {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, key)
+	b.mu.Unlock()
+	b.send(batch)
+}
+
+// send sends the calls of batch whose callers are still waiting.
+func (b *autoBatcher) send(batch *pendingBatch) {
+	calls := slices.DeleteFunc(batch.calls, func(call *batchedCall) bool {
+		return call.ctx.Err() != nil
+	})
+	c := b.client
+	switch len(calls) {
+	case 0:
+		return
+	case 1:
+		call := calls[0]
+		call.done <- c.runRequest(call.ctx, call.req, &call.data)
+		return
+	}
+	c.logDebugw(calls[0].ctx, ">> batching queries", "count", len(calls))
+	reqs := make([]*Request, len(calls))
+	resps := make([]interface{}, len(calls))
+	for i, call := range calls {
+		reqs[i] = call.req
+		resps[i] = &call.data
+	}
+	// The batch is sent on behalf of the first call, whatever happens to
+	// its caller.
+	errs, err := c.runBatch(context.WithoutCancel(calls[0].ctx), reqs, resps)
+	first, _ := calls[0].ctx.Value(runInfoKey{}).(*runInfo)
+	for i, call := range calls {
+		if info, ok := call.ctx.Value(runInfoKey{}).(*runInfo); ok && first != nil && i > 0 {
+			info.shareAttempts(first)
+		}
+		if err != nil {
+			call.done <- err
+			continue
+		}
+		call.done <- errs[i]
+	}
+}
+
+// batchKey returns the key of the batches req can be sent in.
+func batchKey(req *Request) string {
+	return req.endpoint + "\x00" + strconv.FormatInt(int64(req.timeout), 10) + "\x00" + headerKey(req.Header)
+}
+
+// headerKey returns a string identifying the values of header.
+func headerKey(header http.Header) string {
+	var key strings.Builder
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		key.WriteString(name)
+		for _, value := range header[name] {
+			key.WriteByte(0)
+			key.WriteString(value)
+		}
+		key.WriteByte('\n')
+	}
+	return key.String()
+}
@@ -0,0 +1,128 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// echoBatchServer answers each operation, batched or not, with its id
+// variable, recording the size of the requests.
+func echoBatchServer(t *testing.T) (*httptest.Server, func() []int) {
+	var mu sync.Mutex
+	var sizes []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type operation struct{ Variables struct{ ID int } }
+		var body json.RawMessage
+		json.NewDecoder(r.Body).Decode(&body)
+		var operations []operation
+		if strings.HasPrefix(string(body), "[") {
+			json.Unmarshal(body, &operations)
+		} else {
+			operations = make([]operation, 1)
+			json.Unmarshal(body, &operations[0])
+		}
+		mu.Lock()
+		sizes = append(sizes, len(operations))
+		mu.Unlock()
+		results := make([]string, len(operations))
+		for i, op := range operations {
+			results[i] = fmt.Sprintf(`{"data":{"id":%d}}`, op.Variables.ID)
+		}
+		if strings.HasPrefix(string(body), "[") {
+			fmt.Fprintf(w, "[%s]", strings.Join(results, ","))
+		} else {
+			fmt.Fprint(w, results[0])
+		}
+	}))
+	return srv, func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), sizes...)
+	}
+}
+
+// runConcurrently runs n queries at once, each with its index as id and
+// the header set by header, checking each gets its own response.
+func runConcurrently(t *testing.T, client *Client, n int, header func(i int) string) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := NewRequest("query($id: Int!) { id(id: $id) }")
+			req.Var("id", i)
+			if header != nil {
+				req.Header.Set("X-Tenant", header(i))
+			}
+			var resp struct{ ID int }
+			if err := client.Run(context.Background(), req, &resp); err != nil {
+				t.Error(err)
+			} else if resp.ID != i {
+				t.Errorf("query %d got the response of %d", i, resp.ID)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestAutoBatching(t *testing.T) {
+	srv, sizes := echoBatchServer(t)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithAutoBatching(50*time.Millisecond, 0))
+	runConcurrently(t, client, 10, nil)
+	if got := sizes(); len(got) != 1 || got[0] != 10 {
+		t.Errorf("got requests of %v operations, want one of 10", got)
+	}
+}
+
+func TestAutoBatchingMaxSize(t *testing.T) {
+	srv, sizes := echoBatchServer(t)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithAutoBatching(time.Second, 4))
+	start := time.Now()
+	runConcurrently(t, client, 8, nil)
+	if got := sizes(); len(got) != 2 || got[0] != 4 || got[1] != 4 {
+		t.Errorf("got requests of %v operations, want two of 4", got)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("full batches waited %s for the window", elapsed)
+	}
+}
+
+func TestAutoBatchingSeparatesHeaders(t *testing.T) {
+	srv, sizes := echoBatchServer(t)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithAutoBatching(50*time.Millisecond, 0))
+	runConcurrently(t, client, 6, func(i int) string { return fmt.Sprint(i % 2) })
+	if got := sizes(); len(got) != 2 || got[0] != 3 || got[1] != 3 {
+		t.Errorf("got requests of %v operations, want two of 3", got)
+	}
+}
+
+func TestAutoBatchingAloneAndMutations(t *testing.T) {
+	srv, sizes := echoBatchServer(t)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithAutoBatching(10*time.Millisecond, 0))
+	runConcurrently(t, client, 1, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.Run(context.Background(), NewRequest("mutation { id }"), nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := sizes(); len(got) != 4 || got[0] != 1 {
+		t.Errorf("got requests of %v operations, want four single ones", got)
+	}
+}
@@ -0,0 +1,164 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Endpoint is a GraphQL endpoint of a load balanced pool.
+type Endpoint struct {
+	URL string
+	// Weight is the relative share of requests sent to the endpoint by
+	// weighted balancers. Zero or less counts as 1.
+	Weight int
+}
+
+// EndpointState is an endpoint of the pool with the number of requests
+// currently in flight to it.
+type EndpointState struct {
+	Endpoint
+	Pending int
+}
+
+// Balancer chooses the endpoint each request is sent to.
+// Pick returns the index of the chosen endpoint in endpoints, which is
+// never empty. Calls to Pick are serialized by the client, so
+// implementations don't need their own locking.
+type Balancer interface {
+	Pick(endpoints []EndpointState) int
+}
+
+// BalancerFunc adapts an ordinary function to a Balancer.
+type BalancerFunc func(endpoints []EndpointState) int
+
+// Pick calls f(endpoints).
+func (f BalancerFunc) Pick(endpoints []EndpointState) int {
+	return f(endpoints)
+}
+
+// WithLoadBalancing spreads requests over the endpoint given to NewClient,
+// if not empty, and endpoints, using balancer to choose among them.
+// A request that fails at the transport level or gets a 5xx response is
+// sent to another endpoint of the pool, except requests with files.
+// WithFallbackEndpoints is ignored when load balancing is used.
+//
+//	client := graphql.NewClient("", graphql.WithLoadBalancing(graphql.RoundRobin(),
+//		graphql.Endpoint{URL: "http://10.0.0.1/graphql"},
+//		graphql.Endpoint{URL: "http://10.0.0.2/graphql"},
+//	))
+func WithLoadBalancing(balancer Balancer, endpoints ...Endpoint) ClientOption {
+	return func(client *Client) {
+		client.balancer = balancer
+		client.balancedEndpoints = endpoints
+	}
+}
+
+// RoundRobin returns a Balancer cycling through the endpoints in order.
+func RoundRobin() Balancer {
+	next := 0
+	return BalancerFunc(func(endpoints []EndpointState) int {
+		i := next % len(endpoints)
+		next = i + 1
+		return i
+	})
+}
+
+// WeightedRoundRobin returns a Balancer sending each endpoint a share of
+// requests proportional to its Weight, interleaving them smoothly.
+func WeightedRoundRobin() Balancer {
+	current := map[string]int{}
+	return BalancerFunc(func(endpoints []EndpointState) int {
+		best, total := 0, 0
+		for i, e := range endpoints {
+			weight := e.Weight
+			if weight <= 0 {
+				weight = 1
+			}
+			total += weight
+			current[e.URL] += weight
+			if current[e.URL] > current[endpoints[best].URL] {
+				best = i
+			}
+		}
+		current[endpoints[best].URL] -= total
+		return best
+	})
+}
+
+// LeastPending returns a Balancer choosing the endpoint with the fewest
+// requests in flight, the first one in case of a tie.
+func LeastPending() Balancer {
+	return BalancerFunc(func(endpoints []EndpointState) int {
+		best := 0
+		for i, e := range endpoints {
+			if e.Pending < endpoints[best].Pending {
+				best = i
+			}
+		}
+		return best
+	})
+}
+
+// pool is a load balanced set of endpoints.
+type pool struct {
+	balancer Balancer
+
+	mu        sync.Mutex
+	endpoints []EndpointState
+}
+
+// pick chooses an endpoint among those not excluded and marks a request
+// in flight to it. It returns -1 once every endpoint is excluded.
+func (p *pool) pick(excluded map[int]bool) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	candidates := make([]EndpointState, 0, len(p.endpoints))
+	indexes := make([]int, 0, len(p.endpoints))
+	for i, e := range p.endpoints {
+		if !excluded[i] {
+			candidates = append(candidates, e)
+			indexes = append(indexes, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return -1
+	}
+	choice := p.balancer.Pick(candidates)
+	if choice < 0 || choice >= len(candidates) {
+		choice = 0
+	}
+	i := indexes[choice]
+	p.endpoints[i].Pending++
+	return i
+}
+
+func (p *pool) done(i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.endpoints[i].Pending--
+}
+
+// send calls send with endpoints chosen by the balancer until one of them
+// answers or they have all been tried.
+func (p *pool) send(ctx context.Context, req *Request, send func(endpoint string) error, logger func(ctx context.Context, msg string, keysAndValues ...interface{})) error {
+	tried := map[int]bool{}
+	var err error
+	for {
+		i := p.pick(tried)
+		if i < 0 {
+			if err == nil {
+				err = errors.New("graphql: no endpoint to send the request to")
+			}
+			return err
+		}
+		endpoint := p.endpoints[i].URL
+		err = send(endpoint)
+		p.done(i)
+		if !shouldFailover(ctx, err) || req.hasFiles() {
+			return err
+		}
+		logger(ctx, "endpoint failed", "operation", req.OperationName(), "endpoint", endpoint, "error", err)
+		tried[i] = true
+	}
+}
@@ -0,0 +1,61 @@
+package graphql
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// picks returns the indexes balancer picks for n requests among
+// endpoints.
+func picks(balancer Balancer, endpoints []EndpointState, n int) []int {
+	var got []int
+	for i := 0; i < n; i++ {
+		got = append(got, balancer.Pick(endpoints))
+	}
+	return got
+}
+
+func TestBalancers(t *testing.T) {
+	endpoints := []EndpointState{
+		{Endpoint: Endpoint{URL: "a", Weight: 3}, Pending: 2},
+		{Endpoint: Endpoint{URL: "b"}, Pending: 1},
+		{Endpoint: Endpoint{URL: "c"}, Pending: 1},
+	}
+	for name, tt := range map[string]struct {
+		balancer Balancer
+		want     []int
+	}{
+		"round robin":   {RoundRobin(), []int{0, 1, 2, 0, 1}},
+		"weighted":      {WeightedRoundRobin(), []int{0, 1, 0, 2, 0}},
+		"least pending": {LeastPending(), []int{1, 1, 1, 1, 1}},
+	} {
+		got := picks(tt.balancer, endpoints, len(tt.want))
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestLoadBalancing(t *testing.T) {
+	a, aRequests := countingServer(http.StatusOK)
+	defer a.Close()
+	b, bRequests := countingServer(http.StatusOK)
+	defer b.Close()
+	down, downRequests := countingServer(http.StatusBadGateway)
+	defer down.Close()
+	client := NewClient("", WithoutRetry(), WithLoadBalancing(RoundRobin(),
+		Endpoint{URL: a.URL}, Endpoint{URL: down.URL}, Endpoint{URL: b.URL}))
+	for i := 0; i < 3; i++ {
+		if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if downRequests.Load() == 0 || aRequests.Load()+bRequests.Load() != 3 {
+		t.Errorf("got %d, %d and %d requests, want the requests to the failing endpoint sent to another one",
+			aRequests.Load(), downRequests.Load(), bRequests.Load())
+	}
+}
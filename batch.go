@@ -0,0 +1,207 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// BatchError is returned by RunBatch when operations of the batch failed.
+type BatchError struct {
+	// Errors holds the error of each operation by index, nil for the
+	// ones that succeeded.
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	failed := e.Unwrap()
+	if len(failed) == 0 {
+		return "graphql: batch failed"
+	}
+	return fmt.Sprintf("graphql: %d of %d batched operations failed, first: %v", len(failed), len(e.Errors), failed[0])
+}
+
+// Unwrap returns the errors of the operations that failed.
+func (e *BatchError) Unwrap() []error {
+	var failed []error
+	for _, err := range e.Errors {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return failed
+}
+
+// RunBatch executes reqs in a single HTTP request whose JSON body is the
+// array of their operations, for servers that support batching, and
+// unmarshals the data of each response into the response object of the
+// same index in resps. A nil response object skips parsing, like with
+// Run. The headers, endpoint, timeout and retry settings of the first
+// request apply to the whole batch, which is always sent as JSON, so
+// requests with files can't be batched.
+// If the batch can't be sent, or the server answers with a non-200
+// status, the error is returned; otherwise a *BatchError tells which
+// operations failed, if any. Each operation is accounted as a call by
+// Stats and the observers.
+func (c *Client) RunBatch(ctx context.Context, reqs []*Request, resps []interface{}) error {
+	if len(resps) != len(reqs) {
+		return fmt.Errorf("graphql: %d response objects for %d batched requests", len(resps), len(reqs))
+	}
+	if len(reqs) == 0 {
+		return nil
+	}
+	start := time.Now()
+	ctxs := make([]context.Context, len(reqs))
+	infos := make([]*runInfo, len(reqs))
+	for i, req := range reqs {
+		ctxs[i], infos[i] = c.begin(ctx, req)
+	}
+	errs, err := c.runBatch(ctxs[0], reqs, resps)
+	for i, req := range reqs {
+		if i > 0 {
+			infos[i].shareAttempts(infos[0])
+		}
+		callErr := err
+		if err == nil {
+			callErr = errs[i]
+		}
+		c.finish(ctxs[i], req, infos[i], start, callErr)
+	}
+	if err != nil {
+		return err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return &BatchError{Errors: errs}
+		}
+	}
+	return nil
+}
+
+// shareAttempts records in info the attempts of the call from, which sent
+// it along with other operations. Their bodies are counted once, by from.
+func (info *runInfo) shareAttempts(from *runInfo) {
+	info.attempts.Store(from.attempts.Load())
+	info.statusCode.Store(from.statusCode.Load())
+}
+
+func (c *Client) runBatch(ctx context.Context, reqs []*Request, resps []interface{}) ([]error, error) {
+	ctx, cancel := reqs[0].context(ctx)
+	defer cancel()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	release, err := c.enqueue(ctx, reqs[0])
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if ctx, err = c.idempotencyContext(ctx); err != nil {
+		return nil, err
+	}
+	var errs []error
+	err = c.withEndpoints(ctx, reqs[0], func(endpoint string) error {
+		r, err := c.newBatchRequest(ctx, reqs, endpoint)
+		if err != nil {
+			return err
+		}
+		ctx := ctx
+		hedge := true
+		for _, req := range reqs {
+			ctx = c.mutationRetryContext(ctx, req, r)
+			hedge = hedge && req.OperationType() == OperationQuery
+		}
+		if hedge {
+			ctx = c.hedgeContext(ctx, reqs[0])
+		}
+		errs, err = c.executeBatch(ctx, r, resps)
+		return err
+	})
+	return errs, err
+}
+
+// newBatchRequest builds the HTTP request sending reqs to endpoint as a
+// JSON array.
+func (c *Client) newBatchRequest(ctx context.Context, reqs []*Request, endpoint string) (*http.Request, error) {
+	endpoint = unixEndpoint(endpoint)
+	envelopes := make([]requestEnvelope, len(reqs))
+	for i, req := range reqs {
+		if req.hasFiles() {
+			return nil, errors.New("graphql: cannot send files in a batch")
+		}
+		if err := c.checkPersisted(req); err != nil {
+			return nil, err
+		}
+		envelopes[i] = c.envelope(req)
+		c.logDebugRequest(ctx, req)
+	}
+	size := 2
+	for i, req := range reqs {
+		size += len(req.q) + len(envelopes[i].OperationName) + envelopeSize
+	}
+	requestBody, err := encodeBody(envelopes, size)
+	if err != nil {
+		return nil, err
+	}
+	body, compressed, err := c.compressBody(ctx, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	r.Close = c.closeReq
+	if compressed {
+		r.Header.Set("Content-Encoding", "gzip")
+	}
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	r.Header.Set("Accept", "application/json; charset=utf-8")
+	if err := c.setHeaders(ctx, r, reqs[0]); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// executeBatch sends r and decodes the array of GraphQL responses into
+// resps by index, returning the first GraphQL error of each.
+func (c *Client) executeBatch(ctx context.Context, r *http.Request, resps []interface{}) ([]error, error) {
+	r = r.WithContext(ctx)
+	buf, status, err := c.doRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer putBuffer(buf)
+	if status != http.StatusOK {
+		c.logErrorw(ctx, "server returned a non-200 status code", "status", status, "body", c.debugBody(buf.Bytes()))
+		return nil, &StatusError{StatusCode: status}
+	}
+	c.logDebugw(ctx, "<< response", "status", status, "body", c.debugBody(buf.Bytes()))
+	var results []json.RawMessage
+	if err := json.NewDecoder(buf).Decode(&results); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	if len(results) != len(resps) {
+		return nil, fmt.Errorf("graphql: %d responses to a batch of %d operations", len(results), len(resps))
+	}
+	errs := make([]error, len(resps))
+	for i, result := range results {
+		gr := &graphResponse{
+			Data: resps[i],
+		}
+		if err := json.Unmarshal(result, gr); err != nil {
+			errs[i] = fmt.Errorf("decoding response: %w", err)
+			continue
+		}
+		if len(gr.Errors) > 0 {
+			errs[i] = gr.Errors[0]
+		}
+	}
+	return errs, nil
+}
@@ -0,0 +1,89 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunBatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var operations []struct {
+			Query     string
+			Variables map[string]interface{}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&operations); err != nil {
+			t.Errorf("decoding batch: %v", err)
+		}
+		if len(operations) != 3 || operations[1].Variables["id"] != "2" {
+			t.Errorf("got operations %+v", operations)
+		}
+		io.WriteString(w, `[{"data":{"user":{"name":"a"}}},{"data":{"user":null},"errors":[{"message":"not found"}]},{"data":{"user":{"name":"c"}}}]`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	reqs := make([]*Request, 3)
+	resps := make([]interface{}, 3)
+	names := make([]struct{ User struct{ Name string } }, 3)
+	for i := range reqs {
+		reqs[i] = NewRequest("query($id: ID!) { user(id: $id) { name } }")
+		reqs[i].Var("id", string(rune('1'+i)))
+		resps[i] = &names[i]
+	}
+	err := client.RunBatch(context.Background(), reqs, resps)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("got %v, want a BatchError", err)
+	}
+	if batchErr.Errors[0] != nil || batchErr.Errors[1] == nil || batchErr.Errors[2] != nil {
+		t.Errorf("got errors %v, want only the second one", batchErr.Errors)
+	}
+	if !strings.Contains(err.Error(), "1 of 3") {
+		t.Errorf("got message %q", err)
+	}
+	if names[0].User.Name != "a" || names[2].User.Name != "c" {
+		t.Errorf("got responses %+v", names)
+	}
+}
+
+func TestRunBatchResponseCount(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[{"data":{}}]`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	reqs := []*Request{NewRequest("{ a }"), NewRequest("{ b }")}
+	if err := client.RunBatch(context.Background(), reqs, make([]interface{}, 2)); err == nil {
+		t.Error("expected an error for a missing response")
+	}
+	if err := client.RunBatch(context.Background(), reqs, make([]interface{}, 1)); err == nil {
+		t.Error("expected an error for a missing response object")
+	}
+}
+
+func TestRunBatchRejectsFiles(t *testing.T) {
+	client := NewClient("http://example.com", UseMultipartForm())
+	req := NewRequest("mutation($f: Upload!) { upload(file: $f) }")
+	req.File("f", "a.txt", strings.NewReader("x"))
+	if err := client.RunBatch(context.Background(), []*Request{req}, []interface{}{nil}); err == nil {
+		t.Error("expected an error for a request with files")
+	}
+}
+
+func TestRunBatchStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	err := client.RunBatch(context.Background(), []*Request{NewRequest("{ a }")}, []interface{}{nil})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("got %v, want a StatusError", err)
+	}
+}
@@ -0,0 +1,211 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without sending the request while the
+// circuit breaker of the endpoint is open.
+var ErrCircuitOpen = errors.New("graphql: circuit breaker is open")
+
+// CircuitBreaker configures the circuit breaker set with
+// WithCircuitBreaker.
+//
+// The breaker counts the outcome of each request, after retries, over a
+// rolling Window. Transport errors and 5xx responses are failures, while
+// requests canceled by their caller aren't counted. Once at least
+// MinRequests were made in the window and the share of failures reaches
+// FailureRatio, the breaker opens and requests fail immediately with
+// ErrCircuitOpen. After OpenTimeout it lets up to HalfOpenProbes
+// requests through: if they all succeed the breaker closes again, and the
+// first failure opens it for another OpenTimeout.
+type CircuitBreaker struct {
+	FailureRatio   float64
+	MinRequests    int
+	Window         time.Duration
+	OpenTimeout    time.Duration
+	HalfOpenProbes int
+}
+
+// DefaultCircuitBreaker opens when half of at least 10 requests made in a
+// minute failed, and probes the endpoint again after 30 seconds.
+var DefaultCircuitBreaker = CircuitBreaker{
+	FailureRatio:   0.5,
+	MinRequests:    10,
+	Window:         time.Minute,
+	OpenTimeout:    30 * time.Second,
+	HalfOpenProbes: 1,
+}
+
+// WithCircuitBreaker wraps the HTTP client's transport with a circuit
+// breaker, so a failing backend fails fast instead of every caller going
+// through all retries. Each endpoint host has its own breaker.
+func WithCircuitBreaker(cb CircuitBreaker) ClientOption {
+	return func(client *Client) {
+		client.circuitBreaker = &cb
+	}
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// breakerTransport applies a circuit breaker per request host.
+type breakerTransport struct {
+	transport http.RoundTripper
+	settings  CircuitBreaker
+	logger    logFunc
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func newBreakerTransport(transport http.RoundTripper, settings CircuitBreaker, logger logFunc) *breakerTransport {
+	if settings.Window <= 0 {
+		settings.Window = DefaultCircuitBreaker.Window
+	}
+	if settings.HalfOpenProbes <= 0 {
+		settings.HalfOpenProbes = 1
+	}
+	return &breakerTransport{
+		transport: transport,
+		settings:  settings,
+		logger:    logger,
+		breakers:  make(map[string]*breaker),
+	}
+}
+
+func (t *breakerTransport) breaker(host string) *breaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = &breaker{settings: t.settings, windowStart: time.Now()}
+		t.breakers[host] = b
+	}
+	return b
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.breaker(req.URL.Host)
+	if !b.allow(time.Now()) {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, ErrCircuitOpen
+	}
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil && (req.Context().Err() != nil || errors.Is(err, context.Canceled)) {
+		// The caller gave up, which says nothing about the endpoint.
+		b.release()
+		return resp, err
+	}
+	failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+	if changed, state := b.record(time.Now(), failed); changed {
+		switch state {
+		case circuitOpen:
+			t.logger("circuit breaker opened", "host", req.URL.Host)
+		case circuitClosed:
+			t.logger("circuit breaker closed", "host", req.URL.Host)
+		}
+	}
+	return resp, err
+}
+
+// breaker is the circuit breaker of one host.
+type breaker struct {
+	settings CircuitBreaker
+
+	mu          sync.Mutex
+	state       circuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	successes   int
+}
+
+// refresh moves an open breaker to half-open once its timeout elapsed and
+// starts a new window when the current one is over.
+func (b *breaker) refresh(now time.Time) {
+	if b.state == circuitOpen && now.Sub(b.openedAt) >= b.settings.OpenTimeout {
+		b.state = circuitHalfOpen
+		b.probes, b.successes = 0, 0
+	}
+	if b.state == circuitClosed && now.Sub(b.windowStart) >= b.settings.Window {
+		b.windowStart = now
+		b.requests, b.failures = 0, 0
+	}
+}
+
+// allow reports whether a request may be sent.
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh(now)
+	switch b.state {
+	case circuitOpen:
+		return false
+	case circuitHalfOpen:
+		if b.probes >= b.settings.HalfOpenProbes {
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// record accounts for the outcome of a request and reports whether the
+// state changed, and the new state.
+func (b *breaker) record(now time.Time, failed bool) (bool, circuitState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitHalfOpen:
+		if failed {
+			b.open(now)
+			return true, b.state
+		}
+		b.successes++
+		if b.successes >= b.settings.HalfOpenProbes {
+			b.state = circuitClosed
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+			return true, b.state
+		}
+	case circuitClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.settings.MinRequests &&
+			float64(b.failures) >= b.settings.FailureRatio*float64(b.requests) && b.failures > 0 {
+			b.open(now)
+			return true, b.state
+		}
+	}
+	return false, b.state
+}
+
+// release gives back the probe of a request whose outcome isn't counted.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == circuitHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+func (b *breaker) open(now time.Time) {
+	b.state = circuitOpen
+	b.openedAt = now
+}
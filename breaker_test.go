@@ -0,0 +1,76 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newBreakerRequest returns a request made with ctx.
+func newBreakerRequest(ctx context.Context) *http.Request {
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://example.com", nil)
+	return r
+}
+
+func TestBreakerOpensOnFailures(t *testing.T) {
+	failure := errors.New("connection refused")
+	transport := newBreakerTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, failure
+	}), CircuitBreaker{FailureRatio: 0.5, MinRequests: 2, OpenTimeout: time.Minute}, noLog)
+	for i := 0; i < 2; i++ {
+		if _, err := transport.RoundTrip(newBreakerRequest(context.Background())); !errors.Is(err, failure) {
+			t.Fatalf("got %v", err)
+		}
+	}
+	if _, err := transport.RoundTrip(newBreakerRequest(context.Background())); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestBreakerIgnoresCanceledRequests(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	transport := newBreakerTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if err := r.Context().Err(); err != nil {
+			return nil, err
+		}
+		return response(http.StatusOK), nil
+	}), CircuitBreaker{FailureRatio: 0.5, MinRequests: 2, OpenTimeout: time.Minute}, noLog)
+	for i := 0; i < 5; i++ {
+		if _, err := transport.RoundTrip(newBreakerRequest(ctx)); !errors.Is(err, context.Canceled) {
+			t.Fatalf("got %v", err)
+		}
+	}
+	if _, err := transport.RoundTrip(newBreakerRequest(context.Background())); err != nil {
+		t.Errorf("got %v after canceled requests, want the breaker closed", err)
+	}
+}
+
+func TestBreakerCanceledProbeReleased(t *testing.T) {
+	fail := true
+	transport := newBreakerTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if err := r.Context().Err(); err != nil {
+			return nil, err
+		}
+		if fail {
+			return response(http.StatusServiceUnavailable), nil
+		}
+		return response(http.StatusOK), nil
+	}), CircuitBreaker{FailureRatio: 0.5, MinRequests: 1, OpenTimeout: time.Millisecond}, noLog)
+	transport.RoundTrip(newBreakerRequest(context.Background()))
+	time.Sleep(5 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := transport.RoundTrip(newBreakerRequest(ctx)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want the probe canceled", err)
+	}
+	fail = false
+	if _, err := transport.RoundTrip(newBreakerRequest(context.Background())); err != nil {
+		t.Fatalf("got %v, want the probe of the canceled request given back", err)
+	}
+	if state := transport.breaker("example.com").state; state != circuitClosed {
+		t.Errorf("got state %d, want closed after the probe succeeded", state)
+	}
+}
@@ -0,0 +1,94 @@
+package graphql
+
+import (
+	"sync"
+	"time"
+)
+
+// WithRetryBudget limits the retries made by the default HTTP client to
+// ratio times the number of requests sent over the last window, plus
+// minRetries, shared by every goroutine using the client. For instance a
+// ratio of 0.2 allows one retry for every five requests. Once the budget
+// is spent the last response is returned without retrying, so
+// synchronized retries can't amplify the load on a degraded server. A
+// window of zero or less means the default of 10 seconds.
+func WithRetryBudget(ratio float64, minRetries int, window time.Duration) ClientOption {
+	return func(client *Client) {
+		client.retryBudget = newRetryBudget(ratio, minRetries, window)
+	}
+}
+
+// budgetBuckets is the number of buckets the budget window is split in.
+const budgetBuckets = 10
+
+// defaultBudgetWindow is the window of a retry budget given none.
+const defaultBudgetWindow = 10 * time.Second
+
+// retryBudget counts requests and retries over a rolling window made of
+// fixed size buckets.
+type retryBudget struct {
+	ratio      float64
+	minRetries int
+	bucketSize time.Duration
+
+	mu       sync.Mutex
+	requests [budgetBuckets]int
+	retries  [budgetBuckets]int
+	// current is the index of the bucket for the time slot started at.
+	current int
+	started time.Time
+}
+
+func newRetryBudget(ratio float64, minRetries int, window time.Duration) *retryBudget {
+	if window <= 0 {
+		window = defaultBudgetWindow
+	}
+	return &retryBudget{
+		ratio:      ratio,
+		minRetries: minRetries,
+		bucketSize: max(window/budgetBuckets, 1),
+		started:    time.Now(),
+	}
+}
+
+// advance rotates the buckets up to now, clearing the expired ones.
+func (b *retryBudget) advance(now time.Time) {
+	slots := now.Sub(b.started) / b.bucketSize
+	if slots <= 0 {
+		return
+	}
+	b.started = b.started.Add(slots * b.bucketSize)
+	if slots > budgetBuckets {
+		slots = budgetBuckets
+	}
+	for i := time.Duration(0); i < slots; i++ {
+		b.current = (b.current + 1) % budgetBuckets
+		b.requests[b.current] = 0
+		b.retries[b.current] = 0
+	}
+}
+
+// request accounts for a new request.
+func (b *retryBudget) request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(time.Now())
+	b.requests[b.current]++
+}
+
+// withdraw reports whether a retry fits in the budget and accounts for it.
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(time.Now())
+	var requests, retries int
+	for i := 0; i < budgetBuckets; i++ {
+		requests += b.requests[i]
+		retries += b.retries[i]
+	}
+	if float64(retries) >= b.ratio*float64(requests)+float64(b.minRetries) {
+		return false
+	}
+	b.retries[b.current]++
+	return true
+}
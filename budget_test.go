@@ -0,0 +1,54 @@
+package graphql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBudgetWindow(t *testing.T) {
+	for _, tt := range []struct {
+		window, bucketSize time.Duration
+	}{
+		{0, time.Second},
+		{-time.Second, time.Second},
+		{5 * time.Nanosecond, time.Nanosecond},
+		{50 * time.Nanosecond, 5 * time.Nanosecond},
+		{time.Second, 100 * time.Millisecond},
+	} {
+		b := newRetryBudget(0.5, 0, tt.window)
+		if b.bucketSize != tt.bucketSize {
+			t.Errorf("window %s: got buckets of %s, want %s", tt.window, b.bucketSize, tt.bucketSize)
+		}
+		b.request()
+		b.withdraw()
+	}
+}
+
+func TestRetryBudgetWithdraw(t *testing.T) {
+	b := newRetryBudget(0.5, 1, time.Minute)
+	for i := 0; i < 4; i++ {
+		b.request()
+	}
+	for i := 0; i < 3; i++ {
+		if !b.withdraw() {
+			t.Fatalf("retry %d refused, want 3 allowed for 4 requests", i+1)
+		}
+	}
+	if b.withdraw() {
+		t.Error("fourth retry allowed over the budget")
+	}
+}
+
+func TestRetryBudgetExpires(t *testing.T) {
+	b := newRetryBudget(0, 0, 10*time.Millisecond)
+	b.request()
+	b.retries[b.current] = 1
+	b.mu.Lock()
+	b.advance(time.Now().Add(time.Second))
+	b.mu.Unlock()
+	for i := 0; i < budgetBuckets; i++ {
+		if b.requests[i] != 0 || b.retries[i] != 0 {
+			t.Fatalf("bucket %d not cleared after the window", i)
+		}
+	}
+}
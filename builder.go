@@ -0,0 +1,172 @@
+package graphql
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RequestBuilder builds a Request step by step, validating each value as
+// it is added. The first validation error is kept and returned by Build;
+// later calls are ignored once an error has occurred.
+//
+//	req, err := graphql.NewQuery(`query ($id: ID!) { item(id: $id) { name } }`).
+//		Var("id", "42").
+//		Header("Authorization", "Bearer "+token).
+//		Timeout(5 * time.Second).
+//		Build()
+type RequestBuilder struct {
+	req *Request
+	err error
+}
+
+// NewQuery starts building a Request for the query document q.
+func NewQuery(q string) *RequestBuilder {
+	b := &RequestBuilder{req: NewRequest(q)}
+	if strings.TrimSpace(q) == "" {
+		b.err = errors.New("graphql: empty query")
+	} else if len(parseOperations(q)) == 0 {
+		b.err = errors.New("graphql: query contains no operation")
+	}
+	return b
+}
+
+// Var sets a variable. The key must be a valid GraphQL name.
+func (b *RequestBuilder) Var(key string, value interface{}) *RequestBuilder {
+	if b.err != nil {
+		return b
+	}
+	if !isName(key) {
+		b.err = fmt.Errorf("graphql: invalid variable name %q", key)
+		return b
+	}
+	b.req.Var(key, value)
+	return b
+}
+
+// Header adds a request header.
+func (b *RequestBuilder) Header(key, value string) *RequestBuilder {
+	if b.err != nil {
+		return b
+	}
+	if !isToken(key) {
+		b.err = fmt.Errorf("graphql: invalid header name %q", key)
+		return b
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		b.err = fmt.Errorf("graphql: invalid value for header %q", key)
+		return b
+	}
+	b.req.Header.Add(key, value)
+	return b
+}
+
+// OperationName selects the operation to execute. The document must
+// contain an operation with that name.
+func (b *RequestBuilder) OperationName(name string) *RequestBuilder {
+	if b.err != nil {
+		return b
+	}
+	if _, ok := selectOperation(b.req.q, name); !ok {
+		b.err = fmt.Errorf("graphql: operation %q not found in query", name)
+		return b
+	}
+	b.req.SetOperationName(name)
+	return b
+}
+
+// File adds a file to upload.
+func (b *RequestBuilder) File(fieldName, filename string, r io.Reader, opts ...FileOption) *RequestBuilder {
+	if b.err != nil {
+		return b
+	}
+	if fieldName == "" {
+		b.err = errors.New("graphql: empty file field name")
+		return b
+	}
+	if r == nil {
+		b.err = fmt.Errorf("graphql: nil reader for file field %q", fieldName)
+		return b
+	}
+	b.req.File(fieldName, filename, r, opts...)
+	return b
+}
+
+// Timeout bounds how long Run may take for this request.
+func (b *RequestBuilder) Timeout(d time.Duration) *RequestBuilder {
+	if b.err != nil {
+		return b
+	}
+	if d <= 0 {
+		b.err = fmt.Errorf("graphql: invalid timeout %s", d)
+		return b
+	}
+	b.req.timeout = d
+	return b
+}
+
+// MaxRetries overrides the number of retries of the request.
+func (b *RequestBuilder) MaxRetries(n int) *RequestBuilder {
+	if b.err != nil {
+		return b
+	}
+	if n < 0 {
+		b.err = fmt.Errorf("graphql: invalid retry count %d", n)
+		return b
+	}
+	b.req.SetMaxRetries(n)
+	return b
+}
+
+// Endpoint sends the request to endpoint instead of the client's.
+func (b *RequestBuilder) Endpoint(endpoint string) *RequestBuilder {
+	if b.err != nil {
+		return b
+	}
+	if _, err := url.Parse(endpoint); err != nil || endpoint == "" {
+		b.err = fmt.Errorf("graphql: invalid endpoint %q", endpoint)
+		return b
+	}
+	b.req.SetEndpoint(endpoint)
+	return b
+}
+
+// Build returns the Request, or the first validation error.
+func (b *RequestBuilder) Build() (*Request, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.req, nil
+}
+
+func isName(s string) bool {
+	if s == "" || !isNameStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isNameContinue(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isToken reports whether s is a valid HTTP header field name.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if isNameContinue(ch) {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(ch)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package graphql
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestBuilder(t *testing.T) {
+	req, err := NewQuery("query A { a } query B($id: ID!) { b(id: $id) }").
+		Var("id", "42").
+		Header("Authorization", "Bearer token").
+		OperationName("B").
+		Timeout(5 * time.Second).
+		MaxRetries(1).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Vars()["id"] != "42" || req.Header.Get("Authorization") != "Bearer token" || req.OperationName() != "B" ||
+		req.timeout != 5*time.Second || req.maxRetries != 1 {
+		t.Errorf("got %+v", req)
+	}
+}
+
+func TestRequestBuilderErrors(t *testing.T) {
+	for want, b := range map[string]*RequestBuilder{
+		"empty query":             NewQuery(" "),
+		"no operation":            NewQuery("fragment F on User { id }"),
+		"invalid variable name":   NewQuery("{ a }").Var("1d", 1),
+		"invalid header name":     NewQuery("{ a }").Header("Bad Header", "x"),
+		"invalid value":           NewQuery("{ a }").Header("X", "a\r\nInjected: 1"),
+		`operation "C" not found`: NewQuery("query A { a }").OperationName("C"),
+		"invalid timeout":         NewQuery("{ a }").Timeout(0),
+		"invalid retry count":     NewQuery("{ a }").MaxRetries(-1),
+		// later errors don't replace the first one
+		"empty file field name": NewQuery("{ a }").File("", "a.txt", strings.NewReader("")).Timeout(0),
+	} {
+		if _, err := b.Build(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got %v, want %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package graphql
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Cache stores the responses cached by a client created with
+// WithResponseCache. It can be backed by Redis or memcached to share the
+// cache between the instances of a service; NewLRUCache returns an
+// in-memory one. Keys are hex digests, prefixed with "etag:" for the
+// responses kept by WithConditionalRequests, and values are JSON. The
+// methods are called concurrently. Their errors are reported as with
+// WithErrorHook, the request being sent as if the response wasn't cached.
+type Cache interface {
+	// Get returns the value stored under key, and whether there is one
+	// that hasn't expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key for ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the value stored under key, if any.
+	Delete(ctx context.Context, key string) error
+}
+
+// defaultCacheEntries is the capacity of the in-memory cache used when
+// no Cache is given.
+const defaultCacheEntries = 10000
+
+// WithResponseCache caches the data of successful queries for ttl,
+// serving the repeated ones without a request, to cut latency and API
+// cost. Queries are identified by their endpoint, headers, operation
+// name, normalized query, variables and extensions, so formatting
+// differences don't matter. Responses with errors aren't cached, nor are
+// mutations, subscriptions and requests with files, and Ping and Poll
+// always reach the server. See Request.SetCacheTTL to override ttl per
+// request. The responses are held in memory, up to 10000 of them, unless
+// WithCacheBackend is given.
+func WithResponseCache(ttl time.Duration) ClientOption {
+	return func(client *Client) {
+		client.cache = &responseCache{ttl: ttl}
+	}
+}
+
+// WithCacheBackend stores the responses cached with WithResponseCache in
+// cache. As it doesn't report the responses it evicts or expires, at most
+// 10000 of the cached responses are indexed for WithNormalizedEntities and
+// WithInvalidationRules, the oldest ones being deleted from cache beyond.
+func WithCacheBackend(cache Cache) ClientOption {
+	return func(client *Client) {
+		client.cacheBackend = cache
+	}
+}
+
+// SetCacheTTL overrides how long the response to this request is cached
+// by a client created with WithResponseCache; zero or less disables its
+// caching, and its answer from the entities of WithNormalizedEntities.
+func (req *Request) SetCacheTTL(ttl time.Duration) {
+	req.cacheTTL = ttl
+	req.hasCacheTTL = true
+}
+
+// responseCache caches responses in a store.
+type responseCache struct {
+	ttl   time.Duration
+	store Cache
+	// maxTracked, if positive, bounds the number of responses indexed,
+	// tracked in order when the store doesn't report its removals.
+	maxTracked int
+
+	mu sync.Mutex
+	// tracked holds the keys of the indexed responses, oldest first, by
+	// key in trackedKeys.
+	tracked     *list.List
+	trackedKeys map[string]*list.Element
+	// byOperation and byType hold the keys of the cached responses by
+	// operation name and by the types of their objects, for
+	// WithInvalidationRules, and indexed what they are held under by key.
+	byOperation map[string]map[string]bool
+	byType      map[string]map[string]bool
+	indexed     map[string]responseIndex
+}
+
+// cacheTTL returns how long the response to req is cached, zero if it
+// isn't.
+func (c *Client) cacheTTL(req *Request) time.Duration {
+	if c.cache == nil || req.hasFiles() || req.OperationType() != OperationQuery {
+		return 0
+	}
+	if req.hasCacheTTL {
+		return req.cacheTTL
+	}
+	return c.cache.ttl
+}
+
+// cacheKey returns the key of the response to req in the cache. The
+// headers are part of it so that responses aren't shared between
+// credentials, which is why it is hashed.
+func cacheKey(req *Request) string {
+	key := req.endpoint + "\x00" + headerKey(req.Header) + "\x00" + req.Fingerprint()
+	if len(req.extensions) > 0 {
+		// encoding/json sorts map keys, which keeps the encoding stable
+		extensions, err := json.Marshal(req.extensions)
+		if err != nil {
+			extensions = []byte(fmt.Sprint(req.extensions))
+		}
+		key += "\x00" + string(extensions)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// runCached serves req from the cache, or sends it and caches the data
+// of its response for ttl.
+func (c *Client) runCached(ctx context.Context, req *Request, resp interface{}, ttl time.Duration) error {
+	key := cacheKey(req)
+	data, ok, err := c.cache.store.Get(ctx, key)
+	if err != nil {
+		c.reportError(ctx, fmt.Errorf("cache get: %w", err))
+	} else if ok {
+		c.logDebugw(ctx, "<< cached response", "operation", req.OperationName())
+		if resp == nil {
+			return nil
+		}
+		return json.Unmarshal(data, resp)
+	} else {
+		// The response expired or was evicted.
+		c.forgetResponse(key)
+	}
+	var raw json.RawMessage
+	if c.entities != nil {
+		raw, err = c.sendNormalized(ctx, req, key)
+	} else {
+		err = c.send(ctx, req, &raw)
+	}
+	if err == nil {
+		if err := c.cache.store.Set(ctx, key, raw, ttl); err != nil {
+			c.reportError(ctx, fmt.Errorf("cache set: %w", err))
+		}
+		if len(c.invalidationRules) > 0 {
+			var types []string
+			if c.indexesTypes() {
+				types = typeNames(raw)
+			}
+			c.cache.index(key, req.OperationName(), types)
+		}
+		if c.entities != nil || len(c.invalidationRules) > 0 {
+			c.trackResponse(ctx, key)
+		}
+	}
+	return decodeData(raw, resp, err)
+}
+
+// track records that the response with key is indexed, and returns the
+// keys of the oldest ones beyond maxTracked, no longer tracked.
+func (rc *responseCache) track(key string) []string {
+	if rc.maxTracked <= 0 {
+		return nil
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.tracked == nil {
+		rc.tracked = list.New()
+		rc.trackedKeys = make(map[string]*list.Element)
+	}
+	if e, ok := rc.trackedKeys[key]; ok {
+		rc.tracked.MoveToBack(e)
+	} else {
+		rc.trackedKeys[key] = rc.tracked.PushBack(key)
+	}
+	var evicted []string
+	for rc.tracked.Len() > rc.maxTracked {
+		oldest := rc.tracked.Remove(rc.tracked.Front()).(string)
+		delete(rc.trackedKeys, oldest)
+		evicted = append(evicted, oldest)
+	}
+	return evicted
+}
+
+// trackResponse records that the cached response with key is indexed,
+// deleting the oldest ones beyond the bound.
+func (c *Client) trackResponse(ctx context.Context, key string) {
+	for _, evicted := range c.cache.track(key) {
+		if err := c.dropResponse(ctx, evicted); err != nil {
+			c.reportError(ctx, err)
+		}
+	}
+}
+
+// forget stops tracking and indexing the response with key.
+func (rc *responseCache) forget(key string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if e, ok := rc.trackedKeys[key]; ok {
+		rc.tracked.Remove(e)
+		delete(rc.trackedKeys, key)
+	}
+	rc.unindex(key)
+}
+
+// forgetResponse drops what is indexed about the cached response with
+// key, once it left the store.
+func (c *Client) forgetResponse(key string) {
+	if c.cache != nil {
+		c.cache.forget(key)
+	}
+	if c.entities != nil {
+		c.entities.forget(key)
+	}
+}
+
+// dropResponse deletes the cached response with key and forgets it.
+func (c *Client) dropResponse(ctx context.Context, key string) error {
+	err := c.cache.store.Delete(ctx, key)
+	c.forgetResponse(key)
+	if err != nil {
+		return fmt.Errorf("cache delete: %w", err)
+	}
+	return nil
+}
+
+// decodeData unmarshals raw, the data of a response to a call that
+// returned err, into resp, returning the error of the call.
+func decodeData(raw json.RawMessage, resp interface{}, err error) error {
+	if resp != nil && len(raw) > 0 {
+		if decodeErr := json.Unmarshal(raw, resp); decodeErr != nil && err == nil {
+			err = decodeErr
+		}
+	}
+	return err
+}
+
+// LRUCache is an in-memory Cache holding a bounded number of entries,
+// evicting the least recently used ones first.
+type LRUCache struct {
+	maxEntries int
+	// onRemove, if set, is called with the key of each entry removed,
+	// evicted or expired, without the lock held.
+	onRemove func(key string)
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// lruEntry is the value of the elements of LRUCache.order.
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRUCache returns an LRUCache holding up to maxEntries entries, at
+// least one.
+func NewLRUCache(maxEntries int) *LRUCache {
+	return &LRUCache{
+		maxEntries: max(maxEntries, 1),
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get implements Cache.
+func (l *LRUCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	l.mu.Lock()
+	e, ok := l.entries[key]
+	if !ok {
+		l.mu.Unlock()
+		return nil, false, nil
+	}
+	entry := e.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		l.remove(e)
+		l.mu.Unlock()
+		l.removed(key)
+		return nil, false, nil
+	}
+	l.order.MoveToFront(e)
+	l.mu.Unlock()
+	return entry.value, true, nil
+}
+
+// Set implements Cache.
+func (l *LRUCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	l.mu.Lock()
+	expires := time.Now().Add(ttl)
+	if e, ok := l.entries[key]; ok {
+		e.Value = &lruEntry{key: key, value: value, expires: expires}
+		l.order.MoveToFront(e)
+		l.mu.Unlock()
+		return nil
+	}
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	var evicted []string
+	for l.order.Len() > l.maxEntries {
+		oldest := l.order.Back()
+		evicted = append(evicted, oldest.Value.(*lruEntry).key)
+		l.remove(oldest)
+	}
+	l.mu.Unlock()
+	for _, key := range evicted {
+		l.removed(key)
+	}
+	return nil
+}
+
+// Delete implements Cache.
+func (l *LRUCache) Delete(_ context.Context, key string) error {
+	l.mu.Lock()
+	e, ok := l.entries[key]
+	if ok {
+		l.remove(e)
+	}
+	l.mu.Unlock()
+	if ok {
+		l.removed(key)
+	}
+	return nil
+}
+
+// Len returns the number of entries held, expired ones included until
+// they are evicted.
+func (l *LRUCache) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
+
+// removed reports the removal of the entry with key to onRemove.
+func (l *LRUCache) removed(key string) {
+	if l.onRemove != nil {
+		l.onRemove(key)
+	}
+}
+
+// remove removes e. The lock of l must be held.
+func (l *LRUCache) remove(e *list.Element) {
+	l.order.Remove(e)
+	delete(l.entries, e.Value.(*lruEntry).key)
+}
@@ -0,0 +1,223 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cachedServer answers queries with the data given by body for each
+// request, counting them.
+func cachedServer(body func(n int32) string) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body(requests.Add(1)))
+	}))
+	return srv, &requests
+}
+
+// runCount runs req and returns the count of the response.
+func runCount(t *testing.T, client *Client, req *Request) int {
+	t.Helper()
+	var resp struct{ Count int }
+	if err := client.Run(context.Background(), req, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Count
+}
+
+func countResponse(n int32) string {
+	return `{"data":{"count":` + string(rune('0'+n)) + `}}`
+}
+
+func TestResponseCache(t *testing.T) {
+	srv, requests := cachedServer(countResponse)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithResponseCache(time.Minute))
+	if got := runCount(t, client, NewRequest("query { count }")); got != 1 {
+		t.Fatalf("got %d", got)
+	}
+	if got := runCount(t, client, NewRequest("query {\n  count # cached\n}")); got != 1 {
+		t.Errorf("got %d, want the cached response despite the formatting", got)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("got %d requests, want 1", requests.Load())
+	}
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	srv, requests := cachedServer(countResponse)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithResponseCache(time.Minute))
+	base := func() *Request { return NewRequest("query($id: ID) { count }") }
+	for _, req := range []func() *Request{
+		base,
+		func() *Request { r := base(); r.Var("id", "1"); return r },
+		func() *Request { r := base(); r.Header.Set("Authorization", "Bearer a"); return r },
+		func() *Request { r := base(); r.SetExtension("locale", "fr"); return r },
+		func() *Request { r := base(); r.SetExtension("locale", "de"); return r },
+	} {
+		runCount(t, client, req())
+		runCount(t, client, req())
+	}
+	if requests.Load() != 5 {
+		t.Errorf("got %d requests, want one per distinct request", requests.Load())
+	}
+}
+
+func TestResponseCacheKeyExtensionsOrder(t *testing.T) {
+	a, b := NewRequest("{ count }"), NewRequest("{ count }")
+	a.SetExtension("x", 1)
+	a.SetExtension("y", 2)
+	b.SetExtension("y", 2)
+	b.SetExtension("x", 1)
+	if cacheKey(a) != cacheKey(b) {
+		t.Error("the order extensions are set in changes the cache key")
+	}
+	b.SetExtension("x", 3)
+	if cacheKey(a) == cacheKey(b) {
+		t.Error("different extensions have the same cache key")
+	}
+}
+
+func TestResponseCacheSkips(t *testing.T) {
+	srv, requests := cachedServer(func(n int32) string {
+		if n == 1 {
+			return `{"data":{"count":1},"errors":[{"message":"partial"}]}`
+		}
+		return countResponse(n)
+	})
+	defer srv.Close()
+	client := NewClient(srv.URL, WithResponseCache(time.Minute))
+	if err := client.Run(context.Background(), NewRequest("{ count }"), nil); err == nil {
+		t.Fatal("expected the GraphQL error")
+	}
+	runCount(t, client, NewRequest("{ count }"))
+	for i := 0; i < 2; i++ {
+		runCount(t, client, NewRequest("mutation { count }"))
+		req := NewRequest("query { other: count }")
+		req.SetCacheTTL(0)
+		runCount(t, client, req)
+	}
+	if requests.Load() != 6 {
+		t.Errorf("got %d requests, want errors, mutations and disabled TTLs not cached", requests.Load())
+	}
+}
+
+func TestResponseCachePingAndPoll(t *testing.T) {
+	srv, requests := cachedServer(func(n int32) string {
+		return `{"data":{"__typename":"Query","count":` + string(rune('0'+n)) + `}}`
+	})
+	defer srv.Close()
+	client := NewClient(srv.URL, WithResponseCache(time.Minute), WithClock(&recordingClock{}))
+	for i := 0; i < 2; i++ {
+		if _, err := client.Ping(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stop := errors.New("stop")
+	polls := 0
+	err := client.Poll(context.Background(), NewRequest("{ count }"), time.Second, func(data json.RawMessage, err error) error {
+		if polls++; polls == 2 {
+			return stop
+		}
+		return err
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("got %v", err)
+	}
+	if requests.Load() != 4 {
+		t.Errorf("got %d requests, want Ping and Poll to bypass the cache", requests.Load())
+	}
+}
+
+func TestResponseCacheTTL(t *testing.T) {
+	srv, requests := cachedServer(countResponse)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithResponseCache(time.Minute))
+	req := func() *Request {
+		r := NewRequest("{ count }")
+		r.SetCacheTTL(time.Millisecond)
+		return r
+	}
+	runCount(t, client, req())
+	time.Sleep(5 * time.Millisecond)
+	if got := runCount(t, client, req()); got != 2 || requests.Load() != 2 {
+		t.Errorf("got %d after %d requests, want the expired response fetched again", got, requests.Load())
+	}
+}
+
+// failingCache is a Cache whose every call fails.
+type failingCache struct{}
+
+var errCacheDown = errors.New("cache down")
+
+func (failingCache) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errCacheDown
+}
+
+func (failingCache) Set(context.Context, string, []byte, time.Duration) error { return errCacheDown }
+func (failingCache) Delete(context.Context, string) error                     { return errCacheDown }
+
+func TestResponseCacheBackendErrors(t *testing.T) {
+	srv, _ := cachedServer(countResponse)
+	defer srv.Close()
+	var reported []string
+	client := NewClient(srv.URL, WithResponseCache(time.Minute), WithCacheBackend(failingCache{}), WithErrorHook(func(ctx context.Context, err error) {
+		reported = append(reported, err.Error())
+	}))
+	if got := runCount(t, client, NewRequest("{ count }")); got != 1 {
+		t.Errorf("got %d, want the response despite the cache", got)
+	}
+	if got := strings.Join(reported, "; "); got != "cache get: cache down; cache set: cache down" {
+		t.Errorf("got errors %q", got)
+	}
+}
+
+func TestCacheBackendShared(t *testing.T) {
+	srv, requests := cachedServer(countResponse)
+	defer srv.Close()
+	backend := newMapCache()
+	for i := 0; i < 2; i++ {
+		client := NewClient(srv.URL, WithResponseCache(time.Minute), WithCacheBackend(backend))
+		if got := runCount(t, client, NewRequest("{ count }")); got != 1 {
+			t.Errorf("client %d: got %d, want the response cached by the first", i, got)
+		}
+	}
+	if requests.Load() != 1 || backend.len() != 1 {
+		t.Errorf("got %d requests and %d entries, want the clients to share the backend", requests.Load(), backend.len())
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	ctx := context.Background()
+	var removed []string
+	cache := NewLRUCache(2)
+	cache.onRemove = func(key string) { removed = append(removed, key) }
+	cache.Set(ctx, "a", []byte("1"), time.Minute)
+	cache.Set(ctx, "b", []byte("2"), time.Minute)
+	cache.Get(ctx, "a")
+	cache.Set(ctx, "c", []byte("3"), time.Minute)
+	if _, ok, _ := cache.Get(ctx, "b"); ok {
+		t.Error("least recently used entry not evicted")
+	}
+	if v, ok, _ := cache.Get(ctx, "a"); !ok || string(v) != "1" {
+		t.Errorf("got %q, %v, want the recently used entry kept", v, ok)
+	}
+	cache.Set(ctx, "d", []byte("4"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok, _ := cache.Get(ctx, "d"); ok {
+		t.Error("expired entry returned")
+	}
+	cache.Delete(ctx, "a")
+	if got := strings.Join(removed, ","); got != "b,c,d,a" {
+		t.Errorf("got removals %q, want b,c,d,a", got)
+	}
+}
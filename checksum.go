@@ -0,0 +1,77 @@
+package graphql
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// ChecksumAlgorithm is a digest algorithm for upload checksums, named as
+// in the HTTP Digest Algorithm Values registry (RFC 9530).
+type ChecksumAlgorithm string
+
+// Supported checksum algorithms.
+const (
+	ChecksumSHA256 ChecksumAlgorithm = "sha-256"
+	ChecksumCRC32C ChecksumAlgorithm = "crc32c"
+)
+
+// WithChecksum sends a digest of the file so the server can verify the
+// upload end to end. The digest is formatted as a Content-Digest value
+// (RFC 9530), for example "sha-256=:<base64>:".
+// When the file's reader implements io.Seeker the digest is computed
+// before the upload and sent as the Content-Digest header of the file
+// part. Otherwise it is computed while the file is streamed and sent in
+// a form field named after the file part followed by ".digest", such as
+// "0.digest", right after the file part.
+func WithChecksum(algorithm ChecksumAlgorithm) FileOption {
+	return func(f *File) {
+		f.Checksum = algorithm
+	}
+}
+
+func (a ChecksumAlgorithm) newHash() (hash.Hash, error) {
+	switch a {
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	}
+	return nil, fmt.Errorf("graphql: unsupported checksum algorithm %q", string(a))
+}
+
+// digestValue formats sum as a Content-Digest value.
+func (a ChecksumAlgorithm) digestValue(sum []byte) string {
+	return string(a) + "=:" + base64.StdEncoding.EncodeToString(sum) + ":"
+}
+
+// precomputeDigest computes the digest of a seekable file and rewinds it.
+// Files that can't be rewound are left to be hashed while streaming.
+func (f *File) precomputeDigest() error {
+	if f.Checksum == "" {
+		return nil
+	}
+	h, err := f.Checksum.newHash()
+	if err != nil {
+		return err
+	}
+	seeker, ok := f.R.(io.Seeker)
+	if !ok {
+		return nil
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+	if _, err := io.Copy(h, f.R); err != nil {
+		return fmt.Errorf("checksum file %q: %w", f.Name, err)
+	}
+	if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("rewind file %q: %w", f.Name, err)
+	}
+	f.digest = f.Checksum.digestValue(h.Sum(nil))
+	return nil
+}
@@ -0,0 +1,45 @@
+package graphql
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestUploadChecksum(t *testing.T) {
+	var parts []uploadPart
+	srv := uploadServer(t, &parts)
+	defer srv.Close()
+	sum := sha256.Sum256([]byte("hello"))
+	want := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	err := runUpload(t, NewClient(srv.URL, UseMultipartForm()), "mutation($a: Upload!, $b: Upload!) { upload(a: $a, b: $b) }", func(req *Request) {
+		req.File("a", "a.txt", strings.NewReader("hello"), WithChecksum(ChecksumSHA256))
+		req.File("b", "b.txt", struct{ io.Reader }{strings.NewReader("hello")}, WithChecksum(ChecksumSHA256))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 5 {
+		t.Fatalf("got %d parts", len(parts))
+	}
+	if got := parts[2].header.Get("Content-Digest"); got != want {
+		t.Errorf("got Content-Digest %q for the seekable file, want %q", got, want)
+	}
+	if parts[3].header.Get("Content-Digest") != "" || parts[4].name != "1.digest" || parts[4].body != want {
+		t.Errorf("got %+v after the streamed file, want its digest in a field", parts[4])
+	}
+}
+
+func TestUploadChecksumAlgorithm(t *testing.T) {
+	var parts []uploadPart
+	srv := uploadServer(t, &parts)
+	defer srv.Close()
+	err := runUpload(t, NewClient(srv.URL, UseMultipartForm()), "mutation($a: Upload!) { upload(a: $a) }", func(req *Request) {
+		req.File("a", "a.txt", strings.NewReader("hello"), WithChecksum("md5"))
+	})
+	if err == nil || !strings.Contains(err.Error(), `unsupported checksum algorithm "md5"`) {
+		t.Errorf("got %v", err)
+	}
+}
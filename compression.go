@@ -0,0 +1,43 @@
+package graphql
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+)
+
+// WithRequestCompression gzips request bodies that are at least minSize
+// bytes long and marks them with Content-Encoding: gzip.
+// Smaller bodies are sent uncompressed since the gzip overhead would
+// outweigh the savings. Multipart bodies are streamed, so their size is
+// not known in advance and they are always compressed when this option
+// is set.
+func WithRequestCompression(minSize int) ClientOption {
+	return func(client *Client) {
+		client.compressRequests = true
+		client.compressMinSize = minSize
+	}
+}
+
+// compressBody returns the gzipped body when compression is enabled and
+// the body reaches the configured threshold. The returned bool reports
+// whether the body was compressed.
+func (c *Client) compressBody(ctx context.Context, body []byte) ([]byte, bool, error) {
+	if !c.compressRequests || len(body) < c.compressMinSize {
+		return body, false, nil
+	}
+	compressed := getBuffer()
+	defer putBuffer(compressed)
+	zw := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(zw)
+	zw.Reset(compressed)
+	if _, err := zw.Write(body); err != nil {
+		return nil, false, fmt.Errorf("compress body: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, false, fmt.Errorf("compress body: %w", err)
+	}
+	c.logDebugw(ctx, ">> compressed body", "bytes", len(body), "compressed_bytes", compressed.Len())
+	return bytes.Clone(compressed.Bytes()), true, nil
+}
@@ -0,0 +1,47 @@
+package graphql
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestCompression(t *testing.T) {
+	type sent struct {
+		encoding, query string
+	}
+	var requests []sent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			body = zr
+		}
+		var req struct{ Query string }
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		requests = append(requests, sent{r.Header.Get("Content-Encoding"), req.Query})
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, WithRequestCompression(1024))
+	large := "{ " + strings.Repeat("field ", 200) + "}"
+	for _, q := range []string{"{ a }", large} {
+		if err := client.Run(context.Background(), NewRequest(q), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(requests) != 2 || requests[0] != (sent{"", "{ a }"}) || requests[1] != (sent{"gzip", large}) {
+		t.Errorf("got %+v, want only the large body compressed", requests)
+	}
+}
@@ -0,0 +1,257 @@
+package graphql
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AdaptiveConcurrency configures the adaptive concurrency limiter, see
+// WithAdaptiveConcurrency.
+type AdaptiveConcurrency struct {
+	// InitialLimit is the number of requests allowed in flight at start.
+	InitialLimit int
+	// MinLimit and MaxLimit bound the limit.
+	MinLimit int
+	MaxLimit int
+	// Tolerance is the ratio of a request latency to the lowest latency
+	// observed above which the server is deemed overloaded.
+	Tolerance float64
+	// Backoff is the factor the limit is multiplied with on overload.
+	Backoff float64
+}
+
+// DefaultAdaptiveConcurrency is a reasonable configuration for
+// WithAdaptiveConcurrency.
+var DefaultAdaptiveConcurrency = AdaptiveConcurrency{
+	InitialLimit: 10,
+	MinLimit:     1,
+	MaxLimit:     100,
+	Tolerance:    2,
+	Backoff:      0.9,
+}
+
+// WithAdaptiveConcurrency limits the number of requests in flight with a
+// limit adjusted from the observed latencies and responses: it grows by
+// one per limit successful requests and is multiplied by Backoff when a
+// request takes longer than Tolerance times the lowest latency seen, fails,
+// or is answered with 429 or 503. Requests above the limit wait for a slot,
+// which a request holds until its response body is read or closed.
+// Zero fields take their value from DefaultAdaptiveConcurrency.
+func WithAdaptiveConcurrency(config AdaptiveConcurrency) ClientOption {
+	return func(client *Client) {
+		client.adaptiveConcurrency = &config
+	}
+}
+
+// latencyProbeSamples is the number of samples after which the lowest
+// latency is measured anew, so it follows lasting changes of the server.
+const latencyProbeSamples = 500
+
+// semaphore admits up to limit holders in FIFO order; the limit may be
+// changed while held.
+type semaphore struct {
+	mu       sync.Mutex
+	limit    int
+	inflight int
+	waiters  list.List
+}
+
+func newSemaphore(limit int) *semaphore {
+	return &semaphore{limit: limit}
+}
+
+// tryAcquire takes a slot if one is free without waiting.
+func (s *semaphore) tryAcquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inflight < s.limit && s.waiters.Len() == 0 {
+		s.inflight++
+		return true
+	}
+	return false
+}
+
+// acquire takes a slot, waiting until one is free or ctx is done.
+func (s *semaphore) acquire(ctx context.Context) error {
+	s.mu.Lock()
+	if s.inflight < s.limit && s.waiters.Len() == 0 {
+		s.inflight++
+		s.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	elem := s.waiters.PushBack(ready)
+	s.mu.Unlock()
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-ready:
+			// Granted while giving up, hand the slot on.
+			s.mu.Unlock()
+			s.release()
+		default:
+			s.waiters.Remove(elem)
+			s.mu.Unlock()
+		}
+		return ctx.Err()
+	}
+}
+
+// release frees a slot taken by acquire.
+func (s *semaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inflight--
+	s.grant()
+}
+
+// setLimit changes the number of slots.
+func (s *semaphore) setLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+	s.grant()
+}
+
+// grant hands free slots to waiters. s.mu must be held.
+func (s *semaphore) grant() {
+	for s.inflight < s.limit && s.waiters.Len() > 0 {
+		ready := s.waiters.Remove(s.waiters.Front()).(chan struct{})
+		s.inflight++
+		close(ready)
+	}
+}
+
+// adaptiveTransport limits the requests in flight to an AIMD adjusted
+// limit.
+type adaptiveTransport struct {
+	transport http.RoundTripper
+	config    AdaptiveConcurrency
+	slots     *semaphore
+	logger    logFunc
+
+	mu         sync.Mutex
+	limit      float64
+	minLatency time.Duration
+	samples    int
+}
+
+func newAdaptiveTransport(transport http.RoundTripper, config AdaptiveConcurrency, logger logFunc) *adaptiveTransport {
+	if config.InitialLimit <= 0 {
+		config.InitialLimit = DefaultAdaptiveConcurrency.InitialLimit
+	}
+	if config.MinLimit <= 0 {
+		config.MinLimit = DefaultAdaptiveConcurrency.MinLimit
+	}
+	if config.MaxLimit <= 0 {
+		config.MaxLimit = DefaultAdaptiveConcurrency.MaxLimit
+	}
+	if config.MaxLimit < config.MinLimit {
+		config.MaxLimit = config.MinLimit
+	}
+	if config.Tolerance <= 1 {
+		config.Tolerance = DefaultAdaptiveConcurrency.Tolerance
+	}
+	if config.Backoff <= 0 || config.Backoff >= 1 {
+		config.Backoff = DefaultAdaptiveConcurrency.Backoff
+	}
+	limit := math.Min(math.Max(float64(config.InitialLimit), float64(config.MinLimit)), float64(config.MaxLimit))
+	return &adaptiveTransport{
+		transport: transport,
+		config:    config,
+		slots:     newSemaphore(int(limit)),
+		logger:    logger,
+		limit:     limit,
+	}
+}
+
+// observe adjusts the limit to the outcome of a request.
+func (t *adaptiveTransport) observe(latency time.Duration, overloaded bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples++
+	if t.minLatency == 0 || latency < t.minLatency || t.samples > latencyProbeSamples {
+		t.minLatency = latency
+		t.samples = 0
+	}
+	if !overloaded && float64(latency) > float64(t.minLatency)*t.config.Tolerance {
+		overloaded = true
+	}
+	previous := int(t.limit)
+	if overloaded {
+		t.limit = math.Max(t.limit*t.config.Backoff, float64(t.config.MinLimit))
+	} else {
+		t.limit = math.Min(t.limit+1/t.limit, float64(t.config.MaxLimit))
+	}
+	if limit := int(t.limit); limit != previous {
+		if limit < previous {
+			t.logger("overload detected, lowering concurrency limit", "limit", limit)
+		}
+		t.slots.setLimit(limit)
+	}
+}
+
+func (t *adaptiveTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.slots.acquire(req.Context()); err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		t.slots.release()
+		if req.Context().Err() == nil {
+			t.observe(time.Since(start), true)
+		}
+		return nil, err
+	}
+	overloaded := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+	finish := func() {
+		t.slots.release()
+		if req.Context().Err() == nil {
+			t.observe(time.Since(start), overloaded)
+		}
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		// An event stream lasts as long as its subscription, only its
+		// headers tell about the load of the server.
+		finish()
+		return resp, nil
+	}
+	resp.Body = &adaptiveBody{ReadCloser: resp.Body, finish: finish}
+	return resp, nil
+}
+
+// adaptiveBody holds the slot of a request until its response body is
+// read to the end or closed, so that the latency covers the whole
+// response.
+type adaptiveBody struct {
+	io.ReadCloser
+	once   sync.Once
+	finish func()
+}
+
+func (b *adaptiveBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.finish)
+	}
+	return n, err
+}
+
+func (b *adaptiveBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.finish)
+	return err
+}
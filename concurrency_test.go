@@ -0,0 +1,107 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowReader returns its text after a delay.
+type slowReader struct {
+	delay time.Duration
+	r     io.Reader
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	return s.r.Read(p)
+}
+
+// singleSlot returns an adaptive transport allowing one request at a time,
+// answering with responses made by respond.
+func singleSlot(respond func() *http.Response) *adaptiveTransport {
+	return newAdaptiveTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return respond(), nil
+	}), AdaptiveConcurrency{InitialLimit: 1, MaxLimit: 1}, noLog)
+}
+
+// blocked reports whether a request through t waits for a slot.
+func blocked(t *adaptiveTransport) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://example.com", nil)
+	resp, err := t.RoundTrip(r)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+func TestAdaptiveConcurrencyHoldsSlotUntilBodyClosed(t *testing.T) {
+	transport := singleSlot(func() *http.Response { return response(http.StatusOK) })
+	resp, err := transport.RoundTrip(newRequest("query"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !blocked(transport) {
+		t.Fatal("slot released before the body was closed")
+	}
+	resp.Body.Close()
+	resp.Body.Close()
+	if blocked(transport) {
+		t.Fatal("slot not released after the body was closed")
+	}
+	if transport.slots.inflight != 0 {
+		t.Errorf("got %d requests in flight, want the slot released once", transport.slots.inflight)
+	}
+}
+
+func TestAdaptiveConcurrencyReleasesSlotAtEOF(t *testing.T) {
+	transport := singleSlot(func() *http.Response { return response(http.StatusOK) })
+	resp, err := transport.RoundTrip(newRequest("query"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	if blocked(transport) {
+		t.Fatal("slot not released after the body was read")
+	}
+}
+
+func TestAdaptiveConcurrencySamplesWholeResponse(t *testing.T) {
+	transport := singleSlot(func() *http.Response {
+		resp := response(http.StatusOK)
+		resp.Body = io.NopCloser(&slowReader{delay: 20 * time.Millisecond, r: strings.NewReader("{}")})
+		return resp
+	})
+	resp, err := transport.RoundTrip(newRequest("query"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if transport.minLatency < 20*time.Millisecond {
+		t.Errorf("got latency %s, want the time to read the body counted", transport.minLatency)
+	}
+}
+
+func TestAdaptiveConcurrencyEventStream(t *testing.T) {
+	transport := singleSlot(func() *http.Response {
+		resp := response(http.StatusOK)
+		resp.Header.Set("Content-Type", "text/event-stream")
+		return resp
+	})
+	resp, err := transport.RoundTrip(newRequest("query"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if blocked(transport) {
+		t.Fatal("event stream holds its slot")
+	}
+}
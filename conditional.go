@@ -0,0 +1,92 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// conditionalTTL is how long the validators and body of a response are
+// kept for conditional requests.
+const conditionalTTL = 24 * time.Hour
+
+// WithConditionalRequests remembers the ETag and Last-Modified headers of
+// query responses along with their body, and sends them back in
+// If-None-Match and If-Modified-Since headers when the same query is
+// made again, as identified for WithResponseCache. A 304 Not Modified
+// response is then decoded from the remembered body, saving the
+// bandwidth of unchanged results, typically of queries sent with GET
+// through a CDN. The bodies are kept in the backend given with
+// WithCacheBackend, if any, or in memory.
+func WithConditionalRequests() ClientOption {
+	return func(client *Client) {
+		client.conditional = &conditionalCache{}
+	}
+}
+
+// conditionalCache holds the validators and bodies of responses.
+type conditionalCache struct {
+	store Cache
+}
+
+// validatedResponse is a response remembered for conditional requests.
+type validatedResponse struct {
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"lastModified,omitempty"`
+	Body         json.RawMessage `json:"body"`
+}
+
+// conditionalKey returns the key of the response to req in the store.
+func conditionalKey(req *Request) string {
+	return "etag:" + cacheKey(req)
+}
+
+// executeConditional sends r, the HTTP request of req, with the
+// validators of the last response to req, and decodes the response, or
+// the remembered one if it wasn't modified, into resp.
+func (c *Client) executeConditional(ctx context.Context, req *Request, r *http.Request, resp interface{}) error {
+	key := conditionalKey(req)
+	var last *validatedResponse
+	if b, ok, err := c.conditional.store.Get(ctx, key); err != nil {
+		c.reportError(ctx, fmt.Errorf("cache get: %w", err))
+	} else if ok {
+		last = &validatedResponse{}
+		if err := json.Unmarshal(b, last); err != nil {
+			last = nil
+		}
+	}
+	if last != nil {
+		if last.ETag != "" {
+			r.Header.Set("If-None-Match", last.ETag)
+		}
+		if last.LastModified != "" {
+			r.Header.Set("If-Modified-Since", last.LastModified)
+		}
+	}
+	r = r.WithContext(ctx)
+	buf, header, status, err := c.doRequestHeader(r)
+	if err != nil {
+		return err
+	}
+	defer putBuffer(buf)
+	switch {
+	case status == http.StatusNotModified && last != nil:
+		c.logDebugw(ctx, "<< not modified", "operation", req.OperationName())
+		return c.decodeResponse(ctx, bytes.NewBuffer(last.Body), http.StatusOK, resp)
+	case status == http.StatusOK && (header.Get("ETag") != "" || header.Get("Last-Modified") != ""):
+		b, err := json.Marshal(validatedResponse{
+			ETag:         header.Get("ETag"),
+			LastModified: header.Get("Last-Modified"),
+			Body:         buf.Bytes(),
+		})
+		if err == nil {
+			if err := c.conditional.store.Set(ctx, key, b, conditionalTTL); err != nil {
+				c.reportError(ctx, fmt.Errorf("cache set: %w", err))
+			}
+		}
+	}
+	return c.decodeResponse(ctx, buf, status, resp)
+}
@@ -0,0 +1,32 @@
+package graphql
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	var validators []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		validators = append(validators, r.Header.Get("If-None-Match")+"|"+r.Header.Get("If-Modified-Since"))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 12 Oct 2026 10:00:00 GMT")
+		io.WriteString(w, `{"data":{"count":1}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, UseGETForQueries(0), WithConditionalRequests())
+	for i := 0; i < 2; i++ {
+		if got := runCount(t, client, NewRequest("{ count }")); got != 1 {
+			t.Errorf("run %d: got %d, want the remembered response", i, got)
+		}
+	}
+	if len(validators) != 2 || validators[0] != "|" || validators[1] != `"v1"|Mon, 12 Oct 2026 10:00:00 GMT` {
+		t.Errorf("got validators %q, want those of the first response sent again", validators)
+	}
+}
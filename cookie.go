@@ -0,0 +1,36 @@
+package graphql
+
+import "net/http"
+
+// WithCookieJar stores the cookies set by the server in jar and sends them
+// back with later requests, for servers relying on session or CSRF
+// cookies. Cookies are applied to every attempt, so one set by a response
+// being retried is sent with the retry.
+func WithCookieJar(jar http.CookieJar) ClientOption {
+	return func(client *Client) {
+		client.cookieJar = jar
+	}
+}
+
+// cookieTransport applies a cookie jar to every request it sends.
+type cookieTransport struct {
+	transport http.RoundTripper
+	jar       http.CookieJar
+}
+
+func (t *cookieTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if cookies := t.jar.Cookies(req.URL); len(cookies) > 0 {
+		req = req.Clone(req.Context())
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+	}
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if cookies := resp.Cookies(); len(cookies) > 0 {
+		t.jar.SetCookies(req.URL, cookies)
+	}
+	return resp, nil
+}
@@ -0,0 +1,36 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCookieJar(t *testing.T) {
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, _ := r.Cookie("session")
+		if cookie == nil {
+			sent = append(sent, "")
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1"})
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		sent = append(sent, cookie.Value)
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	jar, _ := cookiejar.New(nil)
+	client := NewClient(srv.URL, WithCookieJar(jar), WithClock(&recordingClock{}))
+	for i := 0; i < 2; i++ {
+		if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sent) != 3 || sent[0] != "" || sent[1] != "s1" || sent[2] != "s1" {
+		t.Errorf("got cookies %q, want the one set by the retried response sent with the retry and later", sent)
+	}
+}
@@ -0,0 +1,90 @@
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// redactedHeaders are headers whose values are replaced by CurlString.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"X-Api-Key":           true,
+}
+
+// CurlString renders the request as an equivalent curl command against
+// endpoint, as it would be sent by a Client using the default JSON wire
+// format (or multipart if the request has files).
+// Values of credential headers such as Authorization are redacted so the
+// output can be pasted into bug reports.
+func (req *Request) CurlString(endpoint string) string {
+	var b strings.Builder
+	b.WriteString("curl -X POST ")
+	b.WriteString(shellQuote(endpoint))
+	header := http.Header{}
+	header.Set("Accept", "application/json; charset=utf-8")
+	files := req.uploadFiles()
+	if len(files) == 0 {
+		header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	for key, values := range req.Header {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			if redactedHeaders[http.CanonicalHeaderKey(key)] {
+				value = "REDACTED"
+			}
+			b.WriteString(" \\\n  -H ")
+			b.WriteString(shellQuote(key + ": " + value))
+		}
+	}
+	env := requestEnvelope{
+		Query:         req.q,
+		OperationName: req.opName,
+		Variables:     req.vars,
+		Extensions:    req.extensions,
+	}
+	if len(files) == 0 {
+		body, err := json.Marshal(env)
+		if err != nil {
+			b.WriteString(" \\\n  # could not encode variables: ")
+			b.WriteString(err.Error())
+			return b.String()
+		}
+		b.WriteString(" \\\n  --data-raw ")
+		b.WriteString(shellQuote(string(body)))
+		return b.String()
+	}
+	operations, fileMap, err := multipartOperations(env, files)
+	if err != nil {
+		b.WriteString(" \\\n  # ")
+		b.WriteString(err.Error())
+		return b.String()
+	}
+	b.WriteString(" \\\n  -F ")
+	b.WriteString(shellQuote("operations=" + string(operations)))
+	b.WriteString(" \\\n  -F ")
+	b.WriteString(shellQuote("map=" + string(fileMap)))
+	for i, f := range files {
+		b.WriteString(" \\\n  -F ")
+		b.WriteString(shellQuote(strconv.Itoa(i) + "=@" + f.Name))
+	}
+	return b.String()
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,40 @@
+package graphql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCurlString(t *testing.T) {
+	req := NewRequest("query { user(name: $n) { id } }")
+	req.Var("n", "O'Brien")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Trace", "1")
+	want := `curl -X POST 'http://example.com/graphql' \
+  -H 'Accept: application/json; charset=utf-8' \
+  -H 'Authorization: REDACTED' \
+  -H 'Content-Type: application/json; charset=utf-8' \
+  -H 'X-Trace: 1' \
+  --data-raw '{"query":"query { user(name: $n) { id } }","variables":{"n":"O'\''Brien"}}'`
+	if got := req.CurlString("http://example.com/graphql"); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCurlStringFiles(t *testing.T) {
+	req := NewRequest("mutation ($f: Upload!) { upload(file: $f) }")
+	req.File("f", "a.txt", strings.NewReader("x"))
+	got := req.CurlString("http://example.com/graphql")
+	for _, part := range []string{
+		`-F 'operations={"query":"mutation ($f: Upload!) { upload(file: $f) }","variables":{"f":null}}'`,
+		`-F 'map={"0":["variables.f"]}'`,
+		`-F '0=@a.txt'`,
+	} {
+		if !strings.Contains(got, part) {
+			t.Errorf("got\n%s\nwant it to contain %s", got, part)
+		}
+	}
+	if strings.Contains(got, "Content-Type") {
+		t.Errorf("got\n%s\nwant curl to set the multipart Content-Type", got)
+	}
+}
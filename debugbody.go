@@ -0,0 +1,70 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+)
+
+// WithDebugBodyLimit cuts the queries, variables and bodies written to the
+// debug log to their first n bytes, noting how many were left out. By
+// default they are logged in full.
+func WithDebugBodyLimit(n int) ClientOption {
+	return func(client *Client) {
+		client.debugBodyLimit = n
+	}
+}
+
+// WithDebugBodySummary logs only the operation name and the sizes of the
+// queries, variables and bodies in the debug log, keeping their content,
+// and any personal data in it, out of the logs.
+func WithDebugBodySummary() ClientOption {
+	return func(client *Client) {
+		client.debugBodySummary = true
+	}
+}
+
+// WithDebugSampling logs the debug messages of only a share rate of the
+// Run and RunStream calls, chosen at random, e.g. 0.01 for 1%, so debug
+// logging can stay on under high load. Either all the messages of a call
+// are logged or none.
+func WithDebugSampling(rate float64) ClientOption {
+	return func(client *Client) {
+		client.debugSampleRate = rate
+	}
+}
+
+// debugBody returns b as it is written to the debug log. It is formatted
+// only if the message is logged, sparing a copy of every response body
+// when debug logging is off.
+func (c *Client) debugBody(b []byte) debugText[[]byte] {
+	return debugText[[]byte]{client: c, text: b}
+}
+
+// debugText formats a body as it is written to the debug log.
+type debugText[T string | []byte] struct {
+	client *Client
+	text   T
+}
+
+func (t debugText[T]) String() string {
+	if t.client.debugBodySummary {
+		return fmt.Sprintf("%d bytes", len(t.text))
+	}
+	if limit := t.client.debugBodyLimit; limit > 0 && len(t.text) > limit {
+		return fmt.Sprintf("%s... (%d more bytes)", t.text[:limit], len(t.text)-limit)
+	}
+	return string(t.text)
+}
+
+// logDebugRequest logs the query and variables of req.
+func (c *Client) logDebugRequest(ctx context.Context, req *Request) {
+	if !c.debugOn(ctx) {
+		return
+	}
+	vars := fmt.Sprint(req.vars)
+	if c.debugBodySummary {
+		c.logDebugw(ctx, ">> request", "operation", req.OperationName(), "query_bytes", len(req.q), "variables_bytes", len(vars))
+		return
+	}
+	c.logDebugw(ctx, ">> request", "operation", req.OperationName(), "variables", debugText[string]{client: c, text: vars}, "query", debugText[string]{client: c, text: req.q})
+}
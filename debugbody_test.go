@@ -0,0 +1,80 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// emptyDataServer answers every request with empty data.
+func emptyDataServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{}}`))
+	}))
+}
+
+func TestDebugBodyLimit(t *testing.T) {
+	srv := emptyDataServer()
+	defer srv.Close()
+	logger := &recordingLogger{}
+	client := NewClient(srv.URL, WithLeveledLogger(logger), WithDebugBodyLimit(5))
+	if err := client.Run(context.Background(), NewRequest("query Foo { a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	e, _ := logger.find(">> request")
+	if got := fmt.Sprint(e.fields["query"]); got != "query... (10 more bytes)" {
+		t.Errorf("got query %q, want it cut to 5 bytes", got)
+	}
+}
+
+func TestDebugBodySummaryMultipart(t *testing.T) {
+	srv := emptyDataServer()
+	defer srv.Close()
+	logger := &recordingLogger{}
+	client := NewClient(srv.URL, WithLeveledLogger(logger), WithDebugBodySummary(), UseMultipartForm())
+	req := NewRequest("mutation Upload($f: Upload!) { upload(file: $f) }")
+	req.File("f", "secret.txt", strings.NewReader("secret"))
+	if err := client.Run(context.Background(), req, nil); err != nil {
+		t.Fatal(err)
+	}
+	var logged []logEntry
+	for _, e := range logger.entries {
+		if e.msg == ">> multipart request" {
+			logged = append(logged, e)
+		}
+	}
+	if len(logged) != 1 || logged[0].fields["operations"] != nil || logged[0].fields["operation"] != "Upload" {
+		t.Errorf("got %+v, want the multipart request logged once without its body", logged)
+	}
+}
+
+func TestDebugSampling(t *testing.T) {
+	srv := emptyDataServer()
+	defer srv.Close()
+	for name, tt := range map[string]struct {
+		rate     float64
+		min, max int
+	}{
+		"none": {1e-9, 0, 0},
+		"half": {0.5, 1, 99},
+		"all":  {1, 100, 100},
+	} {
+		logger := &recordingLogger{}
+		client := NewClient(srv.URL, WithLeveledLogger(logger), WithDebugSampling(tt.rate))
+		for i := 0; i < 100; i++ {
+			if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		counts := map[string]int{}
+		for _, e := range logger.entries {
+			counts[e.msg]++
+		}
+		if n := counts[">> request"]; n < tt.min || n > tt.max || counts["<< response"] != n {
+			t.Errorf("%s: got %v, want all the messages of %d to %d calls", name, counts, tt.min, tt.max)
+		}
+	}
+}
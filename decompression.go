@@ -0,0 +1,117 @@
+package graphql
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Decoder returns a reader decompressing r, for a Content-Encoding.
+type Decoder func(r io.Reader) (io.ReadCloser, error)
+
+// WithResponseDecompression asks the server for compressed responses with
+// Accept-Encoding and decompresses them, also when the transport doesn't
+// do so itself, e.g. with DisableCompression set. gzip and deflate are
+// supported; more encodings, such as br, can be added with
+// WithContentDecoder.
+func WithResponseDecompression() ClientOption {
+	return func(client *Client) {
+		if client.decoders == nil {
+			client.decoders = defaultDecoders()
+		}
+	}
+}
+
+// WithContentDecoder adds the decoder of a Content-Encoding to the ones of
+// WithResponseDecompression, which it enables.
+func WithContentDecoder(encoding string, decoder Decoder) ClientOption {
+	return func(client *Client) {
+		if client.decoders == nil {
+			client.decoders = defaultDecoders()
+		}
+		client.decoders[strings.ToLower(encoding)] = decoder
+	}
+}
+
+func defaultDecoders() map[string]Decoder {
+	return map[string]Decoder{
+		"gzip": func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		"deflate": func(r io.Reader) (io.ReadCloser, error) {
+			return zlib.NewReader(r)
+		},
+	}
+}
+
+// decompressionTransport negotiates and decodes compressed responses.
+type decompressionTransport struct {
+	transport      http.RoundTripper
+	decoders       map[string]Decoder
+	acceptEncoding string
+}
+
+func newDecompressionTransport(transport http.RoundTripper, decoders map[string]Decoder) *decompressionTransport {
+	encodings := make([]string, 0, len(decoders))
+	for encoding := range decoders {
+		encodings = append(encodings, encoding)
+	}
+	sort.Strings(encodings)
+	return &decompressionTransport{
+		transport:      transport,
+		decoders:       decoders,
+		acceptEncoding: strings.Join(encodings, ", "),
+	}
+}
+
+func (t *decompressionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", t.acceptEncoding)
+	}
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	decoder, ok := t.decoders[encoding]
+	if !ok || req.Method == http.MethodHead || resp.StatusCode == http.StatusNoContent {
+		return resp, nil
+	}
+	body, err := decoder(resp.Body)
+	switch {
+	case errors.Is(err, io.EOF):
+		// An empty body, e.g. of an error status.
+		drainBody(resp)
+		resp.Body = http.NoBody
+	case err != nil:
+		drainBody(resp)
+		return nil, fmt.Errorf("decompress response: %w", err)
+	default:
+		resp.Body = &decodedBody{ReadCloser: body, raw: resp.Body}
+	}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// decodedBody closes both the decoder and the raw body it reads.
+type decodedBody struct {
+	io.ReadCloser
+	raw io.ReadCloser
+}
+
+func (b *decodedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if rawErr := b.raw.Close(); err == nil {
+		err = rawErr
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+package graphql
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// gzipServer answers with a gzipped body, recording the Accept-Encoding of
+// the requests.
+func gzipServer(accepted *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*accepted = append(*accepted, r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		io.WriteString(zw, `{"data":{"a":"unzipped"}}`)
+		zw.Close()
+	}))
+}
+
+func TestResponseDecompression(t *testing.T) {
+	var accepted []string
+	srv := gzipServer(&accepted)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithBaseTransport(&http.Transport{DisableCompression: true}),
+		WithContentDecoder("BR", func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil }))
+	var resp struct{ A string }
+	if err := client.Run(context.Background(), NewRequest("{ a }"), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.A != "unzipped" {
+		t.Errorf("got %q", resp.A)
+	}
+	if strings.Join(accepted, ";") != "br, deflate, gzip" {
+		t.Errorf("got Accept-Encoding %q", accepted)
+	}
+}
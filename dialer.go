@@ -0,0 +1,96 @@
+package graphql
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// dialFunc is the signature of http.Transport.DialContext.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// WithDialContext makes the default HTTP client open connections with
+// dial, e.g. a dialer with custom timeouts or a VPN aware one. Unix socket
+// endpoints, WithDNSCache and WithIPFamily still apply around it.
+func WithDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) ClientOption {
+	return func(client *Client) {
+		client.dialContext = dial
+	}
+}
+
+// IPFamily selects the IP versions the default HTTP client connects with.
+type IPFamily int
+
+const (
+	// IPAny connects over IPv4 or IPv6, racing both as in RFC 6555
+	// (Happy Eyeballs).
+	IPAny IPFamily = iota
+	// IPv4Only connects over IPv4 only.
+	IPv4Only
+	// IPv6Only connects over IPv6 only.
+	IPv6Only
+	// PreferIPv4 connects over IPv4, and over IPv6 only when it fails,
+	// for networks with broken IPv6.
+	PreferIPv4
+)
+
+// WithIPFamily restricts or orders the IP versions the default HTTP
+// client connects with.
+func WithIPFamily(family IPFamily) ClientOption {
+	return func(client *Client) {
+		client.ipFamily = family
+	}
+}
+
+// WithHappyEyeballs sets how long the default HTTP client waits for an
+// IPv6 connection before racing an IPv4 one, see net.Dialer.FallbackDelay.
+// A negative delay disables the race.
+func WithHappyEyeballs(fallbackDelay time.Duration) ClientOption {
+	return func(client *Client) {
+		client.fallbackDelay = fallbackDelay
+	}
+}
+
+// newDial returns the dial function of the default HTTP client.
+func (c *Client) newDial() dialFunc {
+	dial := dialFunc(c.dialContext)
+	if dial == nil {
+		dialer := &net.Dialer{Resolver: c.resolver, FallbackDelay: c.fallbackDelay}
+		dial = dialer.DialContext
+	}
+	dial = withIPFamily(dial, c.ipFamily)
+	if c.dnsCacheTTL > 0 {
+		cache := newDNSCache(c.resolver, c.dnsCacheTTL)
+		cache.preferIPv4 = c.ipFamily == PreferIPv4
+		dial = cache.dial(dial)
+	}
+	return dialUnix(dial)
+}
+
+// withIPFamily wraps dial to connect over the IP versions of family.
+func withIPFamily(dial dialFunc, family IPFamily) dialFunc {
+	if family == IPAny {
+		return dial
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if !strings.HasPrefix(network, "tcp") && !strings.HasPrefix(network, "udp") {
+			return dial(ctx, network, addr)
+		}
+		base := network[:3]
+		switch family {
+		case IPv4Only:
+			return dial(ctx, base+"4", addr)
+		case IPv6Only:
+			return dial(ctx, base+"6", addr)
+		}
+		conn, err := dial(ctx, base+"4", addr)
+		if err == nil || ctx.Err() != nil {
+			return conn, err
+		}
+		if conn, err6 := dial(ctx, base+"6", addr); err6 == nil {
+			return conn, nil
+		}
+		return nil, err
+	}
+}
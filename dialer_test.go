@@ -0,0 +1,46 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestIPFamily(t *testing.T) {
+	for family, want := range map[IPFamily]string{
+		IPAny:      "tcp",
+		IPv4Only:   "tcp4",
+		IPv6Only:   "tcp6",
+		PreferIPv4: "tcp4,tcp6",
+	} {
+		var networks []string
+		dial := withIPFamily(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			networks = append(networks, network)
+			return nil, errors.New("unreachable")
+		}, family)
+		dial(context.Background(), "tcp", "example.com:443")
+		if got := strings.Join(networks, ","); got != want {
+			t.Errorf("family %d: got %s, want %s", family, got, want)
+		}
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	srv, requests := countingServer(http.StatusOK)
+	defer srv.Close()
+	var dialed []string
+	var d net.Dialer
+	client := NewClient("http://graphql.example", WithDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return d.DialContext(ctx, network, strings.TrimPrefix(srv.URL, "http://"))
+	}))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 1 || strings.Join(dialed, ",") != "graphql.example:80" {
+		t.Errorf("got %d requests after dialing %q", requests.Load(), dialed)
+	}
+}
@@ -0,0 +1,128 @@
+package graphql
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WithResolver makes the default HTTP client resolve host names with r,
+// e.g. to use a specific DNS server.
+func WithResolver(r *net.Resolver) ClientOption {
+	return func(client *Client) {
+		client.resolver = r
+	}
+}
+
+// WithDNSCache makes the default HTTP client cache the addresses of host
+// names for ttl, so bursts of new connections don't each query DNS. New
+// connections go to the address that last accepted one, moving on to the
+// next addresses when dialing fails.
+func WithDNSCache(ttl time.Duration) ClientOption {
+	return func(client *Client) {
+		client.dnsCacheTTL = ttl
+	}
+}
+
+// dnsCache caches the addresses of host names.
+type dnsCache struct {
+	resolver *net.Resolver
+	ttl      time.Duration
+	// preferIPv4 orders IPv4 addresses first.
+	preferIPv4 bool
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+// dnsEntry holds the addresses of a host name.
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+	// preferred is the index of the address that last accepted a
+	// connection.
+	preferred int
+}
+
+func newDNSCache(resolver *net.Resolver, ttl time.Duration) *dnsCache {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &dnsCache{resolver: resolver, ttl: ttl, entries: make(map[string]*dnsEntry)}
+}
+
+// lookup returns the addresses of host, and the index of the one to try
+// first.
+func (d *dnsCache) lookup(ctx context.Context, host string) ([]string, int, error) {
+	d.mu.Lock()
+	if e, ok := d.entries[host]; ok && time.Now().Before(e.expires) {
+		d.mu.Unlock()
+		return e.addrs, e.preferred, nil
+	}
+	d.mu.Unlock()
+	addrs, err := d.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, 0, err
+	}
+	if d.preferIPv4 {
+		sort.SliceStable(addrs, func(i, j int) bool {
+			return isIPv4(addrs[i]) && !isIPv4(addrs[j])
+		})
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries[host] = &dnsEntry{addrs: addrs, expires: time.Now().Add(d.ttl)}
+	return addrs, 0, nil
+}
+
+// isIPv4 reports whether addr is an IPv4 address.
+func isIPv4(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.To4() != nil
+}
+
+// prefer records that the address at index i of host accepted a
+// connection.
+func (d *dnsCache) prefer(host string, addrs []string, i int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// The entry may have been renewed with other addresses meanwhile.
+	if e, ok := d.entries[host]; ok && len(e.addrs) == len(addrs) && e.addrs[i] == addrs[i] {
+		e.preferred = i
+	}
+}
+
+// dial wraps dial to connect to the cached addresses of host names.
+func (d *dnsCache) dial(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+		addrs, first, err := d.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return dial(ctx, network, addr)
+		}
+		var dialErr error
+		for n := range addrs {
+			i := (first + n) % len(addrs)
+			conn, err := dial(ctx, network, net.JoinHostPort(addrs[i], port))
+			if err == nil {
+				d.prefer(host, addrs, i)
+				return conn, nil
+			}
+			if dialErr == nil {
+				dialErr = err
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, dialErr
+	}
+}
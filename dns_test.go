@@ -0,0 +1,57 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDNSCacheDial(t *testing.T) {
+	cache := newDNSCache(nil, time.Minute)
+	cache.entries["api.example"] = &dnsEntry{addrs: []string{"10.0.0.1", "10.0.0.2"}, expires: time.Now().Add(time.Minute)}
+	var dialed []string
+	dial := cache.dial(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		if strings.HasPrefix(addr, "10.0.0.1:") {
+			return nil, errors.New("connection refused")
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	})
+	for i := 0; i < 2; i++ {
+		conn, err := dial(context.Background(), "tcp", "api.example:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+	if got := strings.Join(dialed, ","); got != "10.0.0.1:443,10.0.0.2:443,10.0.0.2:443" {
+		t.Errorf("got dials %s, want the address that accepted a connection tried first", got)
+	}
+}
+
+func TestDNSCacheLookup(t *testing.T) {
+	cache := newDNSCache(nil, time.Minute)
+	cache.preferIPv4 = true
+	addrs, _, err := cache.lookup(context.Background(), "localhost")
+	if err != nil {
+		t.Skip(err)
+	}
+	for i := 1; i < len(addrs); i++ {
+		if isIPv4(addrs[i]) && !isIPv4(addrs[i-1]) {
+			t.Errorf("got %q, want the IPv4 addresses first", addrs)
+		}
+	}
+	cache.entries["localhost"].addrs = []string{"192.0.2.1"}
+	if addrs, _, _ := cache.lookup(context.Background(), "localhost"); len(addrs) != 1 || addrs[0] != "192.0.2.1" {
+		t.Errorf("got %q, want the cached addresses", addrs)
+	}
+	cache.entries["localhost"].expires = time.Now()
+	if addrs, _, _ := cache.lookup(context.Background(), "localhost"); len(addrs) > 0 && addrs[0] == "192.0.2.1" {
+		t.Error("got the expired addresses")
+	}
+}
@@ -0,0 +1,137 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// RunStream executes the query like Run, but copies the response body to
+// w as it arrives instead of decoding it, for operations whose result is
+// a raw file-like payload such as a CSV export.
+// When the server answers with a JSON GraphQL response instead, the first
+// GraphQL error is returned, or the data is written to w as JSON.
+// It returns the number of bytes written to w. Once some were written, the
+// request isn't failed over to another endpoint, and a failure is
+// returned as a PartialWriteError.
+func (c *Client) RunStream(ctx context.Context, req *Request, w io.Writer) (int64, error) {
+	start := time.Now()
+	ctx, info := c.begin(ctx, req)
+	n, err := c.runStream(ctx, req, w)
+	c.finish(ctx, req, info, start, err)
+	return n, err
+}
+
+func (c *Client) runStream(ctx context.Context, req *Request, w io.Writer) (int64, error) {
+	ctx, cancel := req.context(ctx)
+	defer cancel()
+	release, err := c.enqueue(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	if ctx, err = c.idempotencyContext(ctx); err != nil {
+		return 0, err
+	}
+	var n int64
+	err = c.withEndpoints(ctx, req, func(endpoint string) error {
+		r, err := c.newHTTPRequest(ctx, req, endpoint)
+		if err != nil {
+			return err
+		}
+		ctx := c.mutationRetryContext(ctx, req, r)
+		ctx = c.hedgeContext(ctx, req)
+		n, err = c.stream(r.WithContext(ctx), w, true)
+		if err != nil && n > 0 {
+			return &PartialWriteError{Written: n, Err: err}
+		}
+		return err
+	})
+	return n, err
+}
+
+// PartialWriteError is returned by RunStream when the response failed
+// after part of it was written to w.
+type PartialWriteError struct {
+	// Written is the number of bytes written to w.
+	Written int64
+	Err     error
+}
+
+func (e *PartialWriteError) Error() string {
+	return fmt.Sprintf("graphql: response failed after %d bytes were written: %v", e.Written, e.Err)
+}
+
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
+
+// Download streams the resource at url to w without buffering it, for
+// operations whose result is a signed URL to fetch. The request is sent
+// through the client's HTTP client, but without the GraphQL request
+// headers, which signed URLs usually reject.
+// It returns the number of bytes written to w.
+func (c *Client) Download(ctx context.Context, url string, w io.Writer) (int64, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	r.Close = c.closeReq
+	c.logDebugw(ctx, ">> download", "url", url)
+	return c.stream(r, w, false)
+}
+
+// stream sends r and copies a successful response body to w. When
+// graphQL is set, JSON responses are treated as GraphQL responses.
+func (c *Client) stream(r *http.Request, w io.Writer, graphQL bool) (int64, error) {
+	res, err := c.httpClient.Do(r)
+	if err != nil {
+		c.logErrorw(r.Context(), ">> request failed", "host", r.URL.Host, "error", err)
+		return 0, err
+	}
+	defer func(Body io.ReadCloser) {
+		er := Body.Close()
+		if er != nil {
+			c.reportError(r.Context(), fmt.Errorf("close response body: %w", er))
+		}
+	}(res.Body)
+	if res.StatusCode != http.StatusOK {
+		c.logErrorw(r.Context(), "server returned a non-200 status code", "status", res.StatusCode)
+		return 0, &StatusError{StatusCode: res.StatusCode}
+	}
+	if graphQL && isJSON(res.Header.Get("Content-Type")) {
+		var gr struct {
+			Data   json.RawMessage
+			Errors []graphErr
+		}
+		if err := json.NewDecoder(res.Body).Decode(&gr); err != nil {
+			return 0, fmt.Errorf("decoding response: %w", err)
+		}
+		if len(gr.Errors) > 0 {
+			// return first error
+			return 0, gr.Errors[0]
+		}
+		return io.Copy(w, bytes.NewReader(gr.Data))
+	}
+	n, err := io.Copy(w, res.Body)
+	if err != nil {
+		return n, fmt.Errorf("reading body: %w", err)
+	}
+	c.logDebugw(r.Context(), "<< streamed", "bytes", n)
+	return n, nil
+}
+
+// isJSON reports whether contentType is a JSON media type, including
+// application/graphql-response+json.
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || mediaType == "application/graphql-response+json"
+}
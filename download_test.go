@@ -0,0 +1,77 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// truncatingServer sends part of a CSV body announced longer, then
+// drops the connection.
+func truncatingServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Type: text/csv\r\nContent-Length: 100\r\n\r\na,b\n1,2\n")
+		rw.Flush()
+	}))
+}
+
+// csvServer answers with a CSV body, counting the requests.
+func csvServer(requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		w.Header().Set("Content-Type", "text/csv")
+		io.WriteString(w, "a,b\n3,4\n")
+	}))
+}
+
+func TestRunStreamPartialWrite(t *testing.T) {
+	primary := truncatingServer(t)
+	defer primary.Close()
+	var requests int
+	fallback := csvServer(&requests)
+	defer fallback.Close()
+	client := NewClient(primary.URL, WithFallbackEndpoints(time.Minute, fallback.URL))
+	var w bytes.Buffer
+	n, err := client.RunStream(context.Background(), NewRequest("{ export }"), &w)
+	var partial *PartialWriteError
+	if !errors.As(err, &partial) || partial.Written != 8 || n != 8 {
+		t.Fatalf("got %d bytes, %v, want a PartialWriteError after 8 bytes", n, err)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, want the cause wrapped", err)
+	}
+	if requests != 0 {
+		t.Errorf("got %d requests to the fallback, want none after a partial write", requests)
+	}
+	if w.String() != "a,b\n1,2\n" {
+		t.Errorf("got %q written", w.String())
+	}
+}
+
+func TestRunStreamFailsOverBeforeWriting(t *testing.T) {
+	primary, _ := countingServer(http.StatusBadGateway)
+	defer primary.Close()
+	var requests int
+	fallback := csvServer(&requests)
+	defer fallback.Close()
+	client := NewClient(primary.URL, WithoutRetry(), WithFallbackEndpoints(time.Minute, fallback.URL))
+	var w bytes.Buffer
+	if _, err := client.RunStream(context.Background(), NewRequest("{ export }"), &w); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 || w.String() != "a,b\n3,4\n" {
+		t.Errorf("got %q from %d requests to the fallback", w.String(), requests)
+	}
+}
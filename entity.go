@@ -0,0 +1,480 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithNormalizedEntities keeps the objects found in the responses of the
+// client that have a __typename and an id, known as entities, normalized
+// by their EntityKey: the fields of an entity returned by several
+// operations are merged, under their response names, so that
+// Client.Entity reads what any query or mutation fetched of it. A query
+// is answered from the entities, without a request, when each of its root
+// fields was seen returning an entity, with the same arguments, endpoint
+// and headers, that has all the fields it selects: once
+// user(id: 1) { __typename id name email } was fetched,
+// user(id: 1) { name } is answered from User:1. Queries selecting fields
+// with arguments below the root fields, directives, or fragments whose
+// type condition isn't the __typename of the object are always sent.
+// Entities are kept for ttl after they were last seen, up to 10000 of
+// them. When a mutation returns an entity, the cached responses that
+// contain it are invalidated, and Client.InvalidateEntity and
+// WithInvalidationRules invalidate them explicitly; after any such
+// invalidation, queries are sent again before being answered from the
+// entities. A zero TTL set with Request.SetCacheTTL disables the answers
+// from the entities for a request. The entities are held in memory, even
+// with WithCacheBackend.
+func WithNormalizedEntities(ttl time.Duration) ClientOption {
+	return func(client *Client) {
+		client.entities = &entityCache{
+			ttl:       ttl,
+			store:     NewLRUCache(defaultCacheEntries),
+			roots:     NewLRUCache(defaultCacheEntries),
+			refs:      make(map[string]map[string]bool),
+			responses: make(map[string][]string),
+		}
+	}
+}
+
+// EntityKey returns the key an entity is normalized under, its type name
+// and id joined with a colon, such as "User:42".
+func EntityKey(typename, id string) string {
+	return typename + ":" + id
+}
+
+// entityCache holds the entities of the responses of a client.
+type entityCache struct {
+	ttl   time.Duration
+	store *LRUCache
+	// roots holds the key of the entity each root field of a query, with
+	// its arguments, endpoint and headers, returned, along with the
+	// generation it was seen in. The generation is incremented by each
+	// invalidation, which makes the older root fields be fetched again.
+	roots      *LRUCache
+	generation atomic.Uint64
+
+	mu sync.Mutex
+	// refs holds the keys of the cached responses containing each
+	// entity, and responses the keys of the entities of each cached
+	// response, until it leaves the cache.
+	refs      map[string]map[string]bool
+	responses map[string][]string
+}
+
+// Entity decodes into v the fields of the entity with key that the
+// responses of a client created with WithNormalizedEntities returned, and
+// reports whether it is known.
+func (c *Client) Entity(key string, v interface{}) (bool, error) {
+	if c.entities == nil {
+		return false, errors.New("graphql: no normalized entities, see WithNormalizedEntities")
+	}
+	b, ok, _ := c.entities.store.Get(context.Background(), key)
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+// InvalidateEntity forgets the entity with key and removes the responses
+// cached with WithResponseCache that contain it, so that the next queries
+// fetch it again.
+func (c *Client) InvalidateEntity(ctx context.Context, key string) error {
+	if c.entities == nil {
+		return errors.New("graphql: no normalized entities, see WithNormalizedEntities")
+	}
+	c.entities.store.Delete(ctx, key)
+	c.entities.generation.Add(1)
+	return c.invalidateResponses(ctx, key)
+}
+
+// invalidateResponses removes the cached responses containing the entity
+// with key.
+func (c *Client) invalidateResponses(ctx context.Context, key string) error {
+	ec := c.entities
+	ec.mu.Lock()
+	responses := make([]string, 0, len(ec.refs[key]))
+	for response := range ec.refs[key] {
+		responses = append(responses, response)
+	}
+	ec.mu.Unlock()
+	if c.cache == nil {
+		return nil
+	}
+	var errs []error
+	for _, response := range responses {
+		if err := c.dropResponse(ctx, response); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runNormalized answers req from the entities, or sends it and normalizes
+// the entities of its response.
+func (c *Client) runNormalized(ctx context.Context, req *Request, resp interface{}) error {
+	raw, err := c.sendNormalized(ctx, req, "")
+	return decodeData(raw, resp, err)
+}
+
+// sendNormalized answers the query req from the entities when it can, or
+// sends req and normalizes the entities of its response, recording that
+// the cached response with key contains them unless key is empty.
+func (c *Client) sendNormalized(ctx context.Context, req *Request, key string) (json.RawMessage, error) {
+	var op *operationDefinition
+	var doc *document
+	if req.OperationType() == OperationQuery {
+		if d, err := parseDocument(req.q); err == nil {
+			doc = d
+			op, _ = doc.operation(req.opName)
+		}
+	}
+	if op != nil && (!req.hasCacheTTL || req.cacheTTL > 0) {
+		if raw, keys, ok := c.entities.answer(ctx, doc, op, req); ok {
+			c.logDebugw(ctx, "<< response from entities", "operation", req.OperationName())
+			c.entities.reference(key, keys)
+			return raw, nil
+		}
+	}
+	generation := c.entities.generation.Load()
+	var raw json.RawMessage
+	if err := c.send(ctx, req, &raw); err != nil {
+		return raw, err
+	}
+	keys := c.entities.normalize(raw, key)
+	if op != nil {
+		c.entities.learn(ctx, op, req, raw, generation)
+	}
+	if req.OperationType() == OperationMutation && len(keys) > 0 {
+		c.entities.generation.Add(1)
+		for _, key := range keys {
+			if err := c.invalidateResponses(ctx, key); err != nil {
+				c.reportError(ctx, err)
+			}
+		}
+	}
+	return raw, nil
+}
+
+// rootKey returns the key the entity returned by the root field s of req
+// is recorded under, and whether its arguments could be resolved.
+func rootKey(req *Request, s selection) (string, bool) {
+	args, ok := resolveVariables(s.args, req.vars)
+	if !ok {
+		return "", false
+	}
+	b, err := json.Marshal(args)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(req.endpoint + "\x00" + headerKey(req.Header) + "\x00" + s.name + "\x00" + string(b)))
+	return hex.EncodeToString(sum[:]), true
+}
+
+// learn records the entities the root fields of the query op of req
+// returned in data, fetched in generation.
+func (ec *entityCache) learn(ctx context.Context, op *operationDefinition, req *Request, data json.RawMessage, generation uint64) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var fields map[string]interface{}
+	if err := d.Decode(&fields); err != nil {
+		return
+	}
+	for _, s := range op.selections {
+		obj, ok := fields[s.responseName()].(map[string]interface{})
+		if s.name == "" || !ok {
+			continue
+		}
+		if key, ok := entityKey(obj); ok {
+			if root, ok := rootKey(req, s); ok {
+				ec.roots.Set(ctx, root, []byte(strconv.FormatUint(generation, 10)+" "+key), ec.ttl)
+			}
+		}
+	}
+}
+
+// answer returns the data of the query op of req built from the entities,
+// along with their keys, if each of its root fields was seen returning an
+// entity, since the last invalidation, that has all the fields it
+// selects.
+func (ec *entityCache) answer(ctx context.Context, doc *document, op *operationDefinition, req *Request) (json.RawMessage, []string, bool) {
+	r := &entityResolver{ctx: ctx, ec: ec, fragments: doc.fragments, spreading: make(map[string]bool)}
+	generation := strconv.FormatUint(ec.generation.Load(), 10)
+	data := make(map[string]interface{}, len(op.selections))
+	for _, s := range op.selections {
+		if s.name == "" || s.directives || len(s.selections) == 0 {
+			return nil, nil, false
+		}
+		root, ok := rootKey(req, s)
+		if !ok {
+			return nil, nil, false
+		}
+		b, ok, _ := ec.roots.Get(ctx, root)
+		if !ok {
+			return nil, nil, false
+		}
+		seen, key, _ := strings.Cut(string(b), " ")
+		if seen != generation {
+			return nil, nil, false
+		}
+		obj, ok := r.entity(key)
+		if !ok {
+			return nil, nil, false
+		}
+		out := make(map[string]interface{}, len(s.selections))
+		if !r.fields(obj, s.selections, out) {
+			return nil, nil, false
+		}
+		data[s.responseName()] = mergeValues(data[s.responseName()], out)
+	}
+	b, err := json.Marshal(data)
+	return b, r.keys, err == nil
+}
+
+// entityResolver builds the value of a selection set from the entities.
+type entityResolver struct {
+	ctx       context.Context
+	ec        *entityCache
+	fragments map[string]fragmentDefinition
+	// spreading holds the fragments being spread, to stop at cycles.
+	spreading map[string]bool
+	// keys holds the keys of the entities read.
+	keys []string
+}
+
+// entity returns the fields of the entity with key.
+func (r *entityResolver) entity(key string) (map[string]interface{}, bool) {
+	b, ok, _ := r.ec.store.Get(r.ctx, key)
+	if !ok {
+		return nil, false
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var obj map[string]interface{}
+	if err := d.Decode(&obj); err != nil {
+		return nil, false
+	}
+	r.keys = append(r.keys, key)
+	return obj, true
+}
+
+// value returns what set selects of v, reading the entities it holds from
+// the store, and whether all of it is known.
+func (r *entityResolver) value(v interface{}, set []selection) (interface{}, bool) {
+	if len(set) == 0 {
+		return v, true
+	}
+	switch v := v.(type) {
+	case nil:
+		return nil, true
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			var ok bool
+			if list[i], ok = r.value(item, set); !ok {
+				return nil, false
+			}
+		}
+		return list, true
+	case map[string]interface{}:
+		if key, ok := entityKey(v); ok {
+			entity, ok := r.entity(key)
+			if !ok {
+				return nil, false
+			}
+			v = entity
+		}
+		out := make(map[string]interface{}, len(set))
+		return out, r.fields(v, set, out)
+	}
+	return nil, false
+}
+
+// fields adds to out what set selects of obj, and reports whether all of
+// it is known.
+func (r *entityResolver) fields(obj map[string]interface{}, set []selection, out map[string]interface{}) bool {
+	for _, s := range set {
+		if s.directives {
+			return false
+		}
+		switch {
+		case s.spread != "":
+			fragment, ok := r.fragments[s.spread]
+			if !ok || r.spreading[s.spread] || !applies(obj, fragment.on) {
+				return false
+			}
+			r.spreading[s.spread] = true
+			ok = r.fields(obj, fragment.selections, out)
+			delete(r.spreading, s.spread)
+			if !ok {
+				return false
+			}
+		case s.name == "":
+			if !applies(obj, s.on) || !r.fields(obj, s.selections, out) {
+				return false
+			}
+		default:
+			// The fields are merged by response name, whatever their
+			// arguments.
+			if len(s.args) > 0 {
+				return false
+			}
+			v, ok := obj[s.responseName()]
+			if !ok {
+				return false
+			}
+			if v, ok = r.value(v, s.selections); !ok {
+				return false
+			}
+			out[s.responseName()] = mergeValues(out[s.responseName()], v)
+		}
+	}
+	return true
+}
+
+// applies reports whether a fragment with the type condition on applies
+// to obj for sure. Only the __typename of obj is known, so a condition on
+// an interface or a union can't be told from one that doesn't apply.
+func applies(obj map[string]interface{}, on string) bool {
+	return on == "" || obj["__typename"] == on
+}
+
+// mergeValues merges b into a, the values of a field selected more than
+// once, such as in several fragments.
+func mergeValues(a, b interface{}) interface{} {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b, ok := b.(map[string]interface{}); ok {
+			for name, v := range b {
+				a[name] = mergeValues(a[name], v)
+			}
+			return a
+		}
+	case []interface{}:
+		if b, ok := b.([]interface{}); ok && len(a) == len(b) {
+			for i := range b {
+				a[i] = mergeValues(a[i], b[i])
+			}
+			return a
+		}
+	}
+	return b
+}
+
+// normalize merges the entities found in data into the cache, recording
+// that the cached response with key contains them unless key is empty.
+// It returns the keys of the entities found.
+func (ec *entityCache) normalize(data json.RawMessage, response string) []string {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil
+	}
+	var keys []string
+	ec.walk(v, &keys)
+	ec.reference(response, keys)
+	return keys
+}
+
+// reference records that the cached response with key contains the
+// entities with keys, unless key is empty.
+func (ec *entityCache) reference(response string, keys []string) {
+	if response == "" || len(keys) == 0 {
+		return
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	ec.unref(response)
+	for _, key := range keys {
+		if ec.refs[key] == nil {
+			ec.refs[key] = make(map[string]bool)
+		}
+		ec.refs[key][response] = true
+	}
+	ec.responses[response] = keys
+}
+
+// forget drops the references of the cached response with key to its
+// entities, once it left the cache.
+func (ec *entityCache) forget(response string) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	ec.unref(response)
+}
+
+// unref drops the references of response. The lock of ec must be held.
+func (ec *entityCache) unref(response string) {
+	for _, key := range ec.responses[response] {
+		delete(ec.refs[key], response)
+		if len(ec.refs[key]) == 0 {
+			delete(ec.refs, key)
+		}
+	}
+	delete(ec.responses, response)
+}
+
+// walk merges the entities found in v, appending their keys to keys.
+func (ec *entityCache) walk(v interface{}, keys *[]string) {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			ec.walk(item, keys)
+		}
+	case map[string]interface{}:
+		for _, field := range v {
+			ec.walk(field, keys)
+		}
+		if key, ok := entityKey(v); ok {
+			ec.merge(key, v)
+			*keys = append(*keys, key)
+		}
+	}
+}
+
+// entityKey returns the EntityKey of obj, if it is an entity.
+func entityKey(obj map[string]interface{}) (string, bool) {
+	typename, ok := obj["__typename"].(string)
+	if !ok || typename == "" {
+		return "", false
+	}
+	switch id := obj["id"].(type) {
+	case string:
+		return EntityKey(typename, id), true
+	case json.Number:
+		return EntityKey(typename, id.String()), true
+	}
+	return "", false
+}
+
+// merge adds the fields of obj to the entity with key.
+func (ec *entityCache) merge(key string, obj map[string]interface{}) {
+	ctx := context.Background()
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	fields := make(map[string]json.RawMessage, len(obj))
+	if b, ok, _ := ec.store.Get(ctx, key); ok {
+		json.Unmarshal(b, &fields)
+	}
+	for name, value := range obj {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return
+		}
+		fields[name] = b
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return
+	}
+	ec.store.Set(ctx, key, b, ec.ttl)
+}
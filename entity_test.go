@@ -0,0 +1,222 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mapCache is a Cache in a map that doesn't expire its entries.
+type mapCache struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+}
+
+func newMapCache() *mapCache {
+	return &mapCache{entries: make(map[string][]byte)}
+}
+
+func (m *mapCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.entries[key]
+	return b, ok, nil
+}
+
+func (m *mapCache) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = value
+	return nil
+}
+
+func (m *mapCache) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *mapCache) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+// userServer answers each operation with the user whose id is its id
+// variable, counting the requests.
+func userServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var body struct{ Variables struct{ ID string } }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		fmt.Fprintf(w, `{"data":{"user":{"__typename":"User","id":%q,"name":"user %s"}}}`, body.Variables.ID, body.Variables.ID)
+	}))
+	return srv, &requests
+}
+
+// runUser runs the query or mutation op for the user with id.
+func runUser(t *testing.T, client *Client, op, id string) {
+	t.Helper()
+	req := NewRequest(op + "($id: ID!) { user(id: $id) { __typename id name } }")
+	req.Var("id", id)
+	if err := client.Run(context.Background(), req, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// entityRefs returns the number of entities and responses indexed.
+func entityRefs(c *Client) (entities, responses int) {
+	c.entities.mu.Lock()
+	defer c.entities.mu.Unlock()
+	return len(c.entities.refs), len(c.entities.responses)
+}
+
+func TestNormalizedEntitiesMutationInvalidates(t *testing.T) {
+	srv, requests := userServer(t)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithResponseCache(time.Minute), WithNormalizedEntities(time.Minute))
+	runUser(t, client, "query", "1")
+	runUser(t, client, "query", "1")
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("got %d requests, want the second query cached", got)
+	}
+	var user struct{ Name string }
+	if ok, err := client.Entity("User:1", &user); !ok || err != nil || user.Name != "user 1" {
+		t.Errorf("got %+v, %v, %v", user, ok, err)
+	}
+	runUser(t, client, "mutation", "1")
+	runUser(t, client, "query", "1")
+	if got := requests.Load(); got != 3 {
+		t.Errorf("got %d requests, want the query sent again after the mutation", got)
+	}
+}
+
+func TestNormalizedEntitiesForgetsEvictedResponses(t *testing.T) {
+	srv, _ := userServer(t)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithResponseCache(time.Minute), WithNormalizedEntities(time.Minute))
+	store := NewLRUCache(1)
+	store.onRemove = client.forgetResponse
+	client.cache.store = store
+	runUser(t, client, "query", "1")
+	runUser(t, client, "query", "2")
+	if entities, responses := entityRefs(client); entities != 1 || responses != 1 {
+		t.Errorf("got %d entities of %d responses indexed, want those of the cached one", entities, responses)
+	}
+	client.InvalidateEntity(context.Background(), "User:2")
+	if entities, responses := entityRefs(client); entities != 0 || responses != 0 {
+		t.Errorf("got %d entities of %d responses indexed after invalidation", entities, responses)
+	}
+}
+
+func TestNormalizedEntitiesForgetsExpiredResponses(t *testing.T) {
+	srv, _ := userServer(t)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithResponseCache(time.Millisecond), WithNormalizedEntities(time.Minute))
+	runUser(t, client, "query", "1")
+	time.Sleep(5 * time.Millisecond)
+	for key := range client.entities.responses {
+		client.cache.store.Get(context.Background(), key)
+	}
+	if entities, responses := entityRefs(client); entities != 0 || responses != 0 {
+		t.Errorf("got %d entities of %d responses indexed after expiry", entities, responses)
+	}
+}
+
+func TestNormalizedEntitiesBoundsTrackedResponses(t *testing.T) {
+	srv, _ := userServer(t)
+	defer srv.Close()
+	backend := newMapCache()
+	client := NewClient(srv.URL, WithResponseCache(time.Minute), WithNormalizedEntities(time.Minute), WithCacheBackend(backend))
+	client.cache.maxTracked = 2
+	for _, id := range []string{"1", "2", "3"} {
+		runUser(t, client, "query", id)
+	}
+	if backend.len() != 2 {
+		t.Errorf("got %d cached responses, want the oldest deleted", backend.len())
+	}
+	if entities, responses := entityRefs(client); entities != 2 || responses != 2 {
+		t.Errorf("got %d entities of %d responses indexed, want 2 of 2", entities, responses)
+	}
+	if _, ok := client.entities.refs["User:1"]; ok {
+		t.Error("the entity of the deleted response is still indexed")
+	}
+}
+
+func TestNormalizedEntitiesAnswerQueries(t *testing.T) {
+	srv, requests := userServer(t)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithNormalizedEntities(time.Minute))
+	runUser(t, client, "query", "1")
+	var resp struct {
+		U struct{ Name, ID string }
+	}
+	req := NewRequest(`{ u: user(id: "1") { name ...Fields } } fragment Fields on User { id }`)
+	if err := client.Run(context.Background(), req, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 1 || resp.U.Name != "user 1" || resp.U.ID != "1" {
+		t.Errorf("got %+v after %d requests, want the query answered from User:1", resp, requests.Load())
+	}
+	for name, req := range map[string]func() *Request{
+		"missing field": func() *Request {
+			return NewRequest(`{ user(id: "1") { name email } }`)
+		},
+		"other arguments": func() *Request {
+			return NewRequest(`{ user(id: "2") { name } }`)
+		},
+		"other headers": func() *Request {
+			r := NewRequest(`{ user(id: "1") { name } }`)
+			r.Header.Set("Authorization", "Bearer other")
+			return r
+		},
+		"field arguments": func() *Request {
+			return NewRequest(`{ user(id: "1") { name(format: UPPER) } }`)
+		},
+		"interface fragment": func() *Request {
+			return NewRequest(`{ user(id: "1") { ... on Node { id } } }`)
+		},
+		"cache disabled": func() *Request {
+			r := NewRequest(`{ user(id: "1") { name } }`)
+			r.SetCacheTTL(0)
+			return r
+		},
+	} {
+		sent := requests.Load()
+		client.Run(context.Background(), req(), nil)
+		if requests.Load() != sent+1 {
+			t.Errorf("%s: the query was answered from the entities", name)
+		}
+	}
+}
+
+func TestNormalizedEntitiesInvalidationRefetches(t *testing.T) {
+	srv, requests := userServer(t)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithNormalizedEntities(time.Minute))
+	runUser(t, client, "query", "1")
+	runUser(t, client, "query", "1")
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("got %d requests, want the second query answered from the entities", got)
+	}
+	runUser(t, client, "mutation", "1")
+	runUser(t, client, "query", "1")
+	if got := requests.Load(); got != 3 {
+		t.Errorf("got %d requests, want the query sent again after the mutation", got)
+	}
+	client.InvalidateEntity(context.Background(), "User:1")
+	runUser(t, client, "query", "1")
+	if got := requests.Load(); got != 4 {
+		t.Errorf("got %d requests, want the query sent again after the invalidation", got)
+	}
+}
@@ -0,0 +1,34 @@
+package graphql
+
+import "context"
+
+// WithErrorHook calls hook with the errors the client can't return to the
+// caller, such as failures to close a response body, after logging them
+// as warnings.
+func WithErrorHook(hook func(ctx context.Context, err error)) ClientOption {
+	return func(client *Client) {
+		client.errorHook = hook
+	}
+}
+
+// reportError logs err, which can't be returned to the caller of a
+// request made with ctx, and passes it to the error hook.
+func (c *Client) reportError(ctx context.Context, err error) {
+	c.logWarnw(ctx, "error not returned to the caller", "error", err)
+	if c.errorHook != nil {
+		c.errorHook(ctx, err)
+	}
+}
+
+// errorReporterKey is the context key of the function reporting the
+// errors of the transports of a call, see reportError.
+type errorReporterKey struct{}
+
+// reportError reports err with the reporter of the call ctx belongs to.
+// Without one, as when a RetryTransport is used on its own, err is
+// dropped.
+func reportError(ctx context.Context, err error) {
+	if report, ok := ctx.Value(errorReporterKey{}).(func(context.Context, error)); ok {
+		report(ctx, err)
+	}
+}
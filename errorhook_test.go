@@ -0,0 +1,41 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// failingCloser is a body whose Close fails.
+type failingCloser struct{ io.Reader }
+
+var errClose = errors.New("close failed")
+
+func (failingCloser) Close() error { return errClose }
+
+func TestErrorHookBodyClose(t *testing.T) {
+	doer := doerFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       failingCloser{strings.NewReader(`{"data":{}}`)},
+		}, nil
+	})
+	logger := &recordingLogger{}
+	var reported []error
+	client := NewClient("http://example.com", WithDoer(doer), WithLeveledLogger(logger), WithErrorHook(func(ctx context.Context, err error) {
+		reported = append(reported, err)
+	}))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], errClose) {
+		t.Errorf("got %v reported, want the close error", reported)
+	}
+	if e, ok := logger.find("error not returned to the caller"); !ok || e.level != "warn" {
+		t.Errorf("got %+v, want the close error logged as a warning", logger.entries)
+	}
+}
@@ -0,0 +1,42 @@
+package graphql
+
+import "time"
+
+// DefaultExpectContinueTimeout is how long the default HTTP client waits
+// for the server to answer Expect: 100-continue before sending the body
+// anyway, unless WithExpectContinue is given another timeout.
+const DefaultExpectContinueTimeout = time.Second
+
+// WithExpectContinue sends multipart requests whose files add up to at
+// least threshold bytes, or whose size isn't known, with Expect:
+// 100-continue, so that a server rejecting them, e.g. for failed
+// authentication, does so before the files are transmitted. The default
+// HTTP client waits up to timeout, or DefaultExpectContinueTimeout if it
+// isn't positive, for the server to answer before sending the body.
+func WithExpectContinue(threshold int64, timeout time.Duration) ClientOption {
+	return func(client *Client) {
+		if timeout <= 0 {
+			timeout = DefaultExpectContinueTimeout
+		}
+		client.expectContinue = true
+		client.expectContinueThreshold = threshold
+		client.expectContinueTimeout = timeout
+	}
+}
+
+// expectsContinue reports whether a multipart request with files is sent
+// with Expect: 100-continue.
+func (c *Client) expectsContinue(files []File) bool {
+	if !c.expectContinue {
+		return false
+	}
+	var total int64
+	for _, f := range files {
+		size := f.size()
+		if size < 0 {
+			return true
+		}
+		total += size
+	}
+	return total >= c.expectContinueThreshold
+}
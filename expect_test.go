@@ -0,0 +1,52 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExpectContinue(t *testing.T) {
+	var expects []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expects = append(expects, r.Header.Get("Expect"))
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.Copy(io.Discard, r.Body)
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, UseMultipartForm(), WithoutRetry(), WithExpectContinue(1<<20, 0))
+	upload := func(size int, authorized bool) (*Request, *countingReader) {
+		req := NewRequest("mutation($f: Upload!) { upload(file: $f) }")
+		if authorized {
+			req.Header.Set("Authorization", "Bearer a")
+		}
+		file := &countingReader{r: strings.NewReader(strings.Repeat("x", size))}
+		req.File("f", "a.txt", file, WithFileSize(int64(size)))
+		return req, file
+	}
+	req, file := upload(8<<20, false)
+	if err := client.Run(context.Background(), req, nil); err == nil {
+		t.Fatal("expected the 401")
+	}
+	if file.n != 0 {
+		t.Errorf("got %d bytes of the file read, want none after the rejection", file.n)
+	}
+	req, _ = upload(8<<20, true)
+	if err := client.Run(context.Background(), req, nil); err != nil {
+		t.Fatal(err)
+	}
+	req, _ = upload(10, true)
+	if err := client.Run(context.Background(), req, nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(expects, ",") != "100-continue,100-continue," {
+		t.Errorf("got Expect headers %q, want them above the threshold only", expects)
+	}
+}
@@ -0,0 +1,53 @@
+package graphql
+
+import (
+	"context"
+	"expvar"
+)
+
+// WithExpvar publishes the main counters of the client with expvar, for
+// services exposing /debug/vars: <prefix>.requests, <prefix>.errors,
+// <prefix>.attempts, <prefix>.retries, <prefix>.bytes_out,
+// <prefix>.bytes_in, <prefix>.subscriptions_active,
+// <prefix>.subscription_messages and <prefix>.subscription_reconnects.
+// See Stats for what they count. As with
+// expvar.Publish, each prefix can only be used by one client: another
+// client with the same prefix logs a warning and publishes nothing.
+func WithExpvar(prefix string) ClientOption {
+	return func(client *Client) {
+		client.expvarPrefix = prefix
+	}
+}
+
+// publishExpvar publishes the counters of the client under
+// c.expvarPrefix, if set.
+func (c *Client) publishExpvar() {
+	if c.expvarPrefix == "" {
+		return
+	}
+	s := c.stats
+	vars := []struct {
+		name  string
+		value func() uint64
+	}{
+		{"requests", s.requests.Load},
+		{"errors", s.failures.Load},
+		{"attempts", s.attempts.Load},
+		{"retries", s.totalRetries},
+		{"bytes_out", s.bytesOut.Load},
+		{"bytes_in", s.bytesIn.Load},
+		{"subscriptions_active", func() uint64 { return uint64(max(s.subscriptionsActive.Load(), 0)) }},
+		{"subscription_messages", s.subscriptionMessages.Load},
+		{"subscription_reconnects", s.reconnects.Load},
+	}
+	for _, v := range vars {
+		if expvar.Get(c.expvarPrefix+"."+v.name) != nil {
+			c.logWarnw(context.Background(), "expvar already published, not publishing the client's counters", "name", c.expvarPrefix+"."+v.name)
+			return
+		}
+	}
+	for _, v := range vars {
+		value := v.value
+		expvar.Publish(c.expvarPrefix+"."+v.name, expvar.Func(func() any { return value() }))
+	}
+}
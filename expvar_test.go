@@ -0,0 +1,33 @@
+package graphql
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// expvarRuns tells the runs of TestExpvar apart, as a prefix can only be
+// published once.
+var expvarRuns atomic.Int32
+
+func TestExpvar(t *testing.T) {
+	prefix := fmt.Sprintf("graphql_test_%d", expvarRuns.Add(1))
+	srv, _ := sequenceServer(503, 200)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithExpvar(prefix), WithClock(&recordingClock{}))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"requests": "1", "errors": "0", "attempts": "2", "retries": "1"} {
+		if v := expvar.Get(prefix + "." + name); v == nil || v.String() != want {
+			t.Errorf("%s: got %v, want %s", name, v, want)
+		}
+	}
+	logger := &recordingLogger{}
+	NewClient(srv.URL, WithExpvar(prefix), WithLeveledLogger(logger))
+	if e, ok := logger.find("expvar already published, not publishing the client's counters"); !ok || e.level != "warn" {
+		t.Errorf("got %+v, want a warning for the prefix in use", logger.entries)
+	}
+}
@@ -0,0 +1,142 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// WithFallbackEndpoints adds secondary endpoints used when the primary
+// endpoint given to NewClient fails: a request whose connection to the
+// primary fails or times out, that its circuit breaker rejects, or that
+// gets a 5xx response, after retries, is transparently sent to the next
+// endpoint in order. Errors returned by hooks such as the one given to
+// WithOnRetry, or about the request itself, are returned as is. Requests
+// stick to the endpoint that last answered; every probeInterval a request
+// is sent to the primary first again so the client returns to it once it
+// has recovered. Requests with files are never failed over since their
+// body can't be replayed.
+func WithFallbackEndpoints(probeInterval time.Duration, endpoints ...string) ClientOption {
+	return func(client *Client) {
+		client.fallbackEndpoints = endpoints
+		client.probeInterval = probeInterval
+	}
+}
+
+// failover tracks which of several endpoints requests are sent to.
+type failover struct {
+	endpoints     []string
+	probeInterval time.Duration
+	logger        logFunc
+
+	mu sync.Mutex
+	// active is the index of the endpoint requests are sent to first.
+	active int
+	// probed is when the primary was last tried.
+	probed time.Time
+}
+
+// order returns the indexes of the endpoints in the order to try them.
+func (f *failover) order() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	first := f.active
+	if first != 0 && time.Since(f.probed) >= f.probeInterval {
+		f.probed = time.Now()
+		first = 0
+	}
+	order := make([]int, 0, len(f.endpoints))
+	order = append(order, first)
+	if first != f.active {
+		order = append(order, f.active)
+	}
+	for i := range f.endpoints {
+		if i != first && i != f.active {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// answered records that endpoint i handled a request.
+func (f *failover) answered(i int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if i == f.active {
+		return
+	}
+	if i == 0 {
+		f.logger("primary endpoint recovered, switching back", "endpoint", f.endpoints[0])
+	} else {
+		f.logger("failing over", "endpoint", f.endpoints[i])
+		f.probed = time.Now()
+	}
+	f.active = i
+}
+
+// withEndpoints calls send with the endpoint to use for req, moving on to
+// the fallback endpoints while send fails in a way that allows failover.
+func (c *Client) withEndpoints(ctx context.Context, req *Request, send func(endpoint string) error) error {
+	send = c.withCredentialRefresh(ctx, req, send)
+	if req.endpoint != "" {
+		return send(req.endpoint)
+	}
+	if c.pool != nil {
+		return c.pool.send(ctx, req, send, c.logWarnw)
+	}
+	if c.failover == nil {
+		return send(c.endpoint)
+	}
+	order := c.failover.order()
+	if req.hasFiles() {
+		order = order[:1]
+	}
+	var err error
+	for _, i := range order {
+		err = send(c.failover.endpoints[i])
+		if !shouldFailover(ctx, err) {
+			c.failover.answered(i)
+			return err
+		}
+		c.logWarnw(ctx, "endpoint failed", "operation", req.OperationName(), "endpoint", c.failover.endpoints[i], "error", err)
+	}
+	return err
+}
+
+// shouldFailover reports whether err means the endpoint is unavailable:
+// a 5xx status, possibly after retries, an open circuit breaker, or a
+// network error, the errors of the hooks and the request excluded.
+func shouldFailover(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var partial *PartialWriteError
+	if errors.As(err, &partial) {
+		// The response can't be taken back from the writer.
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	var exhausted *RetryExhaustedError
+	if errors.As(err, &exhausted) && exhausted.LastStatusCode() != 0 {
+		return exhausted.LastStatusCode() >= 500
+	}
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	// The HTTP client wraps every error of the transports in a url.Error,
+	// which is a net.Error itself.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,91 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShouldFailover(t *testing.T) {
+	wrap := func(err error) error { return &url.Error{Op: "Post", URL: "http://example.com", Err: err} }
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	for name, tt := range map[string]struct {
+		err  error
+		want bool
+	}{
+		"nil":            {nil, false},
+		"5xx":            {&StatusError{StatusCode: 502}, true},
+		"4xx":            {&StatusError{StatusCode: 400}, false},
+		"refused":        {wrap(refused), true},
+		"eof":            {wrap(io.EOF), true},
+		"timeout":        {wrap(context.DeadlineExceeded), true},
+		"circuit open":   {wrap(ErrCircuitOpen), true},
+		"exhausted 503":  {wrap(&RetryExhaustedError{Attempts: []RetryAttempt{{StatusCode: 503}}}), true},
+		"exhausted 429":  {wrap(&RetryExhaustedError{Attempts: []RetryAttempt{{StatusCode: 429}}}), false},
+		"exhausted dial": {wrap(&RetryExhaustedError{Attempts: []RetryAttempt{{Err: refused}}}), true},
+		"hook":           {wrap(errors.New("aborted by hook")), false},
+		"non-replayable": {wrap(&NonReplayableBodyError{StatusCode: 503}), false},
+		"graphql":        {graphErr{Message: "boom"}, false},
+	} {
+		if got := shouldFailover(context.Background(), tt.err); got != tt.want {
+			t.Errorf("%s: got %v, want %v", name, got, tt.want)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if shouldFailover(ctx, &StatusError{StatusCode: 503}) {
+		t.Error("failed over a request canceled by its caller")
+	}
+}
+
+// countingServer answers with status, counting the requests.
+func countingServer(status int) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			io.WriteString(w, `{"data":{}}`)
+		}
+	}))
+	return srv, &requests
+}
+
+func TestFailoverOnConnectionError(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	fallback, requests := countingServer(http.StatusOK)
+	defer fallback.Close()
+	client := NewClient(down.URL, WithFallbackEndpoints(time.Minute, fallback.URL))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("got %d requests to the fallback, want 1", requests.Load())
+	}
+}
+
+func TestFailoverNotOnHookError(t *testing.T) {
+	primary, _ := countingServer(http.StatusServiceUnavailable)
+	defer primary.Close()
+	fallback, requests := countingServer(http.StatusOK)
+	defer fallback.Close()
+	abort := errors.New("abort")
+	client := NewClient(primary.URL, WithFallbackEndpoints(time.Minute, fallback.URL),
+		WithOnRetry(func(attempt int, delay time.Duration, cause error, req *http.Request) error {
+			return abort
+		}))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); !errors.Is(err, abort) {
+		t.Fatalf("got %v, want the error of the hook", err)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("got %d requests to the fallback, want none", requests.Load())
+	}
+}
@@ -0,0 +1,70 @@
+package graphql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Fingerprint returns a stable SHA-256 hex digest of the normalized query
+// document, operation name and variables of the request.
+// Requests that differ only in whitespace, comments or insignificant
+// commas in the query, or in the order variables were set, have the same
+// fingerprint, which makes it usable as a cache, dedup or idempotency key.
+// Headers and files are not part of the fingerprint.
+func (req *Request) Fingerprint() string {
+	h := sha256.New()
+	h.Write([]byte(normalizeQuery(req.q)))
+	h.Write([]byte{0})
+	h.Write([]byte(req.opName))
+	h.Write([]byte{0})
+	if len(req.vars) > 0 {
+		// encoding/json sorts map keys, which keeps the encoding stable
+		variables, err := json.Marshal(req.vars)
+		if err != nil {
+			variables = []byte(fmt.Sprint(req.vars))
+		}
+		h.Write(variables)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeQuery strips comments and collapses ignored tokens (whitespace,
+// commas) of a GraphQL document, keeping a single space only where it is
+// needed to separate two names or numbers. String literals are preserved.
+func normalizeQuery(doc string) string {
+	var b strings.Builder
+	b.Grow(len(doc))
+	var last byte
+	sep := false
+	for i := 0; i < len(doc); {
+		ch := doc[i]
+		switch {
+		case ch == '#':
+			for i < len(doc) && doc[i] != '\n' && doc[i] != '\r' {
+				i++
+			}
+			sep = true
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == ',':
+			sep = true
+			i++
+		case ch == '"':
+			end := skipString(doc, i)
+			b.WriteString(doc[i:end])
+			i = end
+			last = '"'
+			sep = false
+		default:
+			if sep && isNameContinue(last) && isNameContinue(ch) {
+				b.WriteByte(' ')
+			}
+			b.WriteByte(ch)
+			last = ch
+			sep = false
+			i++
+		}
+	}
+	return b.String()
+}
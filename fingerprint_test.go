@@ -0,0 +1,30 @@
+package graphql
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	req := func(q string, vars ...string) *Request {
+		r := NewRequest(q)
+		for i := 0; i+1 < len(vars); i += 2 {
+			r.Var(vars[i], vars[i+1])
+		}
+		return r
+	}
+	base := req("query ($a: ID, $b: ID) { user(a: $a, b: $b) { id name } }", "a", "1", "b", "2")
+	same := req("query ($a: ID $b: ID) {\n  user(a: $a, b: $b) { # the user\n    id, name\n  }\n}", "b", "2", "a", "1")
+	if base.Fingerprint() != same.Fingerprint() {
+		t.Error("formatting, comments or the order of the variables change the fingerprint")
+	}
+	for name, other := range map[string]*Request{
+		"variables": req("query ($a: ID, $b: ID) { user(a: $a, b: $b) { id name } }", "a", "1", "b", "3"),
+		"query":     req("query ($a: ID, $b: ID) { user(a: $a, b: $b) { id } }", "a", "1", "b", "2"),
+		"string":    req(`{ user(name: "a  b") { id } }`),
+	} {
+		if other.Fingerprint() == base.Fingerprint() {
+			t.Errorf("%s: same fingerprint", name)
+		}
+	}
+	if req(`{ user(name: "a  b") { id } }`).Fingerprint() == req(`{ user(name: "a b") { id } }`).Fingerprint() {
+		t.Error("the whitespace of strings is ignored")
+	}
+}
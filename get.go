@@ -0,0 +1,84 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// DefaultMaxGetURLLength is the longest URL UseGETForQueries will send
+// when no explicit limit is given. Longer requests are sent as POST.
+const DefaultMaxGetURLLength = 2048
+
+// UseGETForQueries sends query operations as GET requests with the
+// query, variables and operationName URL-encoded as parameters, which
+// lets CDNs and proxies cache them.
+// Mutations, subscriptions and requests whose URL would be longer than
+// maxURLLength are still sent as POST. A maxURLLength of zero or less
+// means DefaultMaxGetURLLength.
+func UseGETForQueries(maxURLLength int) ClientOption {
+	return func(client *Client) {
+		client.useGET = true
+		client.maxGetURLLength = maxURLLength
+	}
+}
+
+// newGetRequest builds a GET request for req. The returned bool is false
+// when req must be sent as POST instead.
+func (c *Client) newGetRequest(ctx context.Context, req *Request, endpointURL string) (*http.Request, bool, error) {
+	if !c.useGET || req.hasFiles() || req.OperationType() != OperationQuery {
+		return nil, false, nil
+	}
+	endpoint, err := url.Parse(endpointURL)
+	if err != nil {
+		return nil, false, fmt.Errorf("parse endpoint: %w", err)
+	}
+	env := c.envelope(req)
+	params := endpoint.Query()
+	if env.Query != "" {
+		params.Set("query", env.Query)
+	}
+	if env.ID != "" {
+		params.Set("id", env.ID)
+	}
+	if len(env.Variables) > 0 {
+		variables, err := json.Marshal(env.Variables)
+		if err != nil {
+			return nil, false, fmt.Errorf("encode variables: %w", err)
+		}
+		params.Set("variables", string(variables))
+	}
+	if env.OperationName != "" {
+		params.Set("operationName", env.OperationName)
+	}
+	if len(env.Extensions) > 0 {
+		extensions, err := json.Marshal(env.Extensions)
+		if err != nil {
+			return nil, false, fmt.Errorf("encode extensions: %w", err)
+		}
+		params.Set("extensions", string(extensions))
+	}
+	endpoint.RawQuery = params.Encode()
+	u := endpoint.String()
+	maxLength := c.maxGetURLLength
+	if maxLength <= 0 {
+		maxLength = DefaultMaxGetURLLength
+	}
+	if len(u) > maxLength {
+		c.logDebugw(ctx, ">> url too long, falling back to POST", "operation", req.OperationName(), "length", len(u), "max_length", maxLength)
+		return nil, false, nil
+	}
+	c.logDebugRequest(ctx, req)
+	r, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	r.Close = c.closeReq
+	r.Header.Set("Accept", "application/json; charset=utf-8")
+	if err := c.setHeaders(ctx, r, req); err != nil {
+		return nil, false, err
+	}
+	return r, true, nil
+}
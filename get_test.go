@@ -0,0 +1,41 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGETForQueries(t *testing.T) {
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		if r.Method == http.MethodGet {
+			params := r.URL.Query()
+			if params.Get("query") != "query Foo($id: ID) { a }" || params.Get("variables") != `{"id":"1"}` || params.Get("operationName") != "Foo" {
+				t.Errorf("got parameters %v", params)
+			}
+		}
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, UseGETForQueries(200))
+	query := NewRequest("query Foo($id: ID) { a }")
+	query.Var("id", "1")
+	query.SetOperationName("Foo")
+	for _, req := range []*Request{
+		query,
+		NewRequest("mutation { a }"),
+		NewRequest("{ " + strings.Repeat("a ", 100) + "}"),
+	} {
+		if err := client.Run(context.Background(), req, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Join(methods, ","); got != "GET,POST,POST" {
+		t.Errorf("got %s, want only the short query sent as GET", got)
+	}
+}
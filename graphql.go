@@ -3,12 +3,16 @@ package graphql
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
+	"net"
 	"net/http"
+	"net/textproto"
+	"net/url"
+	"sync"
 	"time"
 )
 
@@ -17,7 +21,95 @@ type Client struct {
 	endpoint                        string
 	httpClient                      *http.Client
 	useMultipartForm                bool
+	autoMultipart                   bool
+	useGraphQLBody                  bool
+	useGET                          bool
+	maxGetURLLength                 int
+	persistedQueries                map[string]string
+	requirePersisted                bool
+	useIdempotencyKey               bool
+	noMutationRetries               bool
+	compressRequests                bool
+	compressMinSize                 int
+	uploadLimits                    uploadLimits
 	defaultWaitAfterTooManyRequests time.Duration
+	backoff                         Backoff
+	retryPolicy                     RetryPolicy
+	maxRetryElapsed                 time.Duration
+	onRetry                         RetryHook
+	stats                           *clientStats
+	clock                           Clock
+	refreshCredentials              CredentialRefresher
+	attemptTimeout                  time.Duration
+	noRetry                         bool
+	useHTTP2                        bool
+	baseTransport                   http.RoundTripper
+	tlsConfig                       *tls.Config
+	clientCertificates              []tls.Certificate
+	proxy                           func(*http.Request) (*url.URL, error)
+	connectionPool                  *ConnectionPool
+	resolver                        *net.Resolver
+	dnsCacheTTL                     time.Duration
+	cookieJar                       http.CookieJar
+	decoders                        map[string]Decoder
+	signer                          Signer
+	spanExtractor                   SpanExtractor
+	b3Headers                       bool
+	userAgent                       string
+	middlewares                     []Middleware
+	logSummary                      bool
+	observers                       []Observer
+	hooks                           []Hooks
+	har                             *HARRecorder
+	wireDump                        *wireDump
+	audit                           func(ctx context.Context, a MutationAudit)
+	auditRedacted                   map[string]bool
+	debugBodyLimit                  int
+	debugBodySummary                bool
+	debugSampleRate                 float64
+	expvarPrefix                    string
+	errorHook                       func(ctx context.Context, err error)
+	subscriptionEndpoint            string
+	subscriptionProtocols           []string
+	subscriptionReconnect           *SubscriptionReconnect
+	subscriptionKeepalive           *SubscriptionKeepalive
+	subscriptionBuffer              int
+	subscriptionHooks               []SubscriptionHooks
+	subscriptionDial                dialFunc
+	subscriptionProxy               func(*http.Request) (*url.URL, error)
+	subscriptionCompression         bool
+	backpressure                    Backpressure
+	connectionInit                  func(ctx context.Context) (interface{}, error)
+	sseMode                         SSEMode
+	sseStream                       *sseConn
+	subscriptionMu                  sync.Mutex
+	subscriptions                   *subscriptionConn
+	expectContinue                  bool
+	expectContinueThreshold         int64
+	expectContinueTimeout           time.Duration
+	dialContext                     func(ctx context.Context, network, addr string) (net.Conn, error)
+	ipFamily                        IPFamily
+	fallbackDelay                   time.Duration
+	retryBudget                     *retryBudget
+	circuitBreaker                  *CircuitBreaker
+	breaker                         *breakerTransport
+	hedgeDelay                      time.Duration
+	fallbackEndpoints               []string
+	probeInterval                   time.Duration
+	failover                        *failover
+	balancer                        Balancer
+	balancedEndpoints               []Endpoint
+	pool                            *pool
+	rateLimitHeaders                *RateLimitHeaders
+	rateLimiter                     *tokenBucket
+	adaptiveConcurrency             *AdaptiveConcurrency
+	queue                           *requestQueue
+	autoBatch                       *autoBatcher
+	cache                           *responseCache
+	cacheBackend                    Cache
+	conditional                     *conditionalCache
+	entities                        *entityCache
+	invalidationRules               []InvalidationRule
 
 	// closeReq will close the request body immediately allowing for reuse of client
 	closeReq bool
@@ -26,37 +118,210 @@ type Client struct {
 	// To log to standard out, use:
 	//  client.Log = func(s string) { log.Println(s) }
 	logDebug func(s string)
+	logInfo  func(s string)
 	logWarn  func(s string)
 	logErr   func(s string)
+	// logger receives the logs of the client, see WithLeveledLogger.
+	logger Logger
+	// logDebugSet is set by WithLogDebug; debugEnabled tells whether debug
+	// messages are logged at all, so they aren't formatted for nothing.
+	logDebugSet  bool
+	debugEnabled bool
 }
 
 // NewClient makes a new Client capable of making GraphQL requests.
+// The endpoint may be a Unix domain socket with the default HTTP client,
+// such as unix:///var/run/api.sock/graphql.
 func NewClient(endpoint string, opts ...ClientOption) *Client {
 	c := &Client{
-		endpoint: endpoint,
-		logDebug: func(string) {},
-		logWarn:  func(string) {},
-		logErr:   func(string) {},
+		endpoint:  endpoint,
+		backoff:   DefaultBackoff,
+		stats:     &clientStats{},
+		userAgent: defaultUserAgent(),
+		logDebug:  func(string) {},
+		logInfo:   func(string) {},
+		logWarn:   func(string) {},
+		logErr:    func(string) {},
 	}
 	for _, optionFunc := range opts {
 		optionFunc(c)
 	}
-	if c.httpClient == nil {
-		c.httpClient = NewRetryableClient(c.logWarn, c.defaultWaitAfterTooManyRequests)
+	c.debugEnabled = c.logDebugSet
+	if c.logger == nil {
+		c.logger = funcLogger{debug: c.logDebug, info: c.logInfo, warn: c.logWarn, err: c.logErr}
+	} else {
+		c.debugEnabled = debugEnabled(c.logger)
+	}
+	c.publishExpvar()
+	if c.cache != nil {
+		c.cache.store = c.cacheBackend
+		if c.cache.store == nil {
+			// The removals of the built-in store are reported, so the
+			// responses indexed don't need tracking.
+			store := NewLRUCache(defaultCacheEntries)
+			store.onRemove = c.forgetResponse
+			c.cache.store = store
+		} else {
+			c.cache.maxTracked = defaultCacheEntries
+		}
+	}
+	if c.conditional != nil {
+		c.conditional.store = c.cacheBackend
+		if c.conditional.store == nil {
+			c.conditional.store = NewLRUCache(defaultCacheEntries)
+		}
+	}
+	switch {
+	case c.httpClient == nil && c.noRetry:
+		c.httpClient = &http.Client{
+			Transport: c.attemptTransport(c.newBaseTransport()),
+		}
+	case c.httpClient == nil:
+		policy := c.retryPolicy
+		if policy == nil {
+			policy = DefaultRetryPolicy{
+				Backoff:                  c.backoff,
+				WaitAfterTooManyRequests: c.defaultWaitAfterTooManyRequests,
+			}
+		}
+		opts := []RetryOption{
+			retryWithLogFunc(c.logger.Warn),
+			RetryWithPolicy(policy),
+			RetryWithMaxElapsed(c.maxRetryElapsed),
+			RetryWithOnRetry(c.onRetry),
+			RetryWithAttemptTimeout(c.attemptTimeout),
+		}
+		if c.clock != nil {
+			opts = append(opts, RetryWithClock(c.clock))
+		}
+		transport := NewRetryTransport(c.attemptTransport(c.newBaseTransport()), opts...)
+		transport.budget = c.retryBudget
+		transport.stats = c.stats
+		c.httpClient = &http.Client{
+			Transport: transport,
+		}
+	default:
+		c.wrapTransport(c.attemptTransport)
+	}
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		c.wrapTransport(c.middlewares[i])
+	}
+	if c.balancer != nil {
+		c.pool = &pool{balancer: c.balancer}
+		if c.endpoint != "" {
+			c.pool.endpoints = append(c.pool.endpoints, EndpointState{Endpoint: Endpoint{URL: c.endpoint}})
+		}
+		for _, e := range c.balancedEndpoints {
+			c.pool.endpoints = append(c.pool.endpoints, EndpointState{Endpoint: e})
+		}
+	} else if len(c.fallbackEndpoints) > 0 {
+		c.failover = &failover{
+			endpoints:     append([]string{c.endpoint}, c.fallbackEndpoints...),
+			probeInterval: c.probeInterval,
+			logger:        c.logger.Warn,
+		}
+	}
+	if c.hedgeDelay > 0 {
+		c.wrapTransport(func(base http.RoundTripper) http.RoundTripper {
+			return &hedgingTransport{transport: base, delay: c.hedgeDelay, logger: c.logger.Debug}
+		})
+	}
+	if c.circuitBreaker != nil {
+		c.wrapTransport(func(base http.RoundTripper) http.RoundTripper {
+			c.breaker = newBreakerTransport(base, *c.circuitBreaker, c.logger.Warn)
+			return c.breaker
+		})
 	}
 	return c
 }
 
-func (c *Client) logDebugf(format string, args ...interface{}) {
-	c.logDebug(fmt.Sprintf(format, args...))
+// wrapTransport replaces the transport of the HTTP client with wrap(it),
+// on a copy so an http.Client given with WithHTTPClient is not modified.
+func (c *Client) wrapTransport(wrap func(http.RoundTripper) http.RoundTripper) {
+	base := c.httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	httpClient := *c.httpClient
+	httpClient.Transport = wrap(base)
+	c.httpClient = &httpClient
+}
+
+// attemptTransport wraps base with the layers applied to every attempt,
+// retries included.
+func (c *Client) attemptTransport(base http.RoundTripper) http.RoundTripper {
+	if c.wireDump != nil {
+		base = &wireDumpTransport{transport: base, dump: c.wireDump}
+	}
+	base = &meterTransport{transport: base, hooks: c.hooks}
+	if c.har != nil {
+		base = &harTransport{transport: base, recorder: c.har}
+	}
+	// The signer comes first so it sees the final headers.
+	if c.signer != nil {
+		base = &signingTransport{transport: base, signer: c.signer}
+	}
+	if c.spanExtractor != nil {
+		base = &traceTransport{transport: base, extract: c.spanExtractor, b3: c.b3Headers}
+	}
+	if c.decoders != nil {
+		base = newDecompressionTransport(base, c.decoders)
+	}
+	if c.cookieJar != nil {
+		base = &cookieTransport{transport: base, jar: c.cookieJar}
+	}
+	if c.adaptiveConcurrency != nil {
+		base = newAdaptiveTransport(base, *c.adaptiveConcurrency, c.logger.Warn)
+	}
+	if c.rateLimitHeaders != nil {
+		base = newRateLimitTransport(base, *c.rateLimitHeaders, c.logger.Warn)
+	}
+	if c.rateLimiter != nil {
+		base = &tokenBucketTransport{transport: base, bucket: c.rateLimiter}
+	}
+	return base
+}
+
+// logDebugw logs a debug message with alternating keys and values, only
+// if debug logging is enabled. Values should be cheap to pass, e.g. a
+// buffer's Bytes rather than its String, as they are only formatted by
+// the logger.
+func (c *Client) logDebugw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	if !c.debugOn(ctx) {
+		return
+	}
+	c.loggerFor(ctx).Debug(msg, keysAndValues...)
+}
+
+func (c *Client) logErrorw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	c.loggerFor(ctx).Error(msg, keysAndValues...)
 }
 
-func (c *Client) logErrorf(format string, args ...interface{}) {
-	c.logErr(fmt.Sprintf(format, args...))
+func (c *Client) logWarnw(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	c.loggerFor(ctx).Warn(msg, keysAndValues...)
 }
 
-func (c *Client) logWarnf(format string, args ...interface{}) {
-	c.logWarn(fmt.Sprintf(format, args...))
+// loggerFor returns the logger for a request made with ctx: the one
+// attached with WithLogger, or the client's.
+func (c *Client) loggerFor(ctx context.Context) Logger {
+	if l := contextLogger(ctx); l != nil {
+		return l
+	}
+	return c.logger
+}
+
+// debugOn reports whether debug messages of a request made with ctx are
+// logged.
+func (c *Client) debugOn(ctx context.Context) bool {
+	enabled := c.debugEnabled
+	if l := contextLogger(ctx); l != nil {
+		enabled = debugEnabled(l)
+	}
+	if !enabled || c.debugSampleRate <= 0 {
+		return enabled
+	}
+	info, ok := ctx.Value(runInfoKey{}).(*runInfo)
+	return !ok || info.debugSampled
 }
 
 // Run executes the query and unmarshals the response from the data field
@@ -65,63 +330,186 @@ func (c *Client) logWarnf(format string, args ...interface{}) {
 // If the request fails or the server returns an error, the first error
 // will be returned.
 func (c *Client) Run(ctx context.Context, req *Request, resp interface{}) error {
+	start := time.Now()
+	ctx, info := c.begin(ctx, req)
+	err := c.run(ctx, req, resp)
+	c.finish(ctx, req, info, start, err)
+	return err
+}
+
+func (c *Client) run(ctx context.Context, req *Request, resp interface{}) error {
+	if ttl := c.cacheTTL(req); ttl > 0 {
+		return c.runCached(ctx, req, resp, ttl)
+	}
+	var err error
+	if c.entities != nil && !req.hasFiles() {
+		err = c.runNormalized(ctx, req, resp)
+	} else {
+		err = c.send(ctx, req, resp)
+	}
+	if err == nil {
+		c.invalidate(ctx, req)
+	}
+	return err
+}
+
+// send sends req, in a batch with WithAutoBatching.
+func (c *Client) send(ctx context.Context, req *Request, resp interface{}) error {
+	if c.autoBatch != nil && c.autoBatch.accepts(req) {
+		return c.autoBatch.run(ctx, req, resp)
+	}
+	return c.runRequest(ctx, req, resp)
+}
+
+// runRequest sends req on its own.
+func (c *Client) runRequest(ctx context.Context, req *Request, resp interface{}) error {
+	ctx, cancel := req.context(ctx)
+	defer cancel()
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
 	}
-	if len(req.files) > 0 && !c.useMultipartForm {
-		return errors.New("cannot send files with PostFields option")
+	release, err := c.enqueue(ctx, req)
+	if err != nil {
+		return err
 	}
-	if c.useMultipartForm {
-		return c.runWithPostFields(ctx, req, resp)
+	defer release()
+	if ctx, err = c.idempotencyContext(ctx); err != nil {
+		return err
 	}
-	return c.runWithJSON(ctx, req, resp)
+	return c.withEndpoints(ctx, req, func(endpoint string) error {
+		r, err := c.newHTTPRequest(ctx, req, endpoint)
+		if err != nil {
+			return err
+		}
+		ctx := c.mutationRetryContext(ctx, req, r)
+		ctx = c.hedgeContext(ctx, req)
+		if c.usesMultipart(req) {
+			return c.executeMultipart(ctx, r, resp)
+		}
+		if c.conditional != nil && req.OperationType() == OperationQuery {
+			return c.executeConditional(ctx, req, r, resp)
+		}
+		return c.execute(ctx, r, resp)
+	})
 }
 
-func (c *Client) runWithJSON(ctx context.Context, req *Request, resp interface{}) error {
-	var requestBody bytes.Buffer
-	requestBodyObj := struct {
-		Query     string                 `json:"query"`
-		Variables map[string]interface{} `json:"variables"`
-	}{
-		Query:     req.q,
-		Variables: req.vars,
+// usesMultipart reports whether req is sent as multipart/form-data.
+func (c *Client) usesMultipart(req *Request) bool {
+	return c.useMultipartForm || (c.autoMultipart && req.hasFiles())
+}
+
+// newHTTPRequest builds the HTTP request for req to endpoint in the wire
+// format the client is configured with.
+func (c *Client) newHTTPRequest(ctx context.Context, req *Request, endpoint string) (*http.Request, error) {
+	endpoint = unixEndpoint(endpoint)
+	if req.hasFiles() && !c.useMultipartForm && !c.autoMultipart {
+		return nil, errors.New("cannot send files with PostFields option")
 	}
-	if err := json.NewEncoder(&requestBody).Encode(requestBodyObj); err != nil {
-		return fmt.Errorf("encode body: %w", err)
+	if err := c.checkPersisted(req); err != nil {
+		return nil, err
 	}
-	c.logDebugf(">> variables: %v", req.vars)
-	c.logDebugf(">> query: %s", req.q)
-	gr := &graphResponse{
-		Data: resp,
+	if c.usesMultipart(req) {
+		return c.newMultipartRequest(ctx, req, endpoint)
 	}
-	r, err := http.NewRequest(http.MethodPost, c.endpoint, &requestBody)
+	if c.useGraphQLBody {
+		if c.requirePersisted {
+			return nil, errGraphQLBodyPersisted
+		}
+		return c.newGraphQLBodyRequest(ctx, req, endpoint)
+	}
+	if r, ok, err := c.newGetRequest(ctx, req, endpoint); err != nil {
+		return nil, err
+	} else if ok {
+		return r, nil
+	}
+	return c.newJSONRequest(ctx, req, endpoint)
+}
+
+func (c *Client) newJSONRequest(ctx context.Context, req *Request, endpoint string) (*http.Request, error) {
+	env := envelopePool.Get().(*requestEnvelope)
+	*env = c.envelope(req)
+	requestBody, err := encodeBody(env, len(req.q)+len(req.opName)+envelopeSize)
+	*env = requestEnvelope{}
+	envelopePool.Put(env)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	c.logDebugRequest(ctx, req)
+	body, compressed, err := c.compressBody(ctx, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
 	}
 	r.Close = c.closeReq
+	if compressed {
+		r.Header.Set("Content-Encoding", "gzip")
+	}
 	r.Header.Set("Content-Type", "application/json; charset=utf-8")
 	r.Header.Set("Accept", "application/json; charset=utf-8")
-	for key, values := range req.Header {
-		for _, value := range values {
-			r.Header.Add(key, value)
-		}
+	if err := c.setHeaders(ctx, r, req); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// envelopeSize is about the size of the JSON body of a request beyond its
+// query and operation name, for the usual handful of variables.
+const envelopeSize = 128
+
+// requestEnvelope is the JSON body of a GraphQL request.
+type requestEnvelope struct {
+	Query         string                 `json:"query,omitempty"`
+	ID            string                 `json:"id,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// envelope builds the request body for req, replacing the query with its
+// persisted ID when the operation is in the client's manifest.
+func (c *Client) envelope(req *Request) requestEnvelope {
+	env := requestEnvelope{
+		Query:         req.q,
+		OperationName: req.opName,
+		Variables:     req.vars,
+		Extensions:    req.extensions,
+	}
+	if id, ok := c.persistedID(req); ok {
+		env.Query = ""
+		env.ID = id
 	}
-	c.logDebugf(">> headers: %v", r.Header)
+	return env
+}
 
+// execute sends r and decodes the GraphQL response envelope into resp.
+// Non-200 responses are reported as errors without being decoded.
+func (c *Client) execute(ctx context.Context, r *http.Request, resp interface{}) error {
 	r = r.WithContext(ctx)
 	buf, status, err := c.doRequest(r)
 	if err != nil {
 		return err
 	}
+	defer putBuffer(buf)
+	return c.decodeResponse(ctx, buf, status, resp)
+}
+
+// decodeResponse decodes buf, the body of a response with status, into
+// resp.
+func (c *Client) decodeResponse(ctx context.Context, buf *bytes.Buffer, status int, resp interface{}) error {
+	gr := &graphResponse{
+		Data: resp,
+	}
 	if status != http.StatusOK {
-		c.logErrorf("server returned a non-200 status code: %v", status)
-		c.logErrorf("<< %s", buf.String())
-		return fmt.Errorf("graphql: server returned a non-200 status code: %v", status)
+		c.logErrorw(ctx, "server returned a non-200 status code", "status", status, "body", c.debugBody(buf.Bytes()))
+		return &StatusError{StatusCode: status}
 	}
-	c.logDebugf("<< %s", buf.String())
-	if err := json.NewDecoder(&buf).Decode(&gr); err != nil {
+	c.logDebugw(ctx, "<< response", "status", status, "body", c.debugBody(buf.Bytes()))
+	if err := json.NewDecoder(buf).Decode(&gr); err != nil {
 		return fmt.Errorf("decoding response: %w", err)
 	}
 	if len(gr.Errors) > 0 {
@@ -131,99 +519,117 @@ func (c *Client) runWithJSON(ctx context.Context, req *Request, resp interface{}
 	return nil
 }
 
-func (c *Client) doRequest(r *http.Request) (bytes.Buffer, int, error) {
-	var buf bytes.Buffer
-	res, err := c.httpClient.Do(r)
+func (c *Client) newGraphQLBodyRequest(ctx context.Context, req *Request, endpointURL string) (*http.Request, error) {
+	endpoint, err := url.Parse(endpointURL)
 	if err != nil {
-		c.logErrorf(">> error: %v", err)
-		return buf, http.StatusInternalServerError, err
+		return nil, fmt.Errorf("parse endpoint: %w", err)
 	}
-	defer func(Body io.ReadCloser) {
-		er := Body.Close()
-		if er != nil {
-			fmt.Println(er)
-		}
-	}(res.Body)
-	if _, err := io.Copy(&buf, res.Body); err != nil {
-		return buf, res.StatusCode, fmt.Errorf("reading body: %w", err)
-	}
-	return buf, res.StatusCode, nil
-}
-
-func (c *Client) runWithPostFields(ctx context.Context, req *Request, resp interface{}) error {
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
-	if err := writer.WriteField("query", req.q); err != nil {
-		return fmt.Errorf("write query field: %w", err)
-	}
-	var variablesBuf bytes.Buffer
+	params := endpoint.Query()
 	if len(req.vars) > 0 {
-		variablesField, err := writer.CreateFormField("variables")
+		variables, err := json.Marshal(req.vars)
 		if err != nil {
-			return fmt.Errorf("create variables field: %w", err)
-		}
-		if err := json.NewEncoder(io.MultiWriter(variablesField, &variablesBuf)).Encode(req.vars); err != nil {
-			return fmt.Errorf("encode variables: %w", err)
+			return nil, fmt.Errorf("encode variables: %w", err)
 		}
+		params.Set("variables", string(variables))
+	}
+	if req.opName != "" {
+		params.Set("operationName", req.opName)
 	}
-	for i := range req.files {
-		part, err := writer.CreateFormFile(req.files[i].Field, req.files[i].Name)
+	if len(req.extensions) > 0 {
+		extensions, err := json.Marshal(req.extensions)
 		if err != nil {
-			return fmt.Errorf("create form file: %w", err)
+			return nil, fmt.Errorf("encode extensions: %w", err)
 		}
-		if _, err := io.Copy(part, req.files[i].R); err != nil {
-			return fmt.Errorf("preparing file: %w", err)
-		}
-	}
-	if err := writer.Close(); err != nil {
-		return fmt.Errorf("close writer: %w", err)
+		params.Set("extensions", string(extensions))
 	}
-	c.logDebugf(">> variables: %s", variablesBuf.String())
-	c.logDebugf(">> files: %d", len(req.files))
-	c.logDebugf(">> query: %s", req.q)
-	gr := &graphResponse{
-		Data: resp,
+	endpoint.RawQuery = params.Encode()
+	c.logDebugRequest(ctx, req)
+	body, compressed, err := c.compressBody(ctx, []byte(req.q))
+	if err != nil {
+		return nil, err
 	}
-	r, err := http.NewRequest(http.MethodPost, c.endpoint, &requestBody)
+	r, err := http.NewRequest(http.MethodPost, endpoint.String(), bytes.NewReader(body))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	r.Close = c.closeReq
-	r.Header.Set("Content-Type", writer.FormDataContentType())
+	if compressed {
+		r.Header.Set("Content-Encoding", "gzip")
+	}
+	r.Header.Set("Content-Type", "application/graphql; charset=utf-8")
 	r.Header.Set("Accept", "application/json; charset=utf-8")
+	if err := c.setHeaders(ctx, r, req); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// setHeaders copies the request headers onto r and attaches an
+// Idempotency-Key when the client was configured to do so.
+func (c *Client) setHeaders(ctx context.Context, r *http.Request, req *Request) error {
 	for key, values := range req.Header {
 		for _, value := range values {
 			r.Header.Add(key, value)
 		}
 	}
-	c.logDebugf(">> headers: %v", r.Header)
-	r = r.WithContext(ctx)
+	if c.userAgent != "" && r.Header.Get("User-Agent") == "" {
+		r.Header.Set("User-Agent", c.userAgent)
+	}
+	if c.useIdempotencyKey && r.Header.Get(IdempotencyKeyHeader) == "" {
+		key, _ := ctx.Value(idempotencyKeyKey{}).(string)
+		if key == "" {
+			var err error
+			if key, err = newIdempotencyKey(); err != nil {
+				return fmt.Errorf("generate idempotency key: %w", err)
+			}
+		}
+		r.Header.Set(IdempotencyKeyHeader, key)
+	}
+	c.logDebugw(ctx, ">> headers", "headers", r.Header)
+	return nil
+}
+
+// doRequest sends r and reads the body of the response into a buffer from
+// the pool, which the caller returns with putBuffer once done with it.
+func (c *Client) doRequest(r *http.Request) (*bytes.Buffer, int, error) {
+	buf, _, status, err := c.doRequestHeader(r)
+	return buf, status, err
+}
+
+// doRequestHeader is like doRequest, also returning the header of the
+// response.
+func (c *Client) doRequestHeader(r *http.Request) (*bytes.Buffer, http.Header, int, error) {
 	res, err := c.httpClient.Do(r)
 	if err != nil {
-		return err
+		c.logErrorw(r.Context(), ">> request failed", "host", r.URL.Host, "error", err)
+		return nil, nil, http.StatusInternalServerError, err
 	}
 	defer func(Body io.ReadCloser) {
 		er := Body.Close()
 		if er != nil {
-			fmt.Println(er)
+			c.reportError(r.Context(), fmt.Errorf("close response body: %w", er))
 		}
 	}(res.Body)
-	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, res.Body); err != nil {
-		return fmt.Errorf("reading body: %w", err)
-	}
-	c.logDebugf("<< %s", buf.String())
-	if err := json.NewDecoder(&buf).Decode(&gr); err != nil {
-		if res.StatusCode != http.StatusOK {
-			return fmt.Errorf("graphql: server returned a non-200 status code: %v", res.StatusCode)
-		}
-		return fmt.Errorf("decoding response: %w", err)
+	buf := getBuffer()
+	if _, err := io.Copy(buf, res.Body); err != nil {
+		putBuffer(buf)
+		return nil, res.Header, res.StatusCode, fmt.Errorf("reading body: %w", err)
 	}
-	if len(gr.Errors) > 0 {
-		// return first error
-		return gr.Errors[0]
+	return buf, res.Header, res.StatusCode, nil
+}
+
+// encodeBody encodes v as the JSON body of a request, expected to be about
+// size bytes long. It is encoded in a buffer from the pool, the body being
+// a copy of the exact size, since the transport may still read it after
+// the request returned.
+func encodeBody(v interface{}, size int) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.Grow(size)
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return nil, fmt.Errorf("encode body: %w", err)
 	}
-	return nil
+	return bytes.Clone(buf.Bytes()), nil
 }
 
 // WithHTTPClient specifies the underlying http.Client to use when
@@ -236,6 +642,39 @@ func WithHTTPClient(httpclient *http.Client) ClientOption {
 	}
 }
 
+// Doer sends HTTP requests, like *http.Client.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// WithDoer sends requests with d instead of an http.Client, e.g. a
+// retrying or instrumented client of another package, or a fake in tests.
+// Like with WithHTTPClient, the retry options of the default HTTP client
+// have no effect, while the layers wrapping the transport, such as
+// hedging or the circuit breaker, are applied around d.
+//
+//	NewClient(endpoint, WithDoer(instrumentedClient))
+func WithDoer(d Doer) ClientOption {
+	return func(client *Client) {
+		client.httpClient = &http.Client{
+			Transport: doerTransport{doer: d},
+			// d follows redirects itself.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+}
+
+// doerTransport adapts a Doer to http.RoundTripper.
+type doerTransport struct {
+	doer Doer
+}
+
+func (t doerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.doer.Do(req)
+}
+
 // UseMultipartForm uses multipart/form-data and activates support for
 // files.
 func UseMultipartForm() ClientOption {
@@ -244,6 +683,24 @@ func UseMultipartForm() ClientOption {
 	}
 }
 
+// WithAutoMultipart sends requests that have files as multipart/form-data
+// and all other requests with the client's regular wire format, instead
+// of failing when files are used without UseMultipartForm.
+func WithAutoMultipart() ClientOption {
+	return func(client *Client) {
+		client.autoMultipart = true
+	}
+}
+
+// UseGraphQLContentType sends the raw query as the request body with
+// Content-Type: application/graphql. Variables are passed as a JSON
+// encoded "variables" URL query parameter.
+func UseGraphQLContentType() ClientOption {
+	return func(client *Client) {
+		client.useGraphQLBody = true
+	}
+}
+
 // ImmediatelyCloseReqBody will close the req body immediately after each request body is ready
 func ImmediatelyCloseReqBody() ClientOption {
 	return func(client *Client) {
@@ -251,15 +708,99 @@ func ImmediatelyCloseReqBody() ClientOption {
 	}
 }
 
+// UseIdempotencyKey attaches a freshly generated Idempotency-Key header
+// to every request that does not already carry one. The key is generated
+// once per Run, RunStream or batch, so its retries, the fallback endpoints
+// and the request sent again after refreshing the credentials get the
+// same key and servers that support it won't apply a mutation twice.
+func UseIdempotencyKey() ClientOption {
+	return func(client *Client) {
+		client.useIdempotencyKey = true
+	}
+}
+
 func WithWaitAfterTooManyRequests(duration time.Duration) ClientOption {
 	return func(client *Client) {
 		client.defaultWaitAfterTooManyRequests = duration
 	}
 }
 
+// WithBackoff sets the exponential backoff with full jitter used between
+// retries of 502, 503 and 504 responses by the default HTTP client.
+func WithBackoff(initial time.Duration, multiplier float64, maxDelay time.Duration) ClientOption {
+	return func(client *Client) {
+		client.backoff = Backoff{Initial: initial, Multiplier: multiplier, Max: maxDelay}
+	}
+}
+
+// WithRetryPolicy replaces the rules deciding which responses the default
+// HTTP client retries and how long it waits in between, for providers
+// with their own retry semantics. It takes precedence over WithBackoff
+// and WithWaitAfterTooManyRequests.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(client *Client) {
+		client.retryPolicy = policy
+	}
+}
+
+// WithOnRetry calls hook before each retry of the default HTTP client,
+// e.g. to emit metrics or structured logs. Returning an error from hook
+// aborts the request with that error.
+func WithOnRetry(hook RetryHook) ClientOption {
+	return func(client *Client) {
+		client.onRetry = hook
+	}
+}
+
+// WithoutRetry makes the default HTTP client send each request once,
+// without the retry transport, for callers handling resilience at a
+// higher layer that need the raw errors and latencies. The retry options
+// have no effect then.
+func WithoutRetry() ClientOption {
+	return func(client *Client) {
+		client.noRetry = true
+	}
+}
+
+// WithAttemptTimeout bounds each attempt of the default HTTP client,
+// reading the response body included, so a hung attempt leaves time for
+// retries within the deadline of the request. Attempts that time out are
+// retried by DefaultRetryPolicy.
+func WithAttemptTimeout(d time.Duration) ClientOption {
+	return func(client *Client) {
+		client.attemptTimeout = d
+	}
+}
+
+// WithClock replaces the clock the default HTTP client uses to wait
+// between retries and to measure WithMaxRetryElapsed, so tests can run
+// backoff schedules without real sleeps.
+func WithClock(clock Clock) ClientOption {
+	return func(client *Client) {
+		client.clock = clock
+	}
+}
+
+// WithMaxRetryElapsed bounds the wall-clock time the default HTTP client
+// spends on a request across all its attempts. A retry is not made when
+// waiting for it would exceed d, whatever Retry-After asks for; the last
+// response is returned instead.
+func WithMaxRetryElapsed(d time.Duration) ClientOption {
+	return func(client *Client) {
+		client.maxRetryElapsed = d
+	}
+}
+
 func WithLogDebug(logger func(s string)) ClientOption {
 	return func(client *Client) {
 		client.logDebug = logger
+		client.logDebugSet = logger != nil
+	}
+}
+
+func WithLogInfo(logger func(s string)) ClientOption {
+	return func(client *Client) {
+		client.logInfo = logger
 	}
 }
 
@@ -279,6 +820,16 @@ func WithLogWarn(logger func(s string)) ClientOption {
 // modify the behaviour of the Client.
 type ClientOption func(*Client)
 
+// StatusError is returned when the server answers with a non-200 status
+// code.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("graphql: server returned a non-200 status code: %v", e.StatusCode)
+}
+
 type graphErr struct {
 	Message string
 }
@@ -294,9 +845,36 @@ type graphResponse struct {
 
 // Request is a GraphQL request.
 type Request struct {
-	q     string
-	vars  map[string]interface{}
-	files []File
+	q       string
+	opName  string
+	vars    map[string]interface{}
+	files   []File
+	timeout time.Duration
+
+	// op is the operation of q to execute, selected once q or opName is
+	// set rather than on every call to OperationType and OperationName.
+	op operation
+
+	// endpoint overrides the endpoint of the client when set.
+	endpoint string
+
+	// queueTimeout overrides the queue timeout of the client when
+	// hasQueueTimeout is set.
+	queueTimeout    time.Duration
+	hasQueueTimeout bool
+
+	extensions map[string]interface{}
+
+	// maxRetries is the retry limit of this request when hasMaxRetries
+	// is set.
+	maxRetries    int
+	hasMaxRetries bool
+	retryPolicy   RetryPolicy
+
+	// cacheTTL overrides the cache TTL of the client when hasCacheTTL is
+	// set.
+	cacheTTL    time.Duration
+	hasCacheTTL bool
 
 	// Header represent any request headers that will be set
 	// when the request is made.
@@ -309,6 +887,7 @@ func NewRequest(q string) *Request {
 		q:      q,
 		Header: make(map[string][]string),
 	}
+	req.op, _ = selectOperation(q, "")
 	return req
 }
 
@@ -325,6 +904,77 @@ func (req *Request) Vars() map[string]interface{} {
 	return req.vars
 }
 
+// SetExtension sets a top-level extension sent in the "extensions" entry
+// of the request envelope alongside the query and variables, such as
+// gateway specific tracing flags.
+func (req *Request) SetExtension(name string, value interface{}) {
+	if req.extensions == nil {
+		req.extensions = make(map[string]interface{})
+	}
+	req.extensions[name] = value
+}
+
+// Extensions gets the extensions for this Request.
+func (req *Request) Extensions() map[string]interface{} {
+	return req.extensions
+}
+
+// SetMaxRetries overrides the number of times the default HTTP client
+// retries this request, e.g. zero for a non-idempotent mutation.
+func (req *Request) SetMaxRetries(n int) {
+	if n < 0 {
+		n = 0
+	}
+	req.maxRetries = n
+	req.hasMaxRetries = true
+}
+
+// SetEndpoint sends this request to endpoint instead of the endpoint of
+// the client, e.g. to route it to another region or a canary, bypassing
+// fallback endpoints and load balancing.
+func (req *Request) SetEndpoint(endpoint string) {
+	req.endpoint = endpoint
+}
+
+// Endpoint gets the endpoint this request overrides the client's with,
+// empty if none.
+func (req *Request) Endpoint() string {
+	return req.endpoint
+}
+
+// SetQueueTimeout overrides how long this request may wait in the queue of
+// a client created with WithMaxConcurrency; zero waits as long as the
+// context allows.
+func (req *Request) SetQueueTimeout(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	req.queueTimeout = d
+	req.hasQueueTimeout = true
+}
+
+// SetRetryPolicy overrides the retry policy of the default HTTP client
+// for this request.
+func (req *Request) SetRetryPolicy(policy RetryPolicy) {
+	req.retryPolicy = policy
+}
+
+// context derives the context a request is run with, applying its
+// timeout and retry overrides.
+func (req *Request) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if req.hasMaxRetries || req.retryPolicy != nil {
+		o := retryOverride{maxRetries: -1, policy: req.retryPolicy}
+		if req.hasMaxRetries {
+			o.maxRetries = req.maxRetries
+		}
+		ctx = context.WithValue(ctx, retryOverrideKey{}, o)
+	}
+	if req.timeout > 0 {
+		return context.WithTimeout(ctx, req.timeout)
+	}
+	return ctx, func() {}
+}
+
 // Files gets the files in this request.
 func (req *Request) Files() []File {
 	return req.files
@@ -335,20 +985,68 @@ func (req *Request) Query() string {
 	return req.q
 }
 
+// SetOperationName sets the name of the operation to execute when the
+// query document contains several operations.
+func (req *Request) SetOperationName(name string) {
+	req.opName = name
+	req.op, _ = selectOperation(req.q, name)
+}
+
+// OperationName gets the operation name of this request. When no name
+// was set explicitly, the name of the first operation in the document
+// is returned.
+func (req *Request) OperationName() string {
+	if req.opName != "" {
+		return req.opName
+	}
+	return req.op.name
+}
+
+// OperationType gets the type of the operation that will be executed:
+// OperationQuery, OperationMutation or OperationSubscription.
+// An empty string is returned if the document can't be understood.
+func (req *Request) OperationType() string {
+	return req.op.typ
+}
+
 // File sets a file to upload.
 // Files are only supported with a Client that was created with
 // the UseMultipartForm option.
-func (req *Request) File(fieldName, filename string, r io.Reader) {
-	req.files = append(req.files, File{
+// The fieldName is the path of the Upload variable the file fills, such
+// as "avatar" or "variables.input.files.0".
+func (req *Request) File(fieldName, filename string, r io.Reader, opts ...FileOption) {
+	f := File{
 		Field: fieldName,
 		Name:  filename,
 		R:     r,
-	})
+	}
+	for _, optionFunc := range opts {
+		optionFunc(&f)
+	}
+	req.files = append(req.files, f)
 }
 
 // File represents a file to upload.
 type File struct {
+	// Field is the variable path the file is mapped to.
 	Field string
 	Name  string
 	R     io.Reader
+
+	// ContentType is the MIME type of the file part. It defaults to
+	// application/octet-stream.
+	ContentType string
+	// Header holds additional headers of the file part.
+	Header textproto.MIMEHeader
+
+	// Size is the length of the file in bytes. When zero it is detected
+	// from the reader if possible.
+	Size int64
+	// Progress, if set, is called as the file is being sent.
+	Progress ProgressFunc
+	// Checksum, if set, is the algorithm of the digest sent with the file.
+	Checksum ChecksumAlgorithm
+
+	// digest is the precomputed Content-Digest value of the file.
+	digest string
 }
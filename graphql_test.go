@@ -0,0 +1,191 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// staticDoer answers every request with body, after reading the request.
+type staticDoer struct {
+	body string
+}
+
+func (d staticDoer) Do(r *http.Request) (*http.Response, error) {
+	io.Copy(io.Discard, r.Body)
+	r.Body.Close()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(d.body)),
+	}, nil
+}
+
+// doerFunc adapts a function to Doer.
+type doerFunc func(*http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestDoer(t *testing.T) {
+	var resp struct{ A string }
+	client := NewClient("http://example.com/graphql", WithDoer(staticDoer{body: `{"data":{"a":"done"}}`}))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.A != "done" {
+		t.Errorf("got %q", resp.A)
+	}
+	calls := 0
+	client = NewClient("http://example.com/graphql", WithDoer(doerFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		return response(http.StatusServiceUnavailable), nil
+	})))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err == nil {
+		t.Error("expected an error")
+	}
+	if calls != 1 {
+		t.Errorf("got %d calls, want the retries left to the Doer", calls)
+	}
+}
+
+func TestRequestOperation(t *testing.T) {
+	req := NewRequest("query A { a } mutation B { b }")
+	if req.OperationType() != OperationQuery || req.OperationName() != "A" {
+		t.Errorf("got %s %s, want the first operation", req.OperationType(), req.OperationName())
+	}
+	req.SetOperationName("B")
+	if req.OperationType() != OperationMutation || req.OperationName() != "B" {
+		t.Errorf("got %s %s, want the named operation", req.OperationType(), req.OperationName())
+	}
+	req.SetOperationName("C")
+	if req.OperationType() != "" {
+		t.Errorf("got %q, want no type for a missing operation", req.OperationType())
+	}
+}
+
+func TestGraphQLContentType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if ct := r.Header.Get("Content-Type"); ct != "application/graphql; charset=utf-8" {
+			t.Errorf("got Content-Type %q", ct)
+		}
+		params := r.URL.Query()
+		if string(body) != "query Foo($id: ID) { a }" || params.Get("variables") != `{"id":"1"}` || params.Get("operationName") != "Foo" {
+			t.Errorf("got body %q and parameters %v", body, params)
+		}
+		io.WriteString(w, `{"data":{"a":1}}`)
+	}))
+	defer srv.Close()
+	req := NewRequest("query Foo($id: ID) { a }")
+	req.Var("id", "1")
+	req.SetOperationName("Foo")
+	var resp struct{ A int }
+	if err := NewClient(srv.URL, UseGraphQLContentType()).Run(context.Background(), req, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.A != 1 {
+		t.Errorf("got %+v", resp)
+	}
+}
+
+func TestRequestExtensions(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Extensions json.RawMessage }
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			json.Unmarshal([]byte(r.FormValue("operations")), &body)
+		} else {
+			json.NewDecoder(r.Body).Decode(&body)
+		}
+		got = append(got, string(body.Extensions))
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, WithAutoMultipart())
+	query := NewRequest("{ a }")
+	upload := NewRequest("mutation ($f: Upload!) { upload(file: $f) }")
+	upload.File("f", "a.txt", strings.NewReader("x"))
+	for _, req := range []*Request{query, upload} {
+		req.SetExtension("persistedQuery", map[string]interface{}{"version": 1})
+		req.SetExtension("tracing", true)
+		if err := client.Run(context.Background(), req, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := `{"persistedQuery":{"version":1},"tracing":true}`
+	if len(got) != 2 || got[0] != want || got[1] != want {
+		t.Errorf("got extensions %q, want %s in the JSON and multipart bodies", got, want)
+	}
+}
+
+// benchmarkQuery is a query of a typical size.
+var benchmarkQuery = "query GetUser($id: ID!) { user(id: $id) { id name " + strings.Repeat("field ", 200) + "} }"
+
+func BenchmarkNewJSONRequest(b *testing.B) {
+	client := NewClient("http://example.com/graphql")
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		req := NewRequest(benchmarkQuery)
+		req.Var("id", "1")
+		if _, err := client.newJSONRequest(ctx, req, client.endpoint); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRequestOperation parses the operation of a request and reads
+// it as often as Run does.
+func BenchmarkRequestOperation(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		req := NewRequest(benchmarkQuery)
+		for j := 0; j < 10; j++ {
+			if req.OperationType() != OperationQuery || req.OperationName() != "GetUser" {
+				b.Fatal("wrong operation")
+			}
+		}
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	body := `{"data":{"user":{"id":"1","name":"` + strings.Repeat("n", 2000) + `"}}}`
+	client := NewClient("http://example.com/graphql", WithDoer(staticDoer{body: body}))
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		req := NewRequest(benchmarkQuery)
+		req.Var("id", "1")
+		var resp struct {
+			User struct{ ID, Name string }
+		}
+		if err := client.Run(ctx, req, &resp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRequestEndpoint(t *testing.T) {
+	primary, primaryRequests := countingServer(http.StatusOK)
+	defer primary.Close()
+	canary, canaryRequests := countingServer(http.StatusOK)
+	defer canary.Close()
+	client := NewClient(primary.URL, WithLoadBalancing(RoundRobin(), Endpoint{URL: primary.URL}))
+	req := NewRequest("{ a }")
+	req.SetEndpoint(canary.URL)
+	if err := client.Run(context.Background(), req, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if canaryRequests.Load() != 1 || primaryRequests.Load() != 1 {
+		t.Errorf("got %d requests to the canary and %d to the primary, want 1 each", canaryRequests.Load(), primaryRequests.Load())
+	}
+}
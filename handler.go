@@ -0,0 +1,102 @@
+package graphql
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// WithHandler makes the default HTTP client serve requests with h in
+// process instead of sending them over the network, e.g. to test against
+// a GraphQL server handler. Requests go through the same encoding, retries
+// and other layers as over the network; the host of the endpoint is only
+// passed on to h.
+func WithHandler(h http.Handler) ClientOption {
+	return func(client *Client) {
+		client.baseTransport = handlerTransport{handler: h}
+	}
+}
+
+// handlerTransport is an http.RoundTripper serving requests with an
+// http.Handler. The response is returned as soon as the handler writes its
+// header, and its body streams what the handler writes next.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.RequestURI = req.URL.RequestURI()
+	r.RemoteAddr = "127.0.0.1:0"
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+	if r.Host == "" {
+		r.Host = req.URL.Host
+	}
+	body, pw := io.Pipe()
+	w := &pipeResponseWriter{header: make(http.Header), body: pw, ready: make(chan struct{})}
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				_ = pw.CloseWithError(fmt.Errorf("handler panic: %v", p))
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			_ = pw.Close()
+		}()
+		t.handler.ServeHTTP(w, r)
+	}()
+	select {
+	case <-w.ready:
+	case <-req.Context().Done():
+		_ = body.Close()
+		return nil, req.Context().Err()
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", w.status, http.StatusText(w.status)),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.sent,
+		Body:          body,
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+// pipeResponseWriter is the http.ResponseWriter of handlerTransport.
+type pipeResponseWriter struct {
+	header http.Header
+	body   *io.PipeWriter
+	ready  chan struct{}
+
+	once   sync.Once
+	status int
+	sent   http.Header
+}
+
+func (w *pipeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *pipeResponseWriter) WriteHeader(status int) {
+	w.once.Do(func() {
+		w.status = status
+		w.sent = w.header.Clone()
+		close(w.ready)
+	})
+}
+
+func (w *pipeResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+// Flush implements http.Flusher, writes are not buffered.
+func (w *pipeResponseWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,41 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	calls := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls++; calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var body struct{ Query string }
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"data":{"host":"`+r.Host+`","query":"`+body.Query+`"}}`)
+	})
+	client := NewClient("http://graphql.example/query", WithHandler(h), WithClock(&recordingClock{}))
+	var resp struct{ Host, Query string }
+	if err := client.Run(context.Background(), NewRequest("{ a }"), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || resp.Host != "graphql.example" || resp.Query != "{ a }" {
+		t.Errorf("got %+v after %d calls, want the handler to serve the retried request", resp, calls)
+	}
+}
+
+func TestHandlerPanic(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	client := NewClient("http://graphql.example", WithHandler(h), WithoutRetry())
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err == nil {
+		t.Error("expected an error from the panicking handler")
+	}
+}
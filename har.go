@@ -0,0 +1,275 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultHARMaxBodySize is the number of bytes of each body a HARRecorder
+// keeps unless its MaxBodySize is set.
+const DefaultHARMaxBodySize = 1 << 20
+
+// HARRecorder records the requests of a client and their responses in the
+// HTTP Archive format, to debug incidents and share reproductions. Values
+// of credential headers such as Authorization are redacted, like with
+// Request.CurlString. The zero value is ready to use.
+type HARRecorder struct {
+	// MaxBodySize is the number of bytes of each body that is kept, the
+	// rest is dropped; DefaultHARMaxBodySize if zero, none if negative.
+	MaxBodySize int
+	// RedactBody, if set, is applied to the bodies before they are
+	// recorded, e.g. to mask personal data in variables.
+	RedactBody func(contentType string, body []byte) []byte
+
+	mu      sync.Mutex
+	entries []harEntry
+}
+
+// WithHARRecorder records every attempt of the requests of the client with
+// r.
+func WithHARRecorder(r *HARRecorder) ClientOption {
+	return func(client *Client) {
+		client.har = r
+	}
+}
+
+// WriteTo writes the HAR file with the entries recorded so far.
+func (r *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	entries := append([]harEntry(nil), r.entries...)
+	r.mu.Unlock()
+	har := harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: modulePath, Version: defaultUserAgent()},
+		Entries: entries,
+	}}
+	b, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// Reset drops the entries recorded so far.
+func (r *HARRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = nil
+}
+
+func (r *HARRecorder) maxBodySize() int {
+	switch {
+	case r.MaxBodySize == 0:
+		return DefaultHARMaxBodySize
+	case r.MaxBodySize < 0:
+		return 0
+	}
+	return r.MaxBodySize
+}
+
+// body returns the recorded form of a captured body.
+func (r *HARRecorder) body(contentType string, b []byte) string {
+	if r.RedactBody != nil {
+		b = r.RedactBody(contentType, b)
+	}
+	return string(b)
+}
+
+func (r *HARRecorder) add(e harEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, e)
+}
+
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Headers     []harNameVal `json:"headers"`
+	QueryString []harNameVal `json:"queryString"`
+	PostData    *harPostData `json:"postData,omitempty"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int          `json:"status"`
+	StatusText  string       `json:"statusText"`
+	HTTPVersion string       `json:"httpVersion"`
+	Headers     []harNameVal `json:"headers"`
+	Content     harContent   `json:"content"`
+	RedirectURL string       `json:"redirectURL"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harNameVal struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harHeaders converts h, redacting credentials.
+func harHeaders(h http.Header) []harNameVal {
+	headers := []harNameVal{}
+	for name, values := range h {
+		for _, value := range values {
+			if redactedHeaders[http.CanonicalHeaderKey(name)] {
+				value = "REDACTED"
+			}
+			headers = append(headers, harNameVal{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+// milliseconds converts d to the unit of HAR timings.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// harTransport records the attempts it sends.
+type harTransport struct {
+	transport http.RoundTripper
+	recorder  *HARRecorder
+}
+
+func (t *harTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	limit := t.recorder.maxBodySize()
+	reqBody := &captureBody{limit: limit}
+	if req.Body != nil && req.Body != http.NoBody {
+		reqBody.ReadCloser = req.Body
+		req = req.Clone(req.Context())
+		req.Body = reqBody
+	}
+	start := time.Now()
+	entry := harEntry{
+		StartedDateTime: start.Format(time.RFC3339Nano),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: "HTTP/1.1",
+			Headers:     harHeaders(req.Header),
+			QueryString: []harNameVal{},
+			HeadersSize: -1,
+		},
+	}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, harNameVal{Name: name, Value: value})
+		}
+	}
+	resp, err := t.transport.RoundTrip(req)
+	wait := time.Since(start)
+	t.requestBody(&entry, req, reqBody)
+	if err != nil {
+		entry.Time = milliseconds(wait)
+		entry.Timings = harTimings{Wait: entry.Time}
+		entry.Comment = "error: " + err.Error()
+		entry.Response = harResponse{Headers: []harNameVal{}, HeadersSize: -1, BodySize: -1}
+		t.recorder.add(entry)
+		return nil, err
+	}
+	entry.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Headers:     harHeaders(resp.Header),
+		Content:     harContent{MimeType: resp.Header.Get("Content-Type")},
+		HeadersSize: -1,
+	}
+	resp.Body = &captureBody{ReadCloser: resp.Body, limit: limit, done: func(b *captureBody) {
+		total := time.Since(start)
+		entry.Time = milliseconds(total)
+		entry.Timings = harTimings{Wait: milliseconds(wait), Receive: milliseconds(total - wait)}
+		entry.Response.BodySize = b.n
+		entry.Response.Content.Size = b.n
+		entry.Response.Content.Text = t.recorder.body(entry.Response.Content.MimeType, b.buf.Bytes())
+		t.recorder.add(entry)
+	}}
+	return resp, nil
+}
+
+// requestBody records the captured request body in entry.
+func (t *harTransport) requestBody(entry *harEntry, req *http.Request, body *captureBody) {
+	if body.ReadCloser == nil {
+		return
+	}
+	contentType := req.Header.Get("Content-Type")
+	entry.Request.BodySize = body.n
+	entry.Request.PostData = &harPostData{MimeType: contentType, Text: t.recorder.body(contentType, body.buf.Bytes())}
+}
+
+// captureBody keeps the first limit bytes read from a body, and calls done
+// once when it is closed.
+type captureBody struct {
+	io.ReadCloser
+	limit int
+	buf   bytes.Buffer
+	n     int64
+	once  sync.Once
+	done  func(*captureBody)
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if room := b.limit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(n, room)])
+	}
+	return n, err
+}
+
+func (b *captureBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.done != nil {
+		b.once.Do(func() { b.done(b) })
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestHARRecorder(t *testing.T) {
+	srv, _ := cachedServer(func(int32) string { return `{"data":{"secret":"s3cr3t"}}` })
+	defer srv.Close()
+	recorder := &HARRecorder{
+		MaxBodySize: 26,
+		RedactBody: func(contentType string, body []byte) []byte {
+			return bytes.ReplaceAll(body, []byte("s3cr3t"), []byte("***"))
+		},
+	}
+	client := NewClient(srv.URL, WithHARRecorder(recorder))
+	req := NewRequest("query { secret }")
+	req.Header.Set("Authorization", "Bearer token")
+	if err := client.Run(context.Background(), req, nil); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := recorder.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var har harFile
+	if err := json.Unmarshal(buf.Bytes(), &har); err != nil {
+		t.Fatal(err)
+	}
+	if len(har.Log.Entries) != 1 {
+		t.Fatalf("got %d entries", len(har.Log.Entries))
+	}
+	e := har.Log.Entries[0]
+	if e.Request.Method != http.MethodPost || e.Request.URL != srv.URL || e.Request.PostData == nil || e.Request.PostData.Text != `{"query":"query { secret }` {
+		t.Errorf("got request %+v, want the body cut at 26 bytes", e.Request)
+	}
+	for _, h := range e.Request.Headers {
+		if h.Name == "Authorization" && h.Value != "REDACTED" {
+			t.Errorf("got Authorization %q", h.Value)
+		}
+	}
+	if e.Response.Status != http.StatusOK || e.Response.Content.Text != `{"data":{"secret":"***"` || e.Response.BodySize != 28 {
+		t.Errorf("got response %+v, want the body cut and redacted", e.Response)
+	}
+	recorder.Reset()
+	buf.Reset()
+	recorder.WriteTo(&buf)
+	if bytes.Contains(buf.Bytes(), []byte(srv.URL)) {
+		t.Error("got entries after Reset")
+	}
+}
@@ -0,0 +1,139 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WithHedging sends a second attempt of a query when the first one hasn't
+// answered after delay, and uses whichever response arrives first; the
+// other attempt is cancelled. This trims tail latency at the cost of some
+// extra load. Only query operations are hedged since they are idempotent;
+// mutations, subscriptions and uploads are always sent once.
+func WithHedging(delay time.Duration) ClientOption {
+	return func(client *Client) {
+		client.hedgeDelay = delay
+	}
+}
+
+// hedgeKey is the context key marking a request as safe to hedge.
+type hedgeKey struct{}
+
+// hedgeContext marks ctx for hedging when req is a query.
+func (c *Client) hedgeContext(ctx context.Context, req *Request) context.Context {
+	if c.hedgeDelay <= 0 || req.hasFiles() || req.OperationType() != OperationQuery {
+		return ctx
+	}
+	return context.WithValue(ctx, hedgeKey{}, true)
+}
+
+// hedgingTransport sends a second attempt of requests marked with hedgeKey
+// after delay.
+type hedgingTransport struct {
+	transport http.RoundTripper
+	delay     time.Duration
+	logger    logFunc
+}
+
+type hedgeResult struct {
+	resp    *http.Response
+	err     error
+	attempt int
+}
+
+func (t *hedgingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	hedge, _ := req.Context().Value(hedgeKey{}).(bool)
+	if !hedge || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return t.transport.RoundTrip(req)
+	}
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+	launch := func(r *http.Request) {
+		ctx, cancel := context.WithCancel(req.Context())
+		attempt := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := t.transport.RoundTrip(r.WithContext(ctx))
+			results <- hedgeResult{resp: resp, err: err, attempt: attempt}
+		}()
+	}
+	// hedgeNow sends the second attempt, if it wasn't sent yet.
+	hedgeNow := func() {
+		if len(cancels) > 1 {
+			return
+		}
+		hedged, err := rewindRequest(req)
+		if err != nil {
+			return
+		}
+		logDebugTo(req.Context(), t.logger, "sending hedged request", "delay", t.delay)
+		launch(hedged)
+	}
+	launch(req)
+	timer := time.NewTimer(t.delay)
+	defer timer.Stop()
+	var last hedgeResult
+	for done := 0; done < len(cancels); {
+		select {
+		case <-timer.C:
+			hedgeNow()
+		case res := <-results:
+			done++
+			if res.err == nil {
+				for i, cancel := range cancels {
+					if i != res.attempt {
+						cancel()
+					}
+				}
+				if pending := len(cancels) - done; pending > 0 {
+					go discardResults(results, pending)
+				}
+				res.resp.Body = &cancelOnClose{ReadCloser: res.resp.Body, cancel: cancels[res.attempt]}
+				return res.resp, nil
+			}
+			cancels[res.attempt]()
+			last = res
+			if req.Context().Err() == nil {
+				// The attempt failed, don't wait for the delay to hedge.
+				hedgeNow()
+			}
+		}
+	}
+	return last.resp, last.err
+}
+
+// rewindRequest returns a copy of req with a fresh body.
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	return r, nil
+}
+
+// discardResults closes the responses of cancelled attempts.
+func discardResults(results <-chan hedgeResult, n int) {
+	for ; n > 0; n-- {
+		res := <-results
+		drainBody(res.resp)
+	}
+}
+
+// cancelOnClose releases the context of a response once its body is
+// closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
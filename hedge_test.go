@@ -0,0 +1,61 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// hangingServer leaves its first request unanswered until it is
+// cancelled, which it reports on cancelled, and answers the others.
+func hangingServer(cancelled chan<- struct{}) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if requests.Add(1) == 1 {
+			<-r.Context().Done()
+			cancelled <- struct{}{}
+			return
+		}
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	return srv, &requests
+}
+
+func TestHedging(t *testing.T) {
+	cancelled := make(chan struct{}, 1)
+	srv, requests := hangingServer(cancelled)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithHedging(10*time.Millisecond))
+	if err := client.Run(context.Background(), NewRequest("query { a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("got %d requests, want the query hedged", requests.Load())
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Error("the slow attempt wasn't cancelled")
+	}
+}
+
+func TestHedgingQueriesOnly(t *testing.T) {
+	srv, requests := countingServer(http.StatusOK)
+	defer srv.Close()
+	slow := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		time.Sleep(50 * time.Millisecond)
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	client := NewClient(srv.URL, WithHedging(time.Millisecond), WithHTTPClient(&http.Client{Transport: slow}))
+	if err := client.Run(context.Background(), NewRequest("mutation { a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("got %d requests, want the mutation sent once", requests.Load())
+	}
+}
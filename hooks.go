@@ -0,0 +1,112 @@
+package graphql
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Hooks are called for every attempt of a request, retries and hedged
+// attempts included, for custom metrics, auditing or response inspection.
+// Nil hooks are skipped. They are called synchronously and must not read
+// or close response bodies.
+type Hooks struct {
+	// OnRequest is called before an attempt is sent.
+	OnRequest func(req *http.Request, attempt int)
+	// OnResponse is called when an attempt gets a response.
+	OnResponse func(req *http.Request, resp *http.Response, info AttemptInfo)
+	// OnError is called when an attempt fails without a response.
+	OnError func(req *http.Request, err error, info AttemptInfo)
+}
+
+// AttemptInfo describes a completed attempt.
+type AttemptInfo struct {
+	// Attempt counts the attempts of the call from one.
+	Attempt    int
+	Duration   time.Duration
+	StatusCode int
+}
+
+// WithHooks adds hooks called for every attempt of the requests of the
+// client.
+func WithHooks(hooks Hooks) ClientOption {
+	return func(client *Client) {
+		client.hooks = append(client.hooks, hooks)
+	}
+}
+
+// beforeAttempt calls the OnRequest hooks.
+func (t *meterTransport) beforeAttempt(req *http.Request, attempt int) {
+	for _, h := range t.hooks {
+		if h.OnRequest != nil {
+			h.OnRequest(req, attempt)
+		}
+	}
+}
+
+// afterAttempt calls the OnResponse or OnError hooks.
+func (t *meterTransport) afterAttempt(req *http.Request, resp *http.Response, err error, info AttemptInfo) {
+	for _, h := range t.hooks {
+		switch {
+		case err != nil && h.OnError != nil:
+			h.OnError(req, err, info)
+		case err == nil && h.OnResponse != nil:
+			h.OnResponse(req, resp, info)
+		}
+	}
+}
+
+// SubscriptionHooks are called along the lifecycle of every subscription
+// of the client, for logging, metrics or payload transformation, like
+// Hooks for requests. Nil hooks are skipped. They are called
+// synchronously, OnMessage and OnComplete from the goroutine delivering
+// the events of the subscription.
+type SubscriptionHooks struct {
+	// OnSubscribe is called before a subscription starts, and may modify
+	// its request. Returning an error fails Subscribe with it.
+	OnSubscribe func(ctx context.Context, req *Request) error
+	// OnMessage is called with each event of a subscription before it is
+	// delivered, and returns the event delivered in its place, e.g. with
+	// transformed data.
+	OnMessage func(req *Request, msg SubscriptionMessage) SubscriptionMessage
+	// OnComplete is called once a subscription ended, with its last
+	// message telling how.
+	OnComplete func(req *Request, msg SubscriptionMessage)
+}
+
+// WithSubscriptionHooks adds hooks called along the lifecycle of the
+// subscriptions of the client. Hooks added first are called first.
+func WithSubscriptionHooks(hooks SubscriptionHooks) ClientOption {
+	return func(client *Client) {
+		client.subscriptionHooks = append(client.subscriptionHooks, hooks)
+	}
+}
+
+// beforeSubscribe calls the OnSubscribe hooks, stopping at the first
+// error.
+func (c *Client) beforeSubscribe(ctx context.Context, req *Request) error {
+	for _, h := range c.subscriptionHooks {
+		if h.OnSubscribe != nil {
+			if err := h.OnSubscribe(ctx, req); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// intercept passes msg through the OnMessage hooks, or the OnComplete
+// hooks when it is the last message of sub.
+func (sub *subscription) intercept(msg SubscriptionMessage) SubscriptionMessage {
+	for _, h := range sub.hooks {
+		switch {
+		case msg.End != 0 && h.OnComplete != nil:
+			h.OnComplete(sub.req, msg)
+		case msg.End == 0 && h.OnMessage != nil:
+			received := msg.received
+			msg = h.OnMessage(sub.req, msg)
+			msg.received = received
+		}
+	}
+	return msg
+}
@@ -0,0 +1,111 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// recordingHooks returns Hooks recording the attempts in calls.
+func recordingHooks(calls *[]string) Hooks {
+	return Hooks{
+		OnRequest: func(req *http.Request, attempt int) {
+			*calls = append(*calls, fmt.Sprint("request ", attempt))
+		},
+		OnResponse: func(req *http.Request, resp *http.Response, info AttemptInfo) {
+			if info.Duration <= 0 || info.StatusCode != resp.StatusCode {
+				*calls = append(*calls, fmt.Sprintf("bad info %+v", info))
+			}
+			*calls = append(*calls, fmt.Sprint("response ", info.Attempt, " ", info.StatusCode))
+		},
+		OnError: func(req *http.Request, err error, info AttemptInfo) {
+			*calls = append(*calls, fmt.Sprint("error ", info.Attempt))
+		},
+	}
+}
+
+func TestHooks(t *testing.T) {
+	srv, _ := sequenceServer(503, 200)
+	defer srv.Close()
+	var calls []string
+	client := NewClient(srv.URL, WithClock(&recordingClock{}), WithHooks(recordingHooks(&calls)))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	client = NewClient(down.URL, WithoutRetry(), WithHooks(recordingHooks(&calls)))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := strings.Join(calls, ", "); got != "request 1, response 1 503, request 2, response 2 200, request 1, error 1" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestSubscriptionHooks(t *testing.T) {
+	variables := make(chan string, 1)
+	srv := newWSServer(t, []string{ProtocolGraphQLTransportWS}, func(p *wsPeer, protocol string) {
+		readWSMessage(t, p)
+		writeWSMessage(t, p, `{"type":"connection_ack"}`)
+		sub := readWSMessage(t, p)
+		var payload struct{ Variables json.RawMessage }
+		json.Unmarshal(sub.Payload, &payload)
+		variables <- string(payload.Variables)
+		writeWSMessage(t, p, `{"id":"`+sub.ID+`","type":"next","payload":{"data":{"tick":1}}}`)
+		writeWSMessage(t, p, `{"id":"`+sub.ID+`","type":"complete"}`)
+		p.readFrame()
+	})
+	defer srv.Close()
+	var calls []string
+	client := NewClient(srv.URL, WithSubscriptionHooks(SubscriptionHooks{
+		OnSubscribe: func(ctx context.Context, req *Request) error {
+			req.Var("channel", "news")
+			calls = append(calls, "subscribe")
+			return nil
+		},
+		OnMessage: func(req *Request, msg SubscriptionMessage) SubscriptionMessage {
+			calls = append(calls, "message "+string(msg.Data))
+			msg.Data = json.RawMessage(`{"tick":2}`)
+			return msg
+		},
+		OnComplete: func(req *Request, msg SubscriptionMessage) {
+			calls = append(calls, fmt.Sprint("complete ", msg.End == SubscriptionCompleted))
+		},
+	}), WithSubscriptionHooks(SubscriptionHooks{
+		OnMessage: func(req *Request, msg SubscriptionMessage) SubscriptionMessage {
+			calls = append(calls, "second "+string(msg.Data))
+			return msg
+		},
+	}))
+	messages, err := client.Subscribe(context.Background(), NewRequest("subscription($channel: String) { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, messages)
+	if len(got) != 2 || string(got[0].Data) != `{"tick":2}` {
+		t.Errorf("got %+v, want the event transformed", got)
+	}
+	if got := <-variables; got != `{"channel":"news"}` {
+		t.Errorf("got variables %s, want those set by OnSubscribe", got)
+	}
+	want := `subscribe; message {"tick":1}; second {"tick":2}; complete true`
+	if got := strings.Join(calls, "; "); got != want {
+		t.Errorf("got calls %s, want %s", got, want)
+	}
+}
+
+func TestSubscriptionHooksAbort(t *testing.T) {
+	abort := errors.New("abort")
+	client := NewClient("ws://127.0.0.1:1", WithSubscriptionHooks(SubscriptionHooks{
+		OnSubscribe: func(ctx context.Context, req *Request) error { return abort },
+	}))
+	if _, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }")); !errors.Is(err, abort) {
+		t.Errorf("got %v, want the error of OnSubscribe", err)
+	}
+}
@@ -0,0 +1,74 @@
+package graphql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+)
+
+// IdempotencyKeyHeader is the header used to carry the idempotency key.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// newIdempotencyKey returns a random UUIDv4 formatted key.
+func newIdempotencyKey() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf), nil
+}
+
+// idempotencyKeyKey is the context key of the Idempotency-Key of a call.
+type idempotencyKeyKey struct{}
+
+// idempotencyContext returns ctx carrying the Idempotency-Key of a call
+// when the client uses them. It is generated once per call so that the
+// fallback endpoints and the request sent again after refreshing the
+// credentials get the same key.
+func (c *Client) idempotencyContext(ctx context.Context) (context.Context, error) {
+	if !c.useIdempotencyKey {
+		return ctx, nil
+	}
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return nil, fmt.Errorf("generate idempotency key: %w", err)
+	}
+	return context.WithValue(ctx, idempotencyKeyKey{}, key), nil
+}
+
+// WithoutMutationRetries disables automatic retries of mutations, found by
+// parsing the query document, unless they carry an Idempotency-Key header
+// (see UseIdempotencyKey), so flaky networks can't cause duplicate writes.
+// A retry count set on the request with SetMaxRetries takes precedence.
+func WithoutMutationRetries() ClientOption {
+	return func(client *Client) {
+		client.noMutationRetries = true
+	}
+}
+
+// mutationRetryContext returns ctx with retries disabled when r is a
+// mutation that must not be retried.
+func (c *Client) mutationRetryContext(ctx context.Context, req *Request, r *http.Request) context.Context {
+	if !c.noMutationRetries || req.hasMaxRetries || r.Header.Get(IdempotencyKeyHeader) != "" {
+		return ctx
+	}
+	if req.OperationType() != OperationMutation {
+		return ctx
+	}
+	c.logDebugw(ctx, ">> mutation without idempotency key, retries disabled", "operation", req.OperationName())
+	return context.WithValue(ctx, retryOverrideKey{}, retryOverride{maxRetries: 0, policy: req.retryPolicy})
+}
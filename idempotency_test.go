@@ -0,0 +1,92 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// keyServer answers with status, recording the Idempotency-Key of each
+// request.
+func keyServer(status int, keys *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*keys = append(*keys, r.Header.Get(IdempotencyKeyHeader))
+		w.WriteHeader(status)
+		io.WriteString(w, `{"data":{}}`)
+	}))
+}
+
+func TestIdempotencyKeyPerCall(t *testing.T) {
+	var keys []string
+	primary := keyServer(http.StatusBadGateway, &keys)
+	defer primary.Close()
+	unauthorized := true
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+		if unauthorized {
+			unauthorized = false
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer fallback.Close()
+	client := NewClient(primary.URL, UseIdempotencyKey(), WithoutRetry(),
+		WithFallbackEndpoints(time.Minute, fallback.URL),
+		WithCredentialRefresh(func(ctx context.Context, req *Request, statusCode int) (bool, error) {
+			return true, nil
+		}))
+	if err := client.Run(context.Background(), NewRequest("mutation { a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 || keys[0] == "" || keys[1] != keys[0] || keys[2] != keys[0] {
+		t.Errorf("got keys %q, want the same key for the failover and the refreshed request", keys)
+	}
+	if err := client.Run(context.Background(), NewRequest("mutation { a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 4 || keys[3] == keys[0] {
+		t.Errorf("got keys %q, want a new key for the next call", keys)
+	}
+}
+
+func TestIdempotencyKeyKept(t *testing.T) {
+	var keys []string
+	srv := keyServer(http.StatusOK, &keys)
+	defer srv.Close()
+	req := NewRequest("mutation { a }")
+	req.Header.Set(IdempotencyKeyHeader, "mine")
+	if err := NewClient(srv.URL, UseIdempotencyKey()).Run(context.Background(), req, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "mine" {
+		t.Errorf("got keys %q, want the key of the request", keys)
+	}
+}
+
+func TestWithoutMutationRetries(t *testing.T) {
+	for name, tt := range map[string]struct {
+		opts  []ClientOption
+		query string
+		want  int
+	}{
+		"mutation":      {nil, "mutation { a }", 1},
+		"query":         {nil, "query { a }", RetryCount + 1},
+		"mutation keys": {[]ClientOption{UseIdempotencyKey()}, "mutation { a }", RetryCount + 1},
+	} {
+		var keys []string
+		srv := keyServer(http.StatusServiceUnavailable, &keys)
+		opts := append([]ClientOption{WithClock(&recordingClock{}), WithoutMutationRetries()}, tt.opts...)
+		client := NewClient(srv.URL, opts...)
+		if err := client.Run(context.Background(), NewRequest(tt.query), nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if len(keys) != tt.want {
+			t.Errorf("%s: got %d requests, want %d", name, len(keys), tt.want)
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,178 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// InvalidationRule tells which cached data a mutation makes stale, see
+// WithInvalidationRules.
+type InvalidationRule struct {
+	// Mutation is the operation name of the mutation.
+	Mutation string
+	// Operations are the names of the queries whose responses cached with
+	// WithResponseCache are invalidated.
+	Operations []string
+	// Types are the type names whose objects invalidate the cached
+	// responses containing them.
+	Types []string
+	// Entities, if set, returns the keys of the entities invalidated as
+	// with Client.InvalidateEntity, typically built with EntityKey from
+	// the variables of the mutation.
+	Entities func(req *Request) []string
+}
+
+// WithInvalidationRules invalidates cached data after each successful
+// mutation of the client, according to the rules naming it, so that
+// writes keep the response cache coherent. The option can be given
+// several times.
+func WithInvalidationRules(rules ...InvalidationRule) ClientOption {
+	return func(client *Client) {
+		client.invalidationRules = append(client.invalidationRules, rules...)
+	}
+}
+
+// indexesTypes reports whether the cached responses must be indexed by
+// the types of their objects.
+func (c *Client) indexesTypes() bool {
+	for _, rule := range c.invalidationRules {
+		if len(rule.Types) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// responseIndex is what a cached response is indexed under.
+type responseIndex struct {
+	operation string
+	types     []string
+}
+
+// index records that the cached response with key answers operation and
+// contains objects of types.
+func (rc *responseCache) index(key, operation string, types []string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.byOperation == nil {
+		rc.byOperation = make(map[string]map[string]bool)
+		rc.byType = make(map[string]map[string]bool)
+		rc.indexed = make(map[string]responseIndex)
+	}
+	rc.unindex(key)
+	add := func(index map[string]map[string]bool, name string) {
+		if index[name] == nil {
+			index[name] = make(map[string]bool)
+		}
+		index[name][key] = true
+	}
+	add(rc.byOperation, operation)
+	for _, typ := range types {
+		add(rc.byType, typ)
+	}
+	rc.indexed[key] = responseIndex{operation: operation, types: types}
+}
+
+// unindex removes the response with key from the indexes. The lock of rc
+// must be held.
+func (rc *responseCache) unindex(key string) {
+	ri, ok := rc.indexed[key]
+	if !ok {
+		return
+	}
+	remove := func(index map[string]map[string]bool, name string) {
+		delete(index[name], key)
+		if len(index[name]) == 0 {
+			delete(index, name)
+		}
+	}
+	remove(rc.byOperation, ri.operation)
+	for _, typ := range ri.types {
+		remove(rc.byType, typ)
+	}
+	delete(rc.indexed, key)
+}
+
+// collect adds to keys those of the responses recorded in index under
+// names. The lock of rc must be held.
+func (rc *responseCache) collect(index map[string]map[string]bool, names []string, keys map[string]bool) {
+	for _, name := range names {
+		for key := range index[name] {
+			keys[key] = true
+		}
+	}
+}
+
+// invalidate applies the invalidation rules of the client after the
+// mutation req succeeded.
+func (c *Client) invalidate(ctx context.Context, req *Request) {
+	if len(c.invalidationRules) == 0 || req.OperationType() != OperationMutation {
+		return
+	}
+	name := req.OperationName()
+	var errs []error
+	for _, rule := range c.invalidationRules {
+		if rule.Mutation != name {
+			continue
+		}
+		if c.entities != nil {
+			c.entities.generation.Add(1)
+		}
+		if c.cache != nil {
+			keys := make(map[string]bool)
+			c.cache.mu.Lock()
+			c.cache.collect(c.cache.byOperation, rule.Operations, keys)
+			c.cache.collect(c.cache.byType, rule.Types, keys)
+			c.cache.mu.Unlock()
+			for key := range keys {
+				if err := c.dropResponse(ctx, key); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+		if rule.Entities != nil && c.entities != nil {
+			for _, key := range rule.Entities(req) {
+				if err := c.InvalidateEntity(ctx, key); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		c.reportError(ctx, err)
+	}
+}
+
+// typeNames returns the distinct values of the __typename fields of data.
+func typeNames(data json.RawMessage) []string {
+	d := json.NewDecoder(bytes.NewReader(data))
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]interface{}:
+			if typename, ok := v["__typename"].(string); ok {
+				seen[typename] = true
+			}
+			for _, field := range v {
+				walk(field)
+			}
+		}
+	}
+	walk(v)
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	return names
+}
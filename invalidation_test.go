@@ -0,0 +1,87 @@
+package graphql
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// runNamed runs the operation named name of type op for the user with id.
+func runNamed(t *testing.T, client *Client, op, name, id string) {
+	t.Helper()
+	req := NewRequest(op + " " + name + "($id: ID!) { user(id: $id) { __typename id name } }")
+	req.Var("id", id)
+	if err := client.Run(context.Background(), req, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// indexSizes returns the number of operations, types and responses in the
+// invalidation indexes.
+func indexSizes(c *Client) (operations, types, responses int) {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	return len(c.cache.byOperation), len(c.cache.byType), len(c.cache.indexed)
+}
+
+func TestInvalidationRules(t *testing.T) {
+	srv, requests := userServer(t)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithResponseCache(time.Minute), WithInvalidationRules(
+		InvalidationRule{Mutation: "RenameUser", Operations: []string{"GetUser"}},
+		InvalidationRule{Mutation: "DeleteUser", Types: []string{"User"}},
+	))
+	runNamed(t, client, "query", "GetUser", "1")
+	runNamed(t, client, "query", "OtherUser", "2")
+	runNamed(t, client, "mutation", "RenameUser", "1")
+	runNamed(t, client, "query", "GetUser", "1")
+	runNamed(t, client, "query", "OtherUser", "2")
+	if got := requests.Load(); got != 4 {
+		t.Errorf("got %d requests, want only GetUser sent again", got)
+	}
+	runNamed(t, client, "mutation", "DeleteUser", "1")
+	runNamed(t, client, "query", "GetUser", "1")
+	runNamed(t, client, "query", "OtherUser", "2")
+	if got := requests.Load(); got != 7 {
+		t.Errorf("got %d requests, want both queries sent again", got)
+	}
+}
+
+func TestInvalidationIndexForgetsEvictedResponses(t *testing.T) {
+	srv, _ := userServer(t)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithResponseCache(time.Minute), WithInvalidationRules(
+		InvalidationRule{Mutation: "DeleteUser", Types: []string{"User"}},
+	))
+	store := NewLRUCache(1)
+	store.onRemove = client.forgetResponse
+	client.cache.store = store
+	runNamed(t, client, "query", "GetUser", "1")
+	runNamed(t, client, "query", "OtherUser", "2")
+	if operations, types, responses := indexSizes(client); operations != 1 || types != 1 || responses != 1 {
+		t.Errorf("got %d operations, %d types of %d responses indexed, want those of the cached one", operations, types, responses)
+	}
+	runNamed(t, client, "mutation", "DeleteUser", "2")
+	if operations, types, responses := indexSizes(client); operations != 0 || types != 0 || responses != 0 {
+		t.Errorf("got %d operations, %d types of %d responses indexed after invalidation", operations, types, responses)
+	}
+}
+
+func TestInvalidationIndexBoundsTrackedResponses(t *testing.T) {
+	srv, _ := userServer(t)
+	defer srv.Close()
+	backend := newMapCache()
+	client := NewClient(srv.URL, WithResponseCache(time.Minute), WithCacheBackend(backend), WithInvalidationRules(
+		InvalidationRule{Mutation: "RenameUser", Operations: []string{"GetUser"}},
+	))
+	client.cache.maxTracked = 2
+	for _, id := range []string{"1", "2", "3"} {
+		runNamed(t, client, "query", "GetUser", id)
+	}
+	if backend.len() != 2 {
+		t.Errorf("got %d cached responses, want the oldest deleted", backend.len())
+	}
+	if _, _, responses := indexSizes(client); responses != 2 {
+		t.Errorf("got %d responses indexed, want 2", responses)
+	}
+}
@@ -0,0 +1,170 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Logger is a leveled logger taking a message and alternating keys and
+// values, the shape of most structured logging libraries. The client logs
+// the operation, endpoint, status, attempt and such as keys and values.
+// Only a log/slog adapter, SlogLogger, is provided, so that the module
+// has no dependencies; adapting another library takes a few lines, e.g.
+// for a zap.SugaredLogger:
+//
+//	type zapLogger struct{ *zap.SugaredLogger }
+//
+//	func (l zapLogger) Debug(msg string, kv ...interface{}) { l.Debugw(msg, kv...) }
+//	func (l zapLogger) Info(msg string, kv ...interface{})  { l.Infow(msg, kv...) }
+//	func (l zapLogger) Warn(msg string, kv ...interface{})  { l.Warnw(msg, kv...) }
+//	func (l zapLogger) Error(msg string, kv ...interface{}) { l.Errorw(msg, kv...) }
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// DebugEnabler can be implemented by a Logger to tell whether it logs
+// debug messages. When it doesn't, the client skips formatting them.
+type DebugEnabler interface {
+	DebugEnabled() bool
+}
+
+// debugEnabled reports whether l logs debug messages, true if it doesn't
+// tell.
+func debugEnabled(l Logger) bool {
+	if e, ok := l.(DebugEnabler); ok {
+		return e.DebugEnabled()
+	}
+	return true
+}
+
+// WithLeveledLogger sends the logs of the client to l, in place of the
+// functions given with WithLogDebug, WithLogInfo, WithLogWarn and
+// WithLogError.
+func WithLeveledLogger(l Logger) ClientOption {
+	return func(client *Client) {
+		client.logger = l
+	}
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx carrying l. The logs of requests made
+// with it go to l rather than to the client's logger, e.g. to keep them
+// with the other logs of a tenant or a job. Messages about the state the
+// client shares between requests, such as circuit breaker transitions,
+// still go to the client's logger.
+func WithLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// contextLogger returns the logger attached to ctx with WithLogger, nil
+// if there is none.
+func contextLogger(ctx context.Context) Logger {
+	l, _ := ctx.Value(loggerKey{}).(Logger)
+	return l
+}
+
+// logFunc logs a message with alternating keys and values, as the
+// methods of Logger do.
+type logFunc func(msg string, keysAndValues ...interface{})
+
+// noLog is a logFunc discarding the messages.
+func noLog(string, ...interface{}) {}
+
+// logWarnTo logs msg as a warning to the logger attached to ctx, or with
+// fallback.
+func logWarnTo(ctx context.Context, fallback logFunc, msg string, keysAndValues ...interface{}) {
+	if l := contextLogger(ctx); l != nil {
+		l.Warn(msg, keysAndValues...)
+		return
+	}
+	fallback(msg, keysAndValues...)
+}
+
+// logDebugTo logs msg as a debug message to the logger attached to ctx,
+// or with fallback.
+func logDebugTo(ctx context.Context, fallback logFunc, msg string, keysAndValues ...interface{}) {
+	if l := contextLogger(ctx); l != nil {
+		if debugEnabled(l) {
+			l.Debug(msg, keysAndValues...)
+		}
+		return
+	}
+	fallback(msg, keysAndValues...)
+}
+
+// SlogLogger adapts l to Logger.
+func SlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l: l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// DebugEnabled implements DebugEnabler.
+func (s slogLogger) DebugEnabled() bool {
+	return s.l.Enabled(context.Background(), slog.LevelDebug)
+}
+
+func (s slogLogger) Debug(msg string, keysAndValues ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelDebug, msg, keysAndValues...)
+}
+
+func (s slogLogger) Info(msg string, keysAndValues ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelInfo, msg, keysAndValues...)
+}
+
+func (s slogLogger) Warn(msg string, keysAndValues ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelWarn, msg, keysAndValues...)
+}
+
+func (s slogLogger) Error(msg string, keysAndValues ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelError, msg, keysAndValues...)
+}
+
+// funcLogger adapts the logging functions of WithLogDebug, WithLogInfo,
+// WithLogWarn and WithLogError to Logger, appending the keys and values to
+// the message.
+type funcLogger struct {
+	debug, info, warn, err func(s string)
+}
+
+func (f funcLogger) Debug(msg string, keysAndValues ...interface{}) {
+	f.debug(formatLog(msg, keysAndValues))
+}
+
+func (f funcLogger) Info(msg string, keysAndValues ...interface{}) {
+	f.info(formatLog(msg, keysAndValues))
+}
+
+func (f funcLogger) Warn(msg string, keysAndValues ...interface{}) {
+	f.warn(formatLog(msg, keysAndValues))
+}
+
+func (f funcLogger) Error(msg string, keysAndValues ...interface{}) {
+	f.err(formatLog(msg, keysAndValues))
+}
+
+// formatLog renders msg followed by key=value pairs.
+func formatLog(msg string, keysAndValues []interface{}) string {
+	if len(keysAndValues) == 0 {
+		return msg
+	}
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		b.WriteByte(' ')
+		fmt.Fprint(&b, keysAndValues[i])
+		b.WriteByte('=')
+		if i+1 < len(keysAndValues) {
+			fmt.Fprint(&b, keysAndValues[i+1])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,195 @@
+package graphql
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logEntry is a message logged to a recordingLogger.
+type logEntry struct {
+	level, msg string
+	fields     map[string]interface{}
+}
+
+// recordingLogger is a Logger recording its messages.
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordingLogger) log(level, msg string, keysAndValues []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fields := make(map[string]interface{})
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fields[keysAndValues[i].(string)] = keysAndValues[i+1]
+	}
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, fields: fields})
+}
+
+func (l *recordingLogger) Debug(msg string, kv ...interface{}) { l.log("debug", msg, kv) }
+func (l *recordingLogger) Info(msg string, kv ...interface{})  { l.log("info", msg, kv) }
+func (l *recordingLogger) Warn(msg string, kv ...interface{})  { l.log("warn", msg, kv) }
+func (l *recordingLogger) Error(msg string, kv ...interface{}) { l.log("error", msg, kv) }
+
+// find returns the first entry logged with msg.
+func (l *recordingLogger) find(msg string) (logEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range l.entries {
+		if e.msg == msg {
+			return e, true
+		}
+	}
+	return logEntry{}, false
+}
+
+// failingOnce answers the first request with status and the next ones
+// with an empty response.
+func failingOnce(status int) *httptest.Server {
+	var once sync.Once
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failed := false
+		once.Do(func() {
+			w.WriteHeader(status)
+			failed = true
+		})
+		if !failed {
+			w.Write([]byte(`{"data":{}}`))
+		}
+	}))
+}
+
+func TestLoggerStructuredFields(t *testing.T) {
+	srv := failingOnce(http.StatusServiceUnavailable)
+	defer srv.Close()
+	logger := &recordingLogger{}
+	client := NewClient(srv.URL, WithLeveledLogger(logger), WithBackoff(time.Millisecond, 1, time.Millisecond))
+	if err := client.Run(context.Background(), NewRequest("query Foo { a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	retry, ok := logger.find("retrying")
+	if !ok {
+		t.Fatalf("no retry logged in %+v", logger.entries)
+	}
+	if retry.level != "warn" || retry.fields["status"] != http.StatusServiceUnavailable || retry.fields["attempt"] != 1 {
+		t.Errorf("got %+v, want the status and attempt as fields", retry)
+	}
+	request, ok := logger.find(">> request")
+	if !ok || request.fields["operation"] != "Foo" {
+		t.Errorf("got %+v, want the operation as a field", request)
+	}
+}
+
+func TestLoggerStatusError(t *testing.T) {
+	srv := failingOnce(http.StatusBadRequest)
+	defer srv.Close()
+	logger := &recordingLogger{}
+	client := NewClient(srv.URL, WithLeveledLogger(logger))
+	client.Run(context.Background(), NewRequest("{ a }"), nil)
+	e, ok := logger.find("server returned a non-200 status code")
+	if !ok || e.level != "error" || e.fields["status"] != http.StatusBadRequest {
+		t.Errorf("got %+v, want the status as a field", e)
+	}
+}
+
+func TestLoggerFuncFallback(t *testing.T) {
+	srv := failingOnce(http.StatusServiceUnavailable)
+	defer srv.Close()
+	var mu sync.Mutex
+	var lines []string
+	client := NewClient(srv.URL, WithBackoff(time.Millisecond, 1, time.Millisecond), WithLogWarn(func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, s)
+	}))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "retrying ") || !strings.Contains(lines[0], " status=503") || !strings.Contains(lines[0], " attempt=1") {
+		t.Errorf("got %q, want the retry with its fields formatted", lines)
+	}
+}
+
+func TestLoggerContextLogger(t *testing.T) {
+	srv := failingOnce(http.StatusServiceUnavailable)
+	defer srv.Close()
+	clientLogger, requestLogger := &recordingLogger{}, &recordingLogger{}
+	client := NewClient(srv.URL, WithLeveledLogger(clientLogger), WithBackoff(time.Millisecond, 1, time.Millisecond))
+	ctx := WithLogger(context.Background(), requestLogger)
+	if err := client.Run(ctx, NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := requestLogger.find("retrying"); !ok {
+		t.Error("retry not logged to the logger of the context")
+	}
+	if _, ok := clientLogger.find("retrying"); ok {
+		t.Error("retry logged to the logger of the client")
+	}
+}
+
+// quietLogger is a recordingLogger that doesn't log debug messages.
+type quietLogger struct{ recordingLogger }
+
+func (*quietLogger) DebugEnabled() bool { return false }
+
+// formatCounter counts how many times it is formatted as a string.
+type formatCounter struct{ n *int }
+
+func (f formatCounter) String() string {
+	*f.n++
+	return "formatted"
+}
+
+func TestLoggerDebugDisabled(t *testing.T) {
+	srv, _ := countingServer(http.StatusOK)
+	defer srv.Close()
+	for name, tt := range map[string]struct {
+		logger Logger
+		want   bool
+	}{
+		"enabled":  {&recordingLogger{}, true},
+		"disabled": {&quietLogger{}, false},
+	} {
+		formatted := 0
+		req := NewRequest("query($v: String) { a }")
+		req.Var("v", formatCounter{&formatted})
+		if err := NewClient(srv.URL, WithLeveledLogger(tt.logger)).Run(context.Background(), req, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := formatted > 0; got != tt.want {
+			t.Errorf("%s: got the variables formatted %d times", name, formatted)
+		}
+	}
+	logger := &quietLogger{}
+	NewClient(srv.URL, WithLeveledLogger(logger)).Run(context.Background(), NewRequest("{ a }"), nil)
+	for _, e := range logger.entries {
+		if e.level == "debug" {
+			t.Errorf("got %+v logged", e)
+		}
+	}
+}
+
+func TestLoggerContextLoggerDebug(t *testing.T) {
+	srv, _ := countingServer(http.StatusOK)
+	defer srv.Close()
+	clientLogger, requestLogger := &quietLogger{}, &recordingLogger{}
+	client := NewClient(srv.URL, WithLeveledLogger(clientLogger), WithRequestSummary())
+	if err := client.Run(WithLogger(context.Background(), requestLogger), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := requestLogger.find(">> request"); !ok {
+		t.Error("debug messages not logged to the logger of the context")
+	}
+	if _, ok := requestLogger.find("graphql request completed"); !ok {
+		t.Error("summary not logged to the logger of the context")
+	}
+	if len(clientLogger.entries) != 0 {
+		t.Errorf("got %+v logged to the logger of the client", clientLogger.entries)
+	}
+}
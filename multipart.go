@@ -0,0 +1,350 @@
+package graphql
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// newMultipartRequest builds req following the GraphQL multipart request
+// specification (https://github.com/jaydenseric/graphql-multipart-request-spec):
+// an "operations" part holding the JSON request with null placeholders
+// for the files, a "map" part linking each file part to the variable path
+// it fills, and one numbered part per file.
+func (c *Client) newMultipartRequest(ctx context.Context, req *Request, endpoint string) (*http.Request, error) {
+	files := req.uploadFiles()
+	for i := range files {
+		if err := files[i].precomputeDigest(); err != nil {
+			return nil, err
+		}
+	}
+	operations, fileMap, err := multipartOperations(c.envelope(req), files)
+	if err != nil {
+		return nil, err
+	}
+	if c.debugBodySummary {
+		c.logDebugw(ctx, ">> multipart request", "operation", req.OperationName(), "files", len(files))
+	} else {
+		c.logDebugw(ctx, ">> multipart request", "operations", c.debugBody(operations), "map", c.debugBody(fileMap), "files", len(files))
+	}
+	if err := c.uploadLimits.check(operations, files); err != nil {
+		return nil, err
+	}
+	body := newMultipartBody(operations, fileMap, files, c.compressRequests)
+	body.limits = c.uploadLimits
+	r, err := http.NewRequest(http.MethodPost, endpoint, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	r.Close = c.closeReq
+	if body.compress {
+		r.Header.Set("Content-Encoding", "gzip")
+	}
+	r.Header.Set("Content-Type", "multipart/form-data; boundary="+body.boundary)
+	r.Header.Set("Accept", "application/json; charset=utf-8")
+	if c.expectsContinue(files) {
+		r.Header.Set("Expect", "100-continue")
+	}
+	if err := c.setHeaders(ctx, r, req); err != nil {
+		return nil, err
+	}
+	if body.seekable {
+		r.GetBody = body.rewind
+	}
+	r.Body = body.open()
+	return r, nil
+}
+
+// executeMultipart sends r and decodes the GraphQL response envelope into
+// resp. Unlike execute, the body of a non-200 response is decoded too so
+// the GraphQL errors it carries are reported, except after a 401 or 403
+// which is returned as a StatusError for WithCredentialRefresh.
+func (c *Client) executeMultipart(ctx context.Context, r *http.Request, resp interface{}) error {
+	gr := &graphResponse{
+		Data: resp,
+	}
+	r = r.WithContext(ctx)
+	if body, ok := r.Body.(*multipartReader); ok {
+		// The transport may return before it read the whole body, or
+		// close it later: stop reading the files before returning.
+		defer body.owner.close()
+	}
+	buf, status, err := c.doRequest(r)
+	if err != nil {
+		return err
+	}
+	defer putBuffer(buf)
+	c.logDebugw(ctx, "<< response", "status", status, "body", c.debugBody(buf.Bytes()))
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		return &StatusError{StatusCode: status}
+	}
+	if err := json.NewDecoder(buf).Decode(&gr); err != nil {
+		if status != http.StatusOK {
+			return &StatusError{StatusCode: status}
+		}
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	if len(gr.Errors) > 0 {
+		// return first error
+		return gr.Errors[0]
+	}
+	if status != http.StatusOK {
+		return &StatusError{StatusCode: status}
+	}
+	return nil
+}
+
+// multipartBody produces a multipart request body while it is being
+// sent, so file contents are streamed from their readers with bounded
+// memory.
+type multipartBody struct {
+	operations []byte
+	fileMap    []byte
+	files      []File
+	boundary   string
+	compress   bool
+	limits     uploadLimits
+
+	// seekable is set when every file reader implements io.Seeker, in
+	// which case offsets holds the position each reader started at and
+	// the body can be produced again for a retry.
+	seekable bool
+	offsets  []int64
+
+	mu sync.Mutex
+	// current is the last body produced.
+	current *multipartReader
+}
+
+// multipartReader is a body produced by multipartBody, written by a
+// goroutine through a pipe.
+type multipartReader struct {
+	*io.PipeReader
+	owner *multipartBody
+	// done is closed once the goroutine writing the body returned.
+	done chan struct{}
+}
+
+// Close stops the goroutine writing the body and waits for it, so the
+// files are no longer read once it returns.
+func (r *multipartReader) Close() error {
+	r.PipeReader.CloseWithError(errBodyClosed)
+	<-r.done
+	return nil
+}
+
+// errBodyClosed is the error the goroutine writing a multipart body gets
+// once the body was closed.
+var errBodyClosed = errors.New("graphql: multipart body closed")
+
+func newMultipartBody(operations, fileMap []byte, files []File, compress bool) *multipartBody {
+	b := &multipartBody{
+		operations: operations,
+		fileMap:    fileMap,
+		files:      files,
+		boundary:   multipart.NewWriter(io.Discard).Boundary(),
+		compress:   compress,
+		seekable:   true,
+	}
+	for _, f := range files {
+		seeker, ok := f.R.(io.Seeker)
+		if !ok {
+			b.seekable = false
+			break
+		}
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			b.seekable = false
+			break
+		}
+		b.offsets = append(b.offsets, offset)
+	}
+	return b
+}
+
+// open starts producing the body and returns the reader to send.
+func (b *multipartBody) open() io.ReadCloser {
+	pr, pw := io.Pipe()
+	r := &multipartReader{PipeReader: pr, owner: b, done: make(chan struct{})}
+	b.mu.Lock()
+	b.current = r
+	b.mu.Unlock()
+	go func() {
+		defer close(r.done)
+		var dst io.Writer = pw
+		var zw *gzip.Writer
+		if b.compress {
+			zw = gzip.NewWriter(pw)
+			dst = zw
+		}
+		writer := multipart.NewWriter(dst)
+		err := writer.SetBoundary(b.boundary)
+		if err == nil {
+			err = b.write(writer)
+		}
+		if err == nil && zw != nil {
+			err = zw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return r
+}
+
+// close closes the last body produced, if any.
+func (b *multipartBody) close() {
+	b.mu.Lock()
+	r := b.current
+	b.mu.Unlock()
+	if r != nil {
+		r.Close()
+	}
+}
+
+// rewind seeks every file back to where it started and produces the body
+// again. It is used as the request's GetBody. The previous body is closed
+// first, so that its goroutine no longer reads the files.
+func (b *multipartBody) rewind() (io.ReadCloser, error) {
+	b.close()
+	for i, f := range b.files {
+		if _, err := f.R.(io.Seeker).Seek(b.offsets[i], io.SeekStart); err != nil {
+			return nil, fmt.Errorf("rewind file %q: %w", f.Name, err)
+		}
+	}
+	return b.open(), nil
+}
+
+// write writes the operations, map and file parts and closes the writer.
+func (b *multipartBody) write(writer *multipart.Writer) error {
+	if err := writer.WriteField("operations", string(b.operations)); err != nil {
+		return fmt.Errorf("write operations field: %w", err)
+	}
+	if err := writer.WriteField("map", string(b.fileMap)); err != nil {
+		return fmt.Errorf("write map field: %w", err)
+	}
+	total := int64(len(b.operations))
+	for i, f := range b.files {
+		part, err := writer.CreatePart(f.partHeader(strconv.Itoa(i)))
+		if err != nil {
+			return fmt.Errorf("create form file: %w", err)
+		}
+		src := b.limits.reader(f, total)
+		var h hash.Hash
+		if f.Checksum != "" && f.digest == "" {
+			if h, err = f.Checksum.newHash(); err != nil {
+				return err
+			}
+			src = io.TeeReader(src, h)
+		}
+		n, err := io.Copy(part, src)
+		if err != nil {
+			return fmt.Errorf("preparing file: %w", err)
+		}
+		total += n
+		if h != nil {
+			if err := writer.WriteField(strconv.Itoa(i)+".digest", f.Checksum.digestValue(h.Sum(nil))); err != nil {
+				return fmt.Errorf("write digest field: %w", err)
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("close writer: %w", err)
+	}
+	return nil
+}
+
+// multipartOperations returns the encoded "operations" and "map" parts
+// for the envelope env and its files. Each file's Field is the object path of the variable it fills,
+// such as "variables.avatar" or "variables.input.files.0"; a path not
+// starting with "variables." is taken to be relative to the variables.
+func multipartOperations(env requestEnvelope, files []File) ([]byte, []byte, error) {
+	// Work on a generic copy of the variables so placeholders can be set
+	// at any depth without modifying the caller's values.
+	var variables interface{} = map[string]interface{}{}
+	if len(env.Variables) > 0 {
+		encoded, err := json.Marshal(env.Variables)
+		if err != nil {
+			return nil, nil, fmt.Errorf("encode variables: %w", err)
+		}
+		// Numbers are kept as written, large integers not fitting a float64.
+		d := json.NewDecoder(bytes.NewReader(encoded))
+		d.UseNumber()
+		if err := d.Decode(&variables); err != nil {
+			return nil, nil, fmt.Errorf("encode variables: %w", err)
+		}
+	}
+	fileMap := make(map[string][]string, len(files))
+	for i, f := range files {
+		path := strings.TrimPrefix(f.Field, "variables.")
+		if path == "" {
+			return nil, nil, fmt.Errorf("graphql: empty variable path for file %q", f.Name)
+		}
+		var err error
+		variables, err = setPath(variables, strings.Split(path, "."), nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("graphql: file %q: %w", f.Name, err)
+		}
+		fileMap[strconv.Itoa(i)] = []string{"variables." + path}
+	}
+	operations, err := json.Marshal(struct {
+		requestEnvelope
+		Variables interface{} `json:"variables"`
+	}{
+		requestEnvelope: env,
+		Variables:       variables,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode operations: %w", err)
+	}
+	encodedMap, err := json.Marshal(fileMap)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode map: %w", err)
+	}
+	return operations, encodedMap, nil
+}
+
+// setPath sets value at path inside a decoded JSON value, creating
+// objects and growing arrays as needed, and returns the updated root.
+func setPath(root interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	key := path[0]
+	if index, err := strconv.Atoi(key); err == nil && index >= 0 {
+		list, _ := root.([]interface{})
+		if root != nil && list == nil {
+			return nil, fmt.Errorf("path element %q: not a list", key)
+		}
+		for len(list) <= index {
+			list = append(list, nil)
+		}
+		child, err := setPath(list[index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		list[index] = child
+		return list, nil
+	}
+	obj, _ := root.(map[string]interface{})
+	if root != nil && obj == nil {
+		return nil, fmt.Errorf("path element %q: not an object", key)
+	}
+	if obj == nil {
+		obj = make(map[string]interface{})
+	}
+	child, err := setPath(obj[key], path[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	obj[key] = child
+	return obj, nil
+}
@@ -0,0 +1,214 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingReader counts the bytes read from it, without synchronization
+// so that the race detector reports reads made after Run returned.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += n
+	return n, err
+}
+
+func TestMultipartStopsReadingFilesOnEarlyResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, UseMultipartForm(), WithoutRetry())
+	req := NewRequest("mutation($f: Upload!) { upload(file: $f) }")
+	file := &countingReader{r: strings.NewReader(strings.Repeat("x", 8<<20))}
+	req.File("f", "a.txt", file)
+	if err := client.Run(context.Background(), req, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	read := file.n
+	time.Sleep(20 * time.Millisecond)
+	if file.n != read {
+		t.Fatalf("file read after Run returned: %d then %d bytes", read, file.n)
+	}
+	if read == 8<<20 {
+		t.Fatal("whole file read for a request rejected early")
+	}
+}
+
+func TestMultipartRetrySendsWholeFileAgain(t *testing.T) {
+	content := strings.Repeat("0123456789", 100000)
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		f, _, err := r.FormFile("0")
+		if err != nil {
+			t.Errorf("form file: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		b, _ := io.ReadAll(f)
+		if string(b) != content {
+			t.Errorf("got %d bytes of file, want %d", len(b), len(content))
+		}
+		io.WriteString(w, `{"data":{"upload":true}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, UseMultipartForm(), WithBackoff(time.Millisecond, 1, time.Millisecond))
+	req := NewRequest("mutation($f: Upload!) { upload(file: $f) }")
+	req.File("f", "a.txt", bytes.NewReader([]byte(content)))
+	var resp struct{ Upload bool }
+	if err := client.Run(context.Background(), req, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Upload || atomic.LoadInt32(&attempts) != 2 {
+		t.Fatalf("got %+v after %d attempts", resp, attempts)
+	}
+}
+
+func TestMultipartNonSeekableFileNotRetried(t *testing.T) {
+	srv, requests := countingServer(http.StatusServiceUnavailable)
+	defer srv.Close()
+	client := NewClient(srv.URL, UseMultipartForm(), WithBackoff(time.Millisecond, 1, time.Millisecond))
+	req := NewRequest("mutation($f: Upload!) { upload(file: $f) }")
+	req.File("f", "a.txt", struct{ io.Reader }{strings.NewReader("x")})
+	err := client.Run(context.Background(), req, nil)
+	var nonReplayable *NonReplayableBodyError
+	if !errors.As(err, &nonReplayable) || nonReplayable.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got %v, want a NonReplayableBodyError", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("got %d requests, want no retry", requests.Load())
+	}
+}
+
+func TestMultipartBodyCloseWaitsForWriter(t *testing.T) {
+	file := &countingReader{r: strings.NewReader(strings.Repeat("x", 1<<20))}
+	body := newMultipartBody([]byte(`{}`), []byte(`{}`), []File{{Field: "variables.f", Name: "a", R: file}}, false)
+	r := body.open()
+	if _, err := r.Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	read := file.n
+	time.Sleep(10 * time.Millisecond)
+	if file.n != read {
+		t.Fatalf("file read after Close: %d then %d bytes", read, file.n)
+	}
+}
+
+func TestMultipartOperations(t *testing.T) {
+	env := requestEnvelope{
+		Query: "mutation($id: ID!, $n: Int!, $input: Input!) { upload }",
+		Variables: map[string]interface{}{
+			"n":     int64(9007199254740993),
+			"input": map[string]interface{}{"files": []interface{}{nil, nil}, "name": "x"},
+		},
+	}
+	files := []File{
+		{Field: "variables.input.files.1", Name: "b"},
+		{Field: "avatar", Name: "a"},
+	}
+	operations, fileMap, err := multipartOperations(env, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantOperations := `{"query":"mutation($id: ID!, $n: Int!, $input: Input!) { upload }","variables":{"avatar":null,"input":{"files":[null,null],"name":"x"},"n":9007199254740993}}`
+	if string(operations) != wantOperations {
+		t.Errorf("operations:\n got %s\nwant %s", operations, wantOperations)
+	}
+	wantMap := `{"0":["variables.input.files.1"],"1":["variables.avatar"]}`
+	if string(fileMap) != wantMap {
+		t.Errorf("map:\n got %s\nwant %s", fileMap, wantMap)
+	}
+	if _, _, err := multipartOperations(env, []File{{Field: "input.name.0", Name: "c"}}); err == nil {
+		t.Error("expected an error for a path through a string")
+	}
+}
+
+func TestMultipartCredentialRefresh(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"errors":[{"message":"token expired"}]}`)
+	}))
+	defer srv.Close()
+	var refreshed []int
+	client := NewClient(srv.URL, UseMultipartForm(), WithoutRetry(), WithCredentialRefresh(func(ctx context.Context, req *Request, statusCode int) (bool, error) {
+		refreshed = append(refreshed, statusCode)
+		return true, nil
+	}))
+	req := NewRequest("mutation($f: Upload!) { upload(file: $f) }")
+	req.File("f", "a.txt", strings.NewReader("x"))
+	err := client.Run(context.Background(), req, nil)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got %v, want a StatusError", err)
+	}
+	if len(refreshed) != 1 || refreshed[0] != http.StatusUnauthorized {
+		t.Errorf("refresher called with %v, want one 401", refreshed)
+	}
+}
+
+func TestMultipartStatus(t *testing.T) {
+	for _, tt := range []struct {
+		body    string
+		message string
+	}{
+		{`{"errors":[{"message":"too large"}]}`, "graphql: too large"},
+		{`{"data":null}`, "graphql: server returned a non-200 status code: 413"},
+		{`not json`, "graphql: server returned a non-200 status code: 413"},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			io.WriteString(w, tt.body)
+		}))
+		client := NewClient(srv.URL, UseMultipartForm(), WithoutRetry())
+		req := NewRequest("mutation($f: Upload!) { upload(file: $f) }")
+		req.File("f", "a.txt", strings.NewReader("x"))
+		if err := client.Run(context.Background(), req, nil); err == nil || err.Error() != tt.message {
+			t.Errorf("%s: got %v, want %s", tt.body, err, tt.message)
+		}
+		srv.Close()
+	}
+}
+
+func TestAutoMultipart(t *testing.T) {
+	var contentTypes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentTypes = append(contentTypes, strings.SplitN(r.Header.Get("Content-Type"), ";", 2)[0])
+		io.Copy(io.Discard, r.Body)
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	upload := func(req *Request) { req.File("f", "a.txt", strings.NewReader("x")) }
+	if err := runUpload(t, NewClient(srv.URL), "mutation($f: Upload!) { upload(file: $f) }", upload); err == nil {
+		t.Error("expected an error for files without WithAutoMultipart")
+	}
+	client := NewClient(srv.URL, WithAutoMultipart())
+	if err := runUpload(t, client, "mutation($f: Upload!) { upload(file: $f) }", upload); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(contentTypes, ","); got != "multipart/form-data,application/json" {
+		t.Errorf("got %s, want multipart only for the request with files", got)
+	}
+}
@@ -0,0 +1,20 @@
+package graphql
+
+import "context"
+
+// Observer is told about every Run and RunStream call of a client, for
+// metrics. See the otelgraphql and promgraphql modules for ready-made
+// ones. Calls are made synchronously and must not block.
+type Observer interface {
+	// Started is called when a call starts.
+	Started(ctx context.Context, req *Request)
+	// Completed is called when a call that was started returns.
+	Completed(ctx context.Context, req *Request, summary RequestSummary)
+}
+
+// WithObserver adds o to the observers of the client.
+func WithObserver(o Observer) ClientOption {
+	return func(client *Client) {
+		client.observers = append(client.observers, o)
+	}
+}
@@ -0,0 +1,187 @@
+package graphql
+
+// Operation types as they appear in a GraphQL document.
+const (
+	OperationQuery        = "query"
+	OperationMutation     = "mutation"
+	OperationSubscription = "subscription"
+)
+
+// operation is an executable definition found in a document.
+type operation struct {
+	typ  string
+	name string
+}
+
+// parseOperations scans a GraphQL document and returns its operation
+// definitions in order. It only understands enough of the grammar to find
+// top level definitions: comments, strings and block strings are skipped
+// and nested selection sets are ignored. Fragment definitions are not
+// returned.
+func parseOperations(doc string) []operation {
+	var (
+		ops   []operation
+		depth int
+		// pending is the operation type whose name, if any, is expected next.
+		pending string
+		// header is set while a definition header is being read so its
+		// selection set isn't mistaken for an anonymous query.
+		header bool
+		// fragment is set while a fragment header is being skipped.
+		fragment bool
+	)
+	for i := 0; i < len(doc); {
+		ch := doc[i]
+		switch {
+		case ch == '#':
+			for i < len(doc) && doc[i] != '\n' && doc[i] != '\r' {
+				i++
+			}
+		case ch == '"':
+			i = skipString(doc, i)
+		case ch == '{':
+			if depth == 0 {
+				switch {
+				case header:
+					header, fragment = false, false
+				case pending != "":
+					ops = append(ops, operation{typ: pending})
+					pending = ""
+				default:
+					// anonymous query shorthand
+					ops = append(ops, operation{typ: OperationQuery})
+				}
+			}
+			depth++
+			i++
+		case ch == '}':
+			if depth > 0 {
+				depth--
+			}
+			i++
+		case ch == '(' || ch == '@':
+			if depth == 0 && pending != "" {
+				ops = append(ops, operation{typ: pending})
+				pending = ""
+				header = true
+			}
+			i = skipBalanced(doc, i)
+		case isNameStart(ch):
+			start := i
+			for i < len(doc) && isNameContinue(doc[i]) {
+				i++
+			}
+			if depth != 0 || fragment {
+				continue
+			}
+			word := doc[start:i]
+			if pending != "" {
+				ops = append(ops, operation{typ: pending, name: word})
+				pending = ""
+				header = true
+				continue
+			}
+			switch word {
+			case OperationQuery, OperationMutation, OperationSubscription:
+				pending = word
+			case "fragment":
+				header, fragment = true, true
+			}
+		default:
+			i++
+		}
+	}
+	if pending != "" {
+		ops = append(ops, operation{typ: pending})
+	}
+	return ops
+}
+
+// selectOperation picks the operation that will be executed: the one
+// matching name, or the first one in the document when name is empty.
+func selectOperation(doc, name string) (operation, bool) {
+	ops := parseOperations(doc)
+	if len(ops) == 0 {
+		return operation{}, false
+	}
+	if name == "" {
+		return ops[0], true
+	}
+	for _, op := range ops {
+		if op.name == name {
+			return op, true
+		}
+	}
+	return operation{}, false
+}
+
+func skipString(doc string, i int) int {
+	if len(doc) >= i+3 && doc[i:i+3] == `"""` {
+		i += 3
+		for i < len(doc) {
+			if doc[i] == '\\' && len(doc) >= i+4 && doc[i+1:i+4] == `"""` {
+				i += 4
+				continue
+			}
+			if len(doc) >= i+3 && doc[i:i+3] == `"""` {
+				return i + 3
+			}
+			i++
+		}
+		return i
+	}
+	i++
+	for i < len(doc) {
+		switch doc[i] {
+		case '\\':
+			i += 2
+			continue
+		case '"', '\n':
+			return i + 1
+		}
+		i++
+	}
+	return i
+}
+
+// skipBalanced skips a parenthesised group, or a directive with its
+// arguments, starting at i.
+func skipBalanced(doc string, i int) int {
+	if doc[i] == '@' {
+		i++
+		for i < len(doc) && isNameContinue(doc[i]) {
+			i++
+		}
+		for i < len(doc) && (doc[i] == ' ' || doc[i] == '\t' || doc[i] == '\n' || doc[i] == '\r' || doc[i] == ',') {
+			i++
+		}
+		if i >= len(doc) || doc[i] != '(' {
+			return i
+		}
+	}
+	depth := 0
+	for i < len(doc) {
+		switch doc[i] {
+		case '"':
+			i = skipString(doc, i)
+			continue
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+		i++
+	}
+	return i
+}
+
+func isNameStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isNameContinue(ch byte) bool {
+	return isNameStart(ch) || (ch >= '0' && ch <= '9')
+}
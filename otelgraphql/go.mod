@@ -0,0 +1,12 @@
+module github.com/v0vc/graphql/otelgraphql
+
+go 1.23
+
+// Developed alongside the main module.
+replace github.com/v0vc/graphql => ../
+
+require (
+	github.com/v0vc/graphql v0.0.0-00010101000000-000000000000
+	go.opentelemetry.io/otel v1.35.0
+	go.opentelemetry.io/otel/metric v1.35.0
+)
@@ -0,0 +1,83 @@
+// Package otelgraphql records the metrics of graphql clients with the
+// OpenTelemetry metrics API.
+package otelgraphql
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/v0vc/graphql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// instrumentationName identifies the instruments of this package.
+const instrumentationName = "github.com/v0vc/graphql/otelgraphql"
+
+// WithMetrics records the metrics of the client with the meter provider
+// mp, see NewObserver. It panics if the instruments can't be created.
+func WithMetrics(mp metric.MeterProvider) graphql.ClientOption {
+	o, err := NewObserver(mp.Meter(instrumentationName))
+	if err != nil {
+		panic(err)
+	}
+	return graphql.WithObserver(o)
+}
+
+// Observer is a graphql.Observer recording:
+//
+//   - graphql.client.request.duration, a histogram of the call durations
+//     in seconds,
+//   - graphql.client.request.errors, the number of failed calls, also
+//     labeled by error class,
+//   - graphql.client.request.retries, the number of retries made,
+//
+// labeled by operation name and type, and status code.
+type Observer struct {
+	duration metric.Float64Histogram
+	errors   metric.Int64Counter
+	retries  metric.Int64Counter
+}
+
+// NewObserver creates the instruments of an Observer with meter.
+func NewObserver(meter metric.Meter) (*Observer, error) {
+	duration, err := meter.Float64Histogram("graphql.client.request.duration",
+		metric.WithDescription("Duration of GraphQL requests."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	errors, err := meter.Int64Counter("graphql.client.request.errors",
+		metric.WithDescription("Number of failed GraphQL requests."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+	retries, err := meter.Int64Counter("graphql.client.request.retries",
+		metric.WithDescription("Number of retries of GraphQL requests."),
+		metric.WithUnit("{retry}"))
+	if err != nil {
+		return nil, err
+	}
+	return &Observer{duration: duration, errors: errors, retries: retries}, nil
+}
+
+// Started implements graphql.Observer.
+func (o *Observer) Started(context.Context, *graphql.Request) {}
+
+// Completed implements graphql.Observer.
+func (o *Observer) Completed(ctx context.Context, _ *graphql.Request, s graphql.RequestSummary) {
+	attrs := attribute.NewSet(
+		attribute.String("graphql.operation.name", s.OperationName),
+		attribute.String("graphql.operation.type", s.OperationType),
+		attribute.String("http.response.status_code", strconv.Itoa(s.StatusCode)),
+	)
+	o.duration.Record(ctx, s.Duration.Seconds(), metric.WithAttributeSet(attrs))
+	if retries := s.Retries(); retries > 0 {
+		o.retries.Add(ctx, int64(retries), metric.WithAttributeSet(attrs))
+	}
+	if s.Err != nil {
+		o.errors.Add(ctx, 1, metric.WithAttributeSet(attrs),
+			metric.WithAttributes(attribute.String("error.type", s.ErrorClass)))
+	}
+}
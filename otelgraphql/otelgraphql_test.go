@@ -0,0 +1,87 @@
+package otelgraphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/v0vc/graphql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// recordingMeter records the measurements of its instruments as
+// "name value attributes" lines.
+type recordingMeter struct {
+	noop.Meter
+	lines *[]string
+}
+
+func (m recordingMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return recordingCounter{name: name, lines: m.lines}, nil
+}
+
+func (m recordingMeter) Float64Histogram(name string, _ ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return recordingHistogram{name: name, lines: m.lines}, nil
+}
+
+type recordingCounter struct {
+	noop.Int64Counter
+	name  string
+	lines *[]string
+}
+
+func (c recordingCounter) Add(_ context.Context, v int64, opts ...metric.AddOption) {
+	*c.lines = append(*c.lines, fmt.Sprint(c.name, " ", v, " ", attrs(metric.NewAddConfig(opts).Attributes())))
+}
+
+type recordingHistogram struct {
+	noop.Float64Histogram
+	name  string
+	lines *[]string
+}
+
+func (h recordingHistogram) Record(_ context.Context, v float64, opts ...metric.RecordOption) {
+	*h.lines = append(*h.lines, fmt.Sprint(h.name, " ", v, " ", attrs(metric.NewRecordConfig(opts).Attributes())))
+}
+
+// attrs renders set as sorted key=value pairs.
+func attrs(set attribute.Set) string {
+	var kv []string
+	for _, a := range set.ToSlice() {
+		kv = append(kv, string(a.Key)+"="+a.Value.Emit())
+	}
+	sort.Strings(kv)
+	return strings.Join(kv, ",")
+}
+
+func TestObserver(t *testing.T) {
+	var lines []string
+	o, err := NewObserver(recordingMeter{lines: &lines})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Completed(context.Background(), nil, graphql.RequestSummary{
+		OperationName: "Foo",
+		OperationType: graphql.OperationQuery,
+		Duration:      1500 * time.Millisecond,
+		StatusCode:    503,
+		Attempts:      3,
+		Err:           errors.New("boom"),
+		ErrorClass:    graphql.ErrorClassRetryExhausted,
+	})
+	labels := "graphql.operation.name=Foo,graphql.operation.type=query,http.response.status_code=503"
+	want := []string{
+		"graphql.client.request.duration 1.5 " + labels,
+		"graphql.client.request.retries 2 " + labels,
+		"graphql.client.request.errors 1 error.type=retry_exhausted," + labels,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
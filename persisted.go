@@ -0,0 +1,56 @@
+package graphql
+
+import (
+	"errors"
+	"fmt"
+)
+
+// WithPersistedQueries configures a Relay/Apollo style persisted
+// operation manifest mapping operation names to their IDs.
+// Operations found in the manifest are sent as {id, variables} instead of
+// the full query document with the JSON, GET and multipart wire formats
+// and in subscriptions.
+func WithPersistedQueries(manifest map[string]string) ClientOption {
+	return func(client *Client) {
+		client.persistedQueries = manifest
+	}
+}
+
+// RequirePersistedQueries refuses to send any operation that is not in the
+// persisted query manifest (allowlist mode), subscriptions included. As
+// the application/graphql body of UseGraphQLContentType can only carry
+// the full query, the HTTP requests that would be sent with it are
+// refused too.
+func RequirePersistedQueries() ClientOption {
+	return func(client *Client) {
+		client.requirePersisted = true
+	}
+}
+
+// persistedID looks up the ID of the operation executed by req.
+func (c *Client) persistedID(req *Request) (string, bool) {
+	if len(c.persistedQueries) == 0 {
+		return "", false
+	}
+	name := req.OperationName()
+	if name == "" {
+		return "", false
+	}
+	id, ok := c.persistedQueries[name]
+	return id, ok
+}
+
+// checkPersisted enforces allowlist mode.
+func (c *Client) checkPersisted(req *Request) error {
+	if !c.requirePersisted {
+		return nil
+	}
+	if _, ok := c.persistedID(req); !ok {
+		return fmt.Errorf("graphql: operation %q is not in the persisted query manifest", req.OperationName())
+	}
+	return nil
+}
+
+// errGraphQLBodyPersisted refuses the requests of allowlist mode that
+// would be sent with the application/graphql body.
+var errGraphQLBodyPersisted = errors.New("graphql: the application/graphql body can't carry a persisted query ID")
@@ -0,0 +1,135 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// persistedManifest maps the operation GetUser to its ID.
+var persistedManifest = map[string]string{"GetUser": "sha256:abc"}
+
+// sentOperation is what a server received of an operation.
+type sentOperation struct {
+	Query, ID string
+}
+
+// operationServer records the query and ID of the operation of each
+// request, whatever its wire format.
+func operationServer(t *testing.T, sent *[]sentOperation) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var op sentOperation
+		switch {
+		case r.Method == http.MethodGet:
+			op = sentOperation{Query: r.URL.Query().Get("query"), ID: r.URL.Query().Get("id")}
+		case strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data"):
+			json.Unmarshal([]byte(r.FormValue("operations")), &op)
+		case strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql"):
+			b, _ := io.ReadAll(r.Body)
+			op.Query = string(b)
+		default:
+			json.NewDecoder(r.Body).Decode(&op)
+		}
+		*sent = append(*sent, op)
+		io.WriteString(w, `{"data":{}}`)
+	}))
+}
+
+// getUser returns a request for the operation GetUser, with a file if
+// upload is set.
+func getUser(upload bool) *Request {
+	if upload {
+		req := NewRequest("mutation GetUser($f: Upload!) { user(file: $f) { id } }")
+		req.File("f", "a.txt", strings.NewReader("x"))
+		return req
+	}
+	return NewRequest("query GetUser { user { id } }")
+}
+
+func TestPersistedQueriesSendOnlyID(t *testing.T) {
+	for name, tt := range map[string]struct {
+		opts   []ClientOption
+		upload bool
+	}{
+		"json":      {nil, false},
+		"get":       {[]ClientOption{UseGETForQueries(0)}, false},
+		"multipart": {[]ClientOption{UseMultipartForm()}, true},
+	} {
+		var sent []sentOperation
+		srv := operationServer(t, &sent)
+		opts := append([]ClientOption{WithPersistedQueries(persistedManifest), RequirePersistedQueries()}, tt.opts...)
+		client := NewClient(srv.URL, opts...)
+		if err := client.Run(context.Background(), getUser(tt.upload), nil); err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if len(sent) != 1 || sent[0].Query != "" || sent[0].ID != "sha256:abc" {
+			t.Errorf("%s: got %+v, want only the ID sent", name, sent)
+		}
+		srv.Close()
+	}
+}
+
+func TestPersistedQueriesAllowlist(t *testing.T) {
+	var sent []sentOperation
+	srv := operationServer(t, &sent)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithPersistedQueries(persistedManifest), RequirePersistedQueries())
+	if err := client.Run(context.Background(), NewRequest("query Other { user { id } }"), nil); err == nil {
+		t.Error("expected an error for an operation not in the manifest")
+	}
+	if _, err := client.Subscribe(context.Background(), NewRequest("subscription Other { tick }")); err == nil {
+		t.Error("expected an error for a subscription not in the manifest")
+	}
+	if len(sent) != 0 {
+		t.Errorf("got %+v sent", sent)
+	}
+}
+
+func TestPersistedQueriesGraphQLContentType(t *testing.T) {
+	var sent []sentOperation
+	srv := operationServer(t, &sent)
+	defer srv.Close()
+	client := NewClient(srv.URL, UseGraphQLContentType(), WithPersistedQueries(persistedManifest), RequirePersistedQueries())
+	if err := client.Run(context.Background(), getUser(false), nil); err == nil {
+		t.Error("expected an error for the application/graphql body in allowlist mode")
+	}
+	if len(sent) != 0 {
+		t.Errorf("got %+v sent", sent)
+	}
+	client = NewClient(srv.URL, UseGraphQLContentType(), WithPersistedQueries(persistedManifest))
+	if err := client.Run(context.Background(), getUser(false), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 || sent[0].Query == "" {
+		t.Errorf("got %+v, want the query sent without allowlist mode", sent)
+	}
+}
+
+func TestPersistedQueriesSubscription(t *testing.T) {
+	subscribed := make(chan wsMessage, 1)
+	srv := newWSServer(t, []string{ProtocolGraphQLTransportWS}, func(p *wsPeer, protocol string) {
+		readWSMessage(t, p)
+		writeWSMessage(t, p, `{"type":"connection_ack"}`)
+		sub := readWSMessage(t, p)
+		subscribed <- sub
+		writeWSMessage(t, p, `{"id":"`+sub.ID+`","type":"complete"}`)
+		p.readFrame()
+	})
+	defer srv.Close()
+	// The application/graphql body of HTTP requests doesn't matter to
+	// subscriptions.
+	client := NewClient(srv.URL, UseGraphQLContentType(), WithPersistedQueries(map[string]string{"Ticks": "sha256:def"}), RequirePersistedQueries())
+	messages, err := client.Subscribe(context.Background(), NewRequest("subscription Ticks { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collect(t, messages)
+	var payload sentOperation
+	json.Unmarshal((<-subscribed).Payload, &payload)
+	if payload.Query != "" || payload.ID != "sha256:def" {
+		t.Errorf("got %+v, want only the ID sent", payload)
+	}
+}
@@ -0,0 +1,31 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Ping executes the trivial query `{ __typename }` and returns how long
+// the round trip took. A nil error means the endpoint is reachable and
+// answers GraphQL queries, which makes it suitable for readiness probes.
+// Ping is not retried, so the latency measures a single attempt, nor
+// answered from the cache of WithResponseCache.
+func (c *Client) Ping(ctx context.Context) (time.Duration, error) {
+	req := NewRequest(`{ __typename }`)
+	req.SetMaxRetries(0)
+	req.SetCacheTTL(0)
+	var resp struct {
+		Typename string `json:"__typename"`
+	}
+	start := time.Now()
+	err := c.Run(ctx, req, &resp)
+	latency := time.Since(start)
+	if err != nil {
+		return latency, err
+	}
+	if resp.Typename == "" {
+		return latency, errors.New("graphql: ping: empty __typename in response")
+	}
+	return latency, nil
+}
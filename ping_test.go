@@ -0,0 +1,31 @@
+package graphql
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestPing(t *testing.T) {
+	srv, _ := cachedServer(func(int32) string { return `{"data":{"__typename":"Query"}}` })
+	defer srv.Close()
+	if latency, err := NewClient(srv.URL).Ping(context.Background()); err != nil || latency <= 0 {
+		t.Errorf("got %s, %v", latency, err)
+	}
+	empty, _ := countingServer(http.StatusOK)
+	defer empty.Close()
+	if _, err := NewClient(empty.URL).Ping(context.Background()); err == nil {
+		t.Error("expected an error without __typename in the response")
+	}
+}
+
+func TestPingNotRetried(t *testing.T) {
+	srv, requests := countingServer(http.StatusServiceUnavailable)
+	defer srv.Close()
+	if _, err := NewClient(srv.URL, WithClock(&recordingClock{})).Ping(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("got %d requests, want 1", requests.Load())
+	}
+}
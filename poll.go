@@ -0,0 +1,47 @@
+package graphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"time"
+)
+
+// Poll runs the query req every interval and calls handler with its data
+// when it changed since the last call, starting with the first result, as
+// a live query for servers without subscriptions. Results are compared by
+// their SHA-256, so no result is kept. A failed run calls handler with its
+// error instead, leaving the last result as is.
+// Poll returns when ctx is done, with its error, or when handler returns
+// an error, with it. The interval is waited with the clock of WithClock.
+// Poll disables the caching of req with SetCacheTTL, so that each run
+// reaches the server despite WithResponseCache.
+func (c *Client) Poll(ctx context.Context, req *Request, interval time.Duration, handler func(data json.RawMessage, err error) error) error {
+	req.SetCacheTTL(0)
+	clock := c.clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	var last [sha256.Size]byte
+	seen := false
+	for {
+		var data json.RawMessage
+		err := c.Run(ctx, req, &data)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if err := handler(nil, err); err != nil {
+				return err
+			}
+		} else if sum := sha256.Sum256(data); !seen || sum != last {
+			last, seen = sum, true
+			if err := handler(data, nil); err != nil {
+				return err
+			}
+		}
+		if err := clock.Sleep(ctx, interval); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPoll(t *testing.T) {
+	srv, _ := cachedServer(func(n int32) string {
+		switch n {
+		case 1, 2:
+			return `{"data":{"count":1}}`
+		case 4:
+			return `{"errors":[{"message":"boom"}]}`
+		case 6:
+			return `{"data":{"count":3}}`
+		}
+		return `{"data":{"count":2}}`
+	})
+	defer srv.Close()
+	clock := &recordingClock{}
+	client := NewClient(srv.URL, WithClock(clock))
+	stop := errors.New("stop")
+	var calls []string
+	err := client.Poll(context.Background(), NewRequest("{ count }"), time.Second, func(data json.RawMessage, err error) error {
+		if err != nil {
+			calls = append(calls, err.Error())
+		} else {
+			calls = append(calls, string(data))
+		}
+		if len(calls) == 4 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("got %v, want the error of the handler", err)
+	}
+	want := `{"count":1}; {"count":2}; graphql: boom; {"count":3}`
+	if got := strings.Join(calls, "; "); got != want {
+		t.Errorf("got calls %s, want %s", got, want)
+	}
+	if len(clock.sleeps) != 5 || clock.sleeps[0] != time.Second {
+		t.Errorf("got sleeps %v, want the interval after each run", clock.sleeps)
+	}
+}
+
+func TestPollCanceled(t *testing.T) {
+	srv, _ := cachedServer(countResponse)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithClock(&recordingClock{}))
+	ctx, cancel := context.WithCancel(context.Background())
+	err := client.Poll(ctx, NewRequest("{ count }"), time.Second, func(data json.RawMessage, err error) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want the error of the context", err)
+	}
+}
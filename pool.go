@@ -0,0 +1,45 @@
+package graphql
+
+import (
+	"bytes"
+	"compress/gzip"
+	"sync"
+)
+
+// maxPooledBuffer is the capacity above which a buffer isn't pooled
+// again, so that an occasional large response doesn't stay in memory.
+const maxPooledBuffer = 1 << 20
+
+// bufferPool holds the buffers request bodies are encoded in and response
+// bodies are read into, reused across requests to spare the garbage
+// collector at high rates.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns buf to the pool. buf and its bytes must no longer be
+// used.
+func putBuffer(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// gzipWriterPool holds the writers request bodies are compressed with,
+// each costing hundreds of kilobytes of state.
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// envelopePool holds the envelopes JSON requests are encoded from, sparing
+// their allocation when they are passed to the encoder.
+var envelopePool = sync.Pool{
+	New: func() interface{} { return new(requestEnvelope) },
+}
@@ -0,0 +1,49 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPutBuffer(t *testing.T) {
+	buf := getBuffer()
+	buf.WriteString("used")
+	putBuffer(buf)
+	if buf.Len() != 0 {
+		t.Errorf("pooled buffer not reset, holds %q", buf.String())
+	}
+	large := bytes.NewBuffer(make([]byte, 0, maxPooledBuffer+1))
+	large.WriteString("large")
+	putBuffer(large)
+	if large.String() != "large" {
+		t.Error("buffer beyond maxPooledBuffer pooled")
+	}
+	putBuffer(nil)
+}
+
+func TestPooledBuffersConcurrentRuns(t *testing.T) {
+	srv, _ := userServer(t)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithoutRetry())
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := strings.Repeat(strconv.Itoa(i), i+1)
+			req := NewRequest("query($id: ID!) { user(id: $id) { id name } }")
+			req.Var("id", id)
+			var resp struct{ User struct{ ID, Name string } }
+			if err := client.Run(context.Background(), req, &resp); err != nil {
+				t.Error(err)
+			} else if resp.User.ID != id || resp.User.Name != "user "+id {
+				t.Errorf("query %d got %+v", i, resp.User)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,90 @@
+// Package promgraphql exposes the metrics of graphql clients to
+// Prometheus.
+package promgraphql
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/v0vc/graphql"
+)
+
+// WithPrometheus registers a new Collector with registerer and observes
+// the client with it. It panics if the registration fails, like
+// prometheus.MustRegister; use NewCollector and graphql.WithObserver to
+// share a collector between clients.
+func WithPrometheus(registerer prometheus.Registerer) graphql.ClientOption {
+	c := NewCollector()
+	registerer.MustRegister(c)
+	return graphql.WithObserver(c)
+}
+
+// Collector is a prometheus.Collector and graphql.Observer exposing:
+//
+//   - graphql_client_requests_total, by operation, status code and error
+//     class,
+//   - graphql_client_request_duration_seconds, a latency histogram by
+//     operation,
+//   - graphql_client_requests_in_flight, the calls in progress,
+//   - graphql_client_retries_total, by operation.
+type Collector struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+	retries  *prometheus.CounterVec
+}
+
+// NewCollector returns a Collector, to register and observe clients with.
+func NewCollector() *Collector {
+	return &Collector{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "graphql_client_requests_total",
+			Help: "Number of GraphQL requests made.",
+		}, []string{"operation", "code", "error_class"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "graphql_client_request_duration_seconds",
+			Help:    "Duration of GraphQL requests.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "graphql_client_requests_in_flight",
+			Help: "Number of GraphQL requests in progress.",
+		}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "graphql_client_retries_total",
+			Help: "Number of retries of GraphQL requests.",
+		}, []string{"operation"}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.duration.Describe(ch)
+	c.inFlight.Describe(ch)
+	c.retries.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.requests.Collect(ch)
+	c.duration.Collect(ch)
+	c.inFlight.Collect(ch)
+	c.retries.Collect(ch)
+}
+
+// Started implements graphql.Observer.
+func (c *Collector) Started(context.Context, *graphql.Request) {
+	c.inFlight.Inc()
+}
+
+// Completed implements graphql.Observer.
+func (c *Collector) Completed(_ context.Context, _ *graphql.Request, s graphql.RequestSummary) {
+	c.inFlight.Dec()
+	c.requests.WithLabelValues(s.OperationName, strconv.Itoa(s.StatusCode), s.ErrorClass).Inc()
+	c.duration.WithLabelValues(s.OperationName).Observe(s.Duration.Seconds())
+	if retries := s.Retries(); retries > 0 {
+		c.retries.WithLabelValues(s.OperationName).Add(float64(retries))
+	}
+}
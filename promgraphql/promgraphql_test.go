@@ -0,0 +1,72 @@
+package promgraphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/v0vc/graphql"
+)
+
+// gather renders the samples of the counters and gauges of reg, and the
+// sample counts of its histograms, as sorted "name{labels} value" lines.
+func gather(t *testing.T, reg *prometheus.Registry) string {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			var labels []string
+			for _, l := range m.GetLabel() {
+				labels = append(labels, l.GetName()+"="+l.GetValue())
+			}
+			var v float64
+			switch {
+			case m.GetCounter() != nil:
+				v = m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				v = m.GetGauge().GetValue()
+			case m.GetHistogram() != nil:
+				v = float64(m.GetHistogram().GetSampleCount())
+			}
+			lines = append(lines, f.GetName()+"{"+strings.Join(labels, ",")+"} "+strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func TestWithPrometheus(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests++; requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	reg := prometheus.NewRegistry()
+	client := graphql.NewClient(srv.URL, WithPrometheus(reg), graphql.WithBackoff(0, 1, 0))
+	if err := client.Run(context.Background(), graphql.NewRequest("query Foo { a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"graphql_client_request_duration_seconds{operation=Foo} 1",
+		"graphql_client_requests_in_flight{} 0",
+		"graphql_client_requests_total{code=200,error_class=,operation=Foo} 1",
+		"graphql_client_retries_total{operation=Foo} 1",
+	}, "\n")
+	if got := gather(t, reg); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,133 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrQueueTimeout is returned by Run when a request waited longer than its
+// queue timeout for a free slot, see WithMaxConcurrency.
+var ErrQueueTimeout = errors.New("graphql: timed out waiting in the request queue")
+
+// WithMaxConcurrency limits the client to n concurrent Run and RunStream
+// calls. Excess calls are queued in order until a call finishes, for at
+// most queueTimeout if it is positive; Request.SetQueueTimeout overrides
+// it per request. QueueStats reports how long calls wait.
+func WithMaxConcurrency(n int, queueTimeout time.Duration) ClientOption {
+	return func(client *Client) {
+		if n <= 0 {
+			client.queue = nil
+			return
+		}
+		client.queue = &requestQueue{slots: newSemaphore(n), timeout: queueTimeout}
+	}
+}
+
+// QueueStats describes the request queue of a client.
+type QueueStats struct {
+	// InFlight is the number of calls holding a slot.
+	InFlight int
+	// Waiting is the number of calls queued for a slot.
+	Waiting int
+	// Queued is the number of calls that had to wait for a slot.
+	Queued uint64
+	// TimedOut is the number of calls that gave up waiting.
+	TimedOut uint64
+	// TotalWait and MaxWait are the total and longest time calls waited.
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// QueueStats reports the state of the request queue. It is zero unless
+// the client was created with WithMaxConcurrency.
+func (c *Client) QueueStats() QueueStats {
+	if c.queue == nil {
+		return QueueStats{}
+	}
+	return c.queue.stats()
+}
+
+// requestQueue admits a bounded number of calls.
+type requestQueue struct {
+	slots   *semaphore
+	timeout time.Duration
+
+	mu        sync.Mutex
+	queued    uint64
+	timedOut  uint64
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+// acquire takes a slot for req, waiting at most its queue timeout.
+func (q *requestQueue) acquire(ctx context.Context, req *Request) error {
+	if q.slots.tryAcquire() {
+		return nil
+	}
+	timeout := q.timeout
+	if req.hasQueueTimeout {
+		timeout = req.queueTimeout
+	}
+	waitCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := q.slots.acquire(waitCtx)
+	wait := time.Since(start)
+	if err != nil && ctx.Err() == nil {
+		err = ErrQueueTimeout
+	}
+	q.record(wait, err == ErrQueueTimeout)
+	return err
+}
+
+// record accounts a call that waited in the queue.
+func (q *requestQueue) record(wait time.Duration, timedOut bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queued++
+	if timedOut {
+		q.timedOut++
+	}
+	q.totalWait += wait
+	if wait > q.maxWait {
+		q.maxWait = wait
+	}
+}
+
+func (q *requestQueue) release() {
+	q.slots.release()
+}
+
+func (q *requestQueue) stats() QueueStats {
+	q.slots.mu.Lock()
+	inFlight, waiting := q.slots.inflight, q.slots.waiters.Len()
+	q.slots.mu.Unlock()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueStats{
+		InFlight:  inFlight,
+		Waiting:   waiting,
+		Queued:    q.queued,
+		TimedOut:  q.timedOut,
+		TotalWait: q.totalWait,
+		MaxWait:   q.maxWait,
+	}
+}
+
+// enqueue waits for a slot in the request queue of the client, if any, and
+// returns the function releasing it.
+func (c *Client) enqueue(ctx context.Context, req *Request) (func(), error) {
+	if c.queue == nil {
+		return func() {}, nil
+	}
+	if err := c.queue.acquire(ctx, req); err != nil {
+		return nil, err
+	}
+	return c.queue.release, nil
+}
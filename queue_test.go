@@ -0,0 +1,48 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrency(t *testing.T) {
+	arrived, release := make(chan struct{}, 2), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, WithMaxConcurrency(1, 0))
+	errs := make(chan error, 2)
+	run := func() { errs <- client.Run(context.Background(), NewRequest("{ a }"), nil) }
+	go run()
+	<-arrived
+
+	req := NewRequest("{ a }")
+	req.SetQueueTimeout(20 * time.Millisecond)
+	if err := client.Run(context.Background(), req, nil); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("got %v, want ErrQueueTimeout", err)
+	}
+	go run()
+	for client.QueueStats().Waiting != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := client.QueueStats(); stats.InFlight != 1 || len(arrived) != 0 {
+		t.Errorf("got %+v with %d requests arrived, want the call queued", stats, len(arrived))
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if stats := client.QueueStats(); stats.Queued != 2 || stats.TimedOut != 1 || stats.InFlight != 0 || stats.MaxWait < 20*time.Millisecond {
+		t.Errorf("got %+v", stats)
+	}
+}
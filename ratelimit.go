@@ -0,0 +1,212 @@
+package graphql
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitHeaders names the response headers advertising the rate limit
+// budget of the server, see WithRateLimitHeaders.
+type RateLimitHeaders struct {
+	// Remaining is the header with the number of requests left in the
+	// current window.
+	Remaining string
+	// Reset is the header telling when the window resets, either as a
+	// number of seconds from now or as a Unix timestamp in seconds.
+	Reset string
+	// MinRemaining is the number of remaining requests at or below which
+	// requests are held until the reset.
+	MinRemaining int
+}
+
+// DefaultRateLimitHeaders are the commonly used X-RateLimit headers.
+var DefaultRateLimitHeaders = RateLimitHeaders{
+	Remaining: "X-RateLimit-Remaining",
+	Reset:     "X-RateLimit-Reset",
+}
+
+// WithRateLimitHeaders tracks the rate limit budget the server reports in
+// response headers and holds subsequent requests until the window resets
+// once it is nearly exhausted, instead of running into 429 responses.
+// Retries are held too. Use DefaultRateLimitHeaders for the common
+// X-RateLimit-Remaining and X-RateLimit-Reset headers.
+func WithRateLimitHeaders(headers RateLimitHeaders) ClientOption {
+	return func(client *Client) {
+		client.rateLimitHeaders = &headers
+	}
+}
+
+// unixTimestampThreshold separates delays in seconds from Unix timestamps
+// in reset headers.
+const unixTimestampThreshold = 1_000_000_000
+
+// rateLimitTransport delays requests according to the rate limit headers
+// of previous responses.
+type rateLimitTransport struct {
+	transport http.RoundTripper
+	headers   RateLimitHeaders
+	logger    logFunc
+
+	mu sync.Mutex
+	// known is set once a response reported the budget.
+	known     bool
+	remaining int
+	resetAt   time.Time
+}
+
+func newRateLimitTransport(transport http.RoundTripper, headers RateLimitHeaders, logger logFunc) *rateLimitTransport {
+	return &rateLimitTransport{transport: transport, headers: headers, logger: logger}
+}
+
+// reserve returns how long to wait before sending a request, and counts
+// the request against the known budget.
+func (t *rateLimitTransport) reserve(now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.known {
+		return 0
+	}
+	if !now.Before(t.resetAt) {
+		t.known = false
+		return 0
+	}
+	if t.remaining <= t.headers.MinRemaining {
+		return t.resetAt.Sub(now)
+	}
+	t.remaining--
+	return 0
+}
+
+// update records the budget reported by resp.
+func (t *rateLimitTransport) update(resp *http.Response, now time.Time) {
+	remaining, err := strconv.Atoi(resp.Header.Get(t.headers.Remaining))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get(t.headers.Reset), 10, 64)
+	if err != nil {
+		return
+	}
+	resetAt := now.Add(time.Duration(reset) * time.Second)
+	if reset >= unixTimestampThreshold {
+		resetAt = time.Unix(reset, 0)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.known = true
+	t.remaining = remaining
+	t.resetAt = resetAt
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for {
+		wait := t.reserve(time.Now())
+		if wait <= 0 {
+			break
+		}
+		t.logger("rate limit nearly exhausted, waiting for the reset", "host", req.URL.Host, "wait", wait)
+		if err := sleep(req.Context(), wait); err != nil {
+			if req.Body != nil {
+				_ = req.Body.Close()
+			}
+			return nil, err
+		}
+	}
+	resp, err := t.transport.RoundTrip(req)
+	if err == nil {
+		t.update(resp, time.Now())
+	}
+	return resp, err
+}
+
+// WithRateLimit limits the client to rps requests per second on average,
+// allowing bursts of up to burst requests. Every attempt takes a token,
+// retries included, and waits for one when the bucket is empty. A burst
+// below one is treated as one.
+func WithRateLimit(rps float64, burst int) ClientOption {
+	return func(client *Client) {
+		if rps <= 0 {
+			client.rateLimiter = nil
+			return
+		}
+		client.rateLimiter = newTokenBucket(rps, burst)
+	}
+}
+
+// tokenBucket is a token bucket refilled at rate tokens per second. Tokens
+// may go negative, which queues callers behind each other.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// reserve takes a token and returns how long to wait before using it.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns a token taken by reserve and not used.
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens++
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// wait blocks until a token is available or ctx is done.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	d := b.reserve(time.Now())
+	if d <= 0 {
+		return nil
+	}
+	if err := sleep(ctx, d); err != nil {
+		b.cancel()
+		return err
+	}
+	return nil
+}
+
+// tokenBucketTransport takes a token from bucket before every request.
+type tokenBucketTransport struct {
+	transport http.RoundTripper
+	bucket    *tokenBucket
+}
+
+func (t *tokenBucketTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.bucket.wait(req.Context()); err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.transport.RoundTrip(req)
+}
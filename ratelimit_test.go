@@ -0,0 +1,95 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimitTransportReserve(t *testing.T) {
+	now := time.Unix(2_000_000_000, 0)
+	resp := response(http.StatusOK)
+	resp.Header.Set("X-RateLimit-Remaining", "2")
+	resp.Header.Set("X-RateLimit-Reset", "30")
+	headers := DefaultRateLimitHeaders
+	headers.MinRemaining = 1
+	transport := newRateLimitTransport(nil, headers, noLog)
+	if wait := transport.reserve(now); wait != 0 {
+		t.Errorf("got a wait of %s with an unknown budget", wait)
+	}
+	transport.update(resp, now)
+	if wait := transport.reserve(now); wait != 0 {
+		t.Errorf("got a wait of %s with 2 requests remaining", wait)
+	}
+	if wait := transport.reserve(now.Add(10 * time.Second)); wait != 20*time.Second {
+		t.Errorf("got a wait of %s, want until the reset", wait)
+	}
+	if wait := transport.reserve(now.Add(30 * time.Second)); wait != 0 {
+		t.Errorf("got a wait of %s after the reset", wait)
+	}
+	resp.Header.Set("X-RateLimit-Remaining", "0")
+	resp.Header.Set("X-RateLimit-Reset", "2000000060")
+	transport.update(resp, now)
+	if wait := transport.reserve(now); wait != time.Minute {
+		t.Errorf("got a wait of %s, want until the Unix timestamp of the reset", wait)
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", "60")
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, WithRateLimitHeaders(DefaultRateLimitHeaders))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.Run(ctx, NewRequest("{ a }"), nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the request held until the deadline", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("got %d requests, want the exhausted budget respected", requests.Load())
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	bucket := newTokenBucket(2, 2)
+	for i, want := range []time.Duration{0, 0, 500 * time.Millisecond, time.Second} {
+		if wait := bucket.reserve(now); wait != want {
+			t.Errorf("reservation %d: got a wait of %s, want %s", i, wait, want)
+		}
+	}
+	bucket.cancel()
+	if wait := bucket.reserve(now.Add(time.Second)); wait != 0 {
+		t.Errorf("got a wait of %s once refilled", wait)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	srv, requests := countingServer(http.StatusOK)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithRateLimit(0.01, 1))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.Run(ctx, NewRequest("{ a }"), nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the request held until the deadline", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("got %d requests, want 1 within the limit", requests.Load())
+	}
+}
@@ -2,10 +2,15 @@ package graphql
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/rand/v2"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,93 +18,481 @@ import (
 
 const RetryCount = 5
 
-func NewRetryableClient(logger func(s string), defaultWaitAfterTooManyRequests time.Duration) *http.Client {
-	transport := &retryableTransport{
-		transport:                       &http.Transport{},
-		defaultWaitAfterTooManyRequests: defaultWaitAfterTooManyRequests,
-		logger:                          logger,
-	}
+// DefaultBackoff is the backoff used between retries of 502, 503 and 504
+// responses unless configured otherwise.
+var DefaultBackoff = Backoff{
+	Initial:    250 * time.Millisecond,
+	Multiplier: 2,
+	Max:        10 * time.Second,
+}
 
-	return &http.Client{
-		Transport: transport,
+// Backoff is an exponential backoff with full jitter: the wait before
+// retry n (starting at 0) is a random duration between 0 and
+// min(Max, Initial * Multiplier^n).
+type Backoff struct {
+	Initial    time.Duration
+	Multiplier float64
+	Max        time.Duration
+}
+
+// Delay returns the randomized wait before the given retry attempt.
+func (b Backoff) Delay(attempt int) time.Duration {
+	ceiling := float64(b.Initial) * math.Pow(b.Multiplier, float64(attempt))
+	if b.Max > 0 && ceiling > float64(b.Max) {
+		ceiling = float64(b.Max)
+	}
+	if ceiling < 1 {
+		return 0
 	}
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
 }
 
-type retryableTransport struct {
-	transport                       http.RoundTripper
-	defaultWaitAfterTooManyRequests time.Duration
-	logger                          func(s string)
+// RetryPolicy decides whether a request is retried. ShouldRetry is called
+// after each attempt with the number of retries done so far, the request
+// and the outcome of the attempt, and returns how long to wait before the
+// next attempt and whether to make it at all.
+type RetryPolicy interface {
+	ShouldRetry(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool)
 }
 
-func (t *retryableTransport) shouldRetry(err error, resp *http.Response) (time.Duration, bool) {
+// RetryPolicyFunc adapts an ordinary function to a RetryPolicy.
+type RetryPolicyFunc func(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool)
+
+// ShouldRetry calls f(attempt, req, resp, err).
+func (f RetryPolicyFunc) ShouldRetry(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool) {
+	return f(attempt, req, resp, err)
+}
+
+// DefaultRetryPolicy retries 502, 503 and 504 responses with Backoff, and
+// 429 responses after the delay given by their Retry-After header, or
+// WaitAfterTooManyRequests when there is none. Transport errors are not
+// retried, except attempts that ran out of their per-attempt timeout.
+type DefaultRetryPolicy struct {
+	Backoff                  Backoff
+	WaitAfterTooManyRequests time.Duration
+}
+
+// ShouldRetry implements RetryPolicy.
+func (p DefaultRetryPolicy) ShouldRetry(attempt int, _ *http.Request, resp *http.Response, err error) (time.Duration, bool) {
 	if err != nil {
+		if errors.Is(err, ErrAttemptTimeout) {
+			return p.Backoff.Delay(attempt), true
+		}
 		return 0, false // Don't retry on pure technical error
 	}
 
 	if resp.StatusCode == http.StatusBadGateway ||
 		resp.StatusCode == http.StatusServiceUnavailable ||
 		resp.StatusCode == http.StatusGatewayTimeout {
-		return 250 * time.Millisecond, true
+		return p.Backoff.Delay(attempt), true
 	}
 	if resp.StatusCode == http.StatusTooManyRequests {
 		waitTimeInSecs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
 		waitTimeDuration := time.Duration(waitTimeInSecs) * time.Second
 		if waitTimeInSecs == 0 {
-			waitTimeDuration = t.defaultWaitAfterTooManyRequests
+			waitTimeDuration = p.WaitAfterTooManyRequests
 		}
 		return waitTimeDuration, true
 	}
 	return 0, false
 }
 
-func (t *retryableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Clone the request body
-	var bodyBytes []byte
-	if req.Body != nil {
-		bodyBytes, _ = io.ReadAll(req.Body)
-		req.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+// NewRetryableClient returns an HTTP client retrying requests with
+// DefaultRetryPolicy.
+func NewRetryableClient(logger func(s string), defaultWaitAfterTooManyRequests time.Duration) *http.Client {
+	transport := NewRetryTransport(&http.Transport{}, RetryWithLogger(logger), RetryWithPolicy(DefaultRetryPolicy{
+		Backoff:                  DefaultBackoff,
+		WaitAfterTooManyRequests: defaultWaitAfterTooManyRequests,
+	}))
+
+	return &http.Client{
+		Transport: transport,
+	}
+}
+
+// RetryOption configures a RetryTransport.
+type RetryOption func(*RetryTransport)
+
+// RetryWithPolicy sets the retry policy, DefaultRetryPolicy with
+// DefaultBackoff by default.
+func RetryWithPolicy(policy RetryPolicy) RetryOption {
+	return func(t *RetryTransport) {
+		t.policy = policy
+	}
+}
+
+// RetryWithMaxRetries sets how many times a request is retried at most,
+// RetryCount by default.
+func RetryWithMaxRetries(n int) RetryOption {
+	return func(t *RetryTransport) {
+		if n < 0 {
+			n = 0
+		}
+		t.maxRetries = n
+	}
+}
+
+// RetryWithMaxElapsed bounds the time spent on a request across all its
+// attempts, like WithMaxRetryElapsed.
+func RetryWithMaxElapsed(d time.Duration) RetryOption {
+	return func(t *RetryTransport) {
+		t.maxElapsed = d
+	}
+}
+
+// RetryWithAttemptTimeout bounds each attempt, like WithAttemptTimeout.
+func RetryWithAttemptTimeout(d time.Duration) RetryOption {
+	return func(t *RetryTransport) {
+		t.attemptTimeout = d
+	}
+}
+
+// RetryWithOnRetry calls hook before each retry, like WithOnRetry.
+func RetryWithOnRetry(hook RetryHook) RetryOption {
+	return func(t *RetryTransport) {
+		t.onRetry = hook
+	}
+}
+
+// RetryWithClock replaces the clock used to wait between retries, like
+// WithClock.
+func RetryWithClock(clock Clock) RetryOption {
+	return func(t *RetryTransport) {
+		t.clock = clock
+	}
+}
+
+// RetryWithLogger sets the function retries are logged with, given the
+// message followed by key=value pairs. Retries of requests whose context
+// carries a logger attached with WithLogger are logged there instead.
+func RetryWithLogger(logger func(s string)) RetryOption {
+	return retryWithLogFunc(func(msg string, keysAndValues ...interface{}) {
+		logger(formatLog(msg, keysAndValues))
+	})
+}
+
+// retryWithLogFunc sets the function retries are logged with, keeping
+// their keys and values.
+func retryWithLogFunc(logger logFunc) RetryOption {
+	return func(t *RetryTransport) {
+		t.logger = logger
+	}
+}
+
+// NewRetryTransport returns a RoundTripper sending requests through base,
+// http.DefaultTransport if nil, with the retry semantics of the default
+// HTTP client of NewClient, to use in HTTP client chains of your own.
+func NewRetryTransport(base http.RoundTripper, opts ...RetryOption) *RetryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &RetryTransport{
+		transport:  base,
+		policy:     DefaultRetryPolicy{Backoff: DefaultBackoff},
+		maxRetries: RetryCount,
+		logger:     noLog,
+		clock:      systemClock{},
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// RetryTransport is an http.RoundTripper retrying requests according to a
+// RetryPolicy, see NewRetryTransport. The retry limit and policy can be
+// overridden per request with Request.SetMaxRetries and
+// Request.SetRetryPolicy.
+type RetryTransport struct {
+	transport  http.RoundTripper
+	policy     RetryPolicy
+	maxRetries int
+	logger     logFunc
+	// maxElapsed bounds the time spent across all attempts, zero means
+	// no bound.
+	maxElapsed time.Duration
+	// attemptTimeout bounds each attempt, zero means no bound.
+	attemptTimeout time.Duration
+	// budget, if set, limits retries across all requests.
+	budget *retryBudget
+	// onRetry, if set, is called before each retry.
+	onRetry RetryHook
+	// stats, if set, counts attempts and retries.
+	stats *clientStats
+	clock Clock
+}
+
+// Clock tells the time and waits for the retry logic of the default HTTP
+// client. Tests can inject one with WithClock to check backoff schedules
+// without real sleeps.
+type Clock interface {
+	Now() time.Time
+	// Sleep waits for d, or returns the context's error as soon as it is
+	// done.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// systemClock is the Clock of the system.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	return sleep(ctx, d)
+}
+
+// RetryHook is called before a retry is made. attempt counts the retries
+// of the request from one, delay is the wait before the retry and cause is
+// the transport error or a *StatusError for the response being retried.
+// A non-nil error aborts the request with it.
+type RetryHook func(attempt int, delay time.Duration, cause error, req *http.Request) error
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Streamed bodies of unknown length without GetBody can't be replayed,
+	// they are sent once without being buffered.
+	streamed := req.Body != nil && req.Body != http.NoBody && req.GetBody == nil && req.ContentLength <= 0
+	maxRetries, policy := t.maxRetries, t.policy
+	if o, ok := req.Context().Value(retryOverrideKey{}).(retryOverride); ok {
+		if o.maxRetries >= 0 {
+			maxRetries = o.maxRetries
+		}
+		if o.policy != nil {
+			policy = o.policy
+		}
+	}
+	// Buffer a body of known length that can't be obtained again from
+	// GetBody, unless it will never be replayed.
+	if maxRetries > 0 && req.Body != nil && req.Body != http.NoBody && req.GetBody == nil && !streamed {
+		// The length is known, sparing the copies of a growing buffer.
+		bodyBytes := make([]byte, req.ContentLength)
+		_, err := io.ReadFull(req.Body, bodyBytes)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read body: %w", err)
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(bodyBytes)), nil
+		}
 	}
 	// Send the request
-	resp, err := t.transport.RoundTrip(req)
+	if t.budget != nil {
+		t.budget.request()
+	}
+	start := t.clock.Now()
+	resp, err := t.roundTrip(req)
 	// Retry logic
 	retries := 0
-	for retries < RetryCount {
-		timeToWait, toRetry := t.shouldRetry(err, resp)
+	exhausted := false
+	var attempts []RetryAttempt
+	for {
+		timeToWait, toRetry := policy.ShouldRetry(retries, req, resp, err)
 		if !toRetry {
 			break
 		}
-		if timeToWait > 0 {
-			t.logger(fmt.Sprintf("server returned %d, retrying after %s", resp.StatusCode, timeToWait))
-			time.Sleep(timeToWait)
-		} else {
-			t.logger(fmt.Sprintf("server returned %d, retrying right now", resp.StatusCode))
+		if retries >= maxRetries {
+			exhausted = true
+			break
 		}
+		if streamed {
+			drainBody(resp)
+			return nil, &NonReplayableBodyError{StatusCode: statusCode(resp)}
+		}
+		if t.maxElapsed > 0 && t.clock.Now().Sub(start)+timeToWait >= t.maxElapsed {
+			logWarnTo(req.Context(), t.logger, "not retrying: waiting would exceed the retry time limit", append(retryFields(req, retries+1, resp, err), "wait", timeToWait, "limit", t.maxElapsed)...)
+			break
+		}
+		if t.budget != nil && !t.budget.withdraw() {
+			logWarnTo(req.Context(), t.logger, "not retrying: retry budget exhausted", retryFields(req, retries+1, resp, err)...)
+			break
+		}
+		if t.onRetry != nil {
+			cause := err
+			if cause == nil {
+				cause = &StatusError{StatusCode: resp.StatusCode}
+			}
+			if err := t.onRetry(retries+1, timeToWait, cause, req); err != nil {
+				drainBody(resp)
+				return nil, err
+			}
+		}
+		if t.stats != nil {
+			t.stats.retry(resp, err, timeToWait)
+		}
+		attempts = append(attempts, RetryAttempt{StatusCode: statusCode(resp), Err: err, Wait: timeToWait})
 		// We're going to retry, consume any response to reuse the connection.
 		drainBody(resp)
-		// Clone the request body again
-		if req.Body != nil {
-			req.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+		logWarnTo(req.Context(), t.logger, "retrying", append(retryFields(req, retries+1, resp, err), "wait", timeToWait)...)
+		if timeToWait > 0 {
+			if err := t.clock.Sleep(req.Context(), timeToWait); err != nil {
+				return nil, err
+			}
+		}
+		// Obtain the request body again
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("rewind body: %w", err)
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
 		}
 		// Retry the request
-		resp, err = t.transport.RoundTrip(req)
+		resp, err = t.roundTrip(req)
 		retries++
 	}
-	if retries >= RetryCount {
-		if err != nil {
-			return resp, fmt.Errorf("retry limit reached (err=%s)", err.Error())
-		}
-		return resp, fmt.Errorf("retry limit reached")
+	if exhausted && maxRetries > 0 {
+		drainBody(resp)
+		attempts = append(attempts, RetryAttempt{StatusCode: statusCode(resp), Err: err})
+		return nil, &RetryExhaustedError{Attempts: attempts}
 	}
 	// Return the response
 	return resp, err
 }
 
+// NonReplayableBodyError is returned when a request should be retried but
+// its body was streamed from a reader that can't be rewound, such as an
+// upload whose reader doesn't implement io.Seeker.
+type NonReplayableBodyError struct {
+	// StatusCode is the status of the response that asked for a retry.
+	StatusCode int
+}
+
+func (e *NonReplayableBodyError) Error() string {
+	return fmt.Sprintf("server returned %d but the request body can't be replayed for a retry", e.StatusCode)
+}
+
+// RetryAttempt describes an attempt of a request that was retried.
+type RetryAttempt struct {
+	// StatusCode is the status of the response, zero if the attempt
+	// failed with Err.
+	StatusCode int
+	Err        error
+	// Wait is the time waited before the next attempt.
+	Wait time.Duration
+}
+
+// RetryExhaustedError is returned when a request still fails after the
+// retry limit is reached.
+type RetryExhaustedError struct {
+	// Attempts lists the attempts in order, the last one included.
+	Attempts []RetryAttempt
+}
+
+func (e *RetryExhaustedError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "retry limit reached after %d attempts:", len(e.Attempts))
+	for i, a := range e.Attempts {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		if a.Err != nil {
+			fmt.Fprintf(&b, " %s", a.Err)
+		} else {
+			fmt.Fprintf(&b, " %d", a.StatusCode)
+		}
+		if a.Wait > 0 {
+			fmt.Fprintf(&b, " (waited %s)", a.Wait)
+		}
+	}
+	return b.String()
+}
+
+// Unwrap returns the error of the last attempt, if it failed with one.
+func (e *RetryExhaustedError) Unwrap() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return e.Attempts[len(e.Attempts)-1].Err
+}
+
+// LastStatusCode returns the status of the last response, zero if the last
+// attempt failed with an error.
+func (e *RetryExhaustedError) LastStatusCode() int {
+	if len(e.Attempts) == 0 {
+		return 0
+	}
+	return e.Attempts[len(e.Attempts)-1].StatusCode
+}
+
+// retryOverrideKey is the context key of a per-request retryOverride.
+type retryOverrideKey struct{}
+
+// retryOverride replaces the transport's retry settings for one request.
+type retryOverride struct {
+	// maxRetries is the number of retries allowed, or -1 to keep the
+	// transport's default.
+	maxRetries int
+	policy     RetryPolicy
+}
+
+// roundTrip sends a single attempt of req.
+func (t *RetryTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	if t.stats != nil {
+		t.stats.attempts.Add(1)
+	}
+	if t.attemptTimeout <= 0 {
+		return t.transport.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.attemptTimeout)
+	resp, err := t.transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		if ctx.Err() == context.DeadlineExceeded && req.Context().Err() == nil {
+			err = fmt.Errorf("%w after %s: %w", ErrAttemptTimeout, t.attemptTimeout, err)
+		}
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// ErrAttemptTimeout is returned when an attempt runs out of its
+// per-attempt timeout, see WithAttemptTimeout. DefaultRetryPolicy retries
+// such attempts.
+var ErrAttemptTimeout = errors.New("attempt timed out")
+
+// sleep waits for d, or returns the context's error as soon as it is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryFields returns the keys and values logged about the outcome of an
+// attempt to send req, attempt being the number of the retry.
+func retryFields(req *http.Request, attempt int, resp *http.Response, err error) []interface{} {
+	fields := []interface{}{"host", req.URL.Host, "attempt", attempt}
+	if err != nil {
+		return append(fields, "error", err)
+	}
+	return append(fields, "status", resp.StatusCode)
+}
+
+// statusCode returns the status of resp, or 0 if there is no response.
+func statusCode(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+// drainBody reads and closes the body of resp, if any, so its connection
+// can be reused.
 func drainBody(resp *http.Response) {
-	if resp.Body != nil {
+	if resp != nil && resp.Body != nil {
 		_, _ = io.Copy(io.Discard, resp.Body)
 		err := resp.Body.Close()
-		if err != nil {
-			fmt.Println(err)
+		if err != nil && resp.Request != nil {
+			reportError(resp.Request.Context(), fmt.Errorf("close response body: %w", err))
 		}
 	}
 }
@@ -0,0 +1,458 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// response returns a response with status and an empty body.
+func response(status int) *http.Response {
+	return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}
+}
+
+// recordingClock records the sleeps of the retry logic without waiting.
+type recordingClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *recordingClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *recordingClock) Sleep(_ context.Context, d time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	return nil
+}
+
+// statuses answers the successive attempts with the given statuses,
+// recording their bodies.
+func statuses(codes ...int) (http.RoundTripper, *[]string) {
+	var bodies []string
+	return roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		var body []byte
+		if r.Body != nil {
+			body, _ = io.ReadAll(r.Body)
+		}
+		bodies = append(bodies, string(body))
+		return response(codes[min(len(bodies), len(codes))-1]), nil
+	}), &bodies
+}
+
+// newRequest returns a POST request whose body can only be read once.
+func newRequest(body string) *http.Request {
+	r, _ := http.NewRequest(http.MethodPost, "http://example.com", nil)
+	r.Body = io.NopCloser(strings.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return r
+}
+
+func TestRetryTransportReplaysBody(t *testing.T) {
+	base, bodies := statuses(503, 502, 200)
+	clock := &recordingClock{}
+	transport := NewRetryTransport(base, RetryWithClock(clock))
+	resp, err := transport.RoundTrip(newRequest("query"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d", resp.StatusCode)
+	}
+	if strings.Join(*bodies, ",") != "query,query,query" {
+		t.Errorf("got bodies %q", *bodies)
+	}
+	if len(clock.sleeps) != 2 {
+		t.Errorf("got %d sleeps, want 2", len(clock.sleeps))
+	}
+}
+
+func TestRetryTransportRetryAfter(t *testing.T) {
+	calls := 0
+	base := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		if calls == 1 {
+			resp := response(http.StatusTooManyRequests)
+			resp.Header.Set("Retry-After", "3")
+			return resp, nil
+		}
+		return response(http.StatusOK), nil
+	})
+	clock := &recordingClock{}
+	transport := NewRetryTransport(base, RetryWithClock(clock))
+	if _, err := transport.RoundTrip(newRequest("query")); err != nil {
+		t.Fatal(err)
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != 3*time.Second {
+		t.Errorf("got sleeps %v, want [3s]", clock.sleeps)
+	}
+}
+
+func TestRetryTransportExhausted(t *testing.T) {
+	base, bodies := statuses(503)
+	transport := NewRetryTransport(base, RetryWithClock(&recordingClock{}), RetryWithMaxRetries(2))
+	_, err := transport.RoundTrip(newRequest("query"))
+	var exhausted *RetryExhaustedError
+	if !errors.As(err, &exhausted) {
+		t.Fatalf("got %v, want a RetryExhaustedError", err)
+	}
+	if len(exhausted.Attempts) != 3 || exhausted.LastStatusCode() != http.StatusServiceUnavailable || len(*bodies) != 3 {
+		t.Errorf("got %+v after %d attempts", exhausted.Attempts, len(*bodies))
+	}
+}
+
+func TestRetryTransportMaxElapsed(t *testing.T) {
+	base, bodies := statuses(429)
+	policy := RetryPolicyFunc(func(int, *http.Request, *http.Response, error) (time.Duration, bool) {
+		return time.Minute, true
+	})
+	transport := NewRetryTransport(base, RetryWithClock(&recordingClock{}), RetryWithPolicy(policy), RetryWithMaxElapsed(90*time.Second))
+	resp, err := transport.RoundTrip(newRequest("query"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests || len(*bodies) != 2 {
+		t.Errorf("got status %d after %d attempts, want 429 after 2", resp.StatusCode, len(*bodies))
+	}
+}
+
+func TestRetryTransportOnRetryAborts(t *testing.T) {
+	base, bodies := statuses(503)
+	abort := errors.New("abort")
+	var causes []error
+	hook := func(attempt int, delay time.Duration, cause error, req *http.Request) error {
+		causes = append(causes, cause)
+		return abort
+	}
+	transport := NewRetryTransport(base, RetryWithClock(&recordingClock{}), RetryWithOnRetry(hook))
+	if _, err := transport.RoundTrip(newRequest("query")); !errors.Is(err, abort) {
+		t.Fatalf("got %v, want the error of the hook", err)
+	}
+	var statusErr *StatusError
+	if len(*bodies) != 1 || len(causes) != 1 || !errors.As(causes[0], &statusErr) || statusErr.StatusCode != 503 {
+		t.Errorf("got causes %v after %d attempts", causes, len(*bodies))
+	}
+}
+
+func TestRetryTransportGetBody(t *testing.T) {
+	base, bodies := statuses(503, 503, 200)
+	r := newRequest("query")
+	getBodies := 0
+	r.GetBody = func() (io.ReadCloser, error) {
+		getBodies++
+		return io.NopCloser(strings.NewReader("query")), nil
+	}
+	transport := NewRetryTransport(base, RetryWithClock(&recordingClock{}))
+	if _, err := transport.RoundTrip(r); err != nil {
+		t.Fatal(err)
+	}
+	if getBodies != 2 || strings.Join(*bodies, ",") != "query,query,query" {
+		t.Errorf("got bodies %q with %d calls to GetBody, want the retries replayed from it", *bodies, getBodies)
+	}
+}
+
+func TestRetryTransportBodyNotBufferedWithoutRetries(t *testing.T) {
+	r := newRequest("query")
+	body := r.Body
+	base := roundTripFunc(func(got *http.Request) (*http.Response, error) {
+		if got.Body != body {
+			t.Error("got the body buffered")
+		}
+		return response(http.StatusOK), nil
+	})
+	transport := NewRetryTransport(base, RetryWithMaxRetries(0))
+	if _, err := transport.RoundTrip(r); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetryTransportNonReplayableBody(t *testing.T) {
+	base, bodies := statuses(503)
+	transport := NewRetryTransport(base, RetryWithClock(&recordingClock{}))
+	r := newRequest("stream")
+	r.ContentLength = -1
+	_, err := transport.RoundTrip(r)
+	var nonReplayable *NonReplayableBodyError
+	if !errors.As(err, &nonReplayable) || nonReplayable.StatusCode != 503 {
+		t.Fatalf("got %v, want a NonReplayableBodyError", err)
+	}
+	if len(*bodies) != 1 {
+		t.Errorf("got %d attempts, want 1", len(*bodies))
+	}
+}
+
+func TestRetryTransportDoesNotRetryTransportErrors(t *testing.T) {
+	calls := 0
+	failure := errors.New("connection refused")
+	base := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		return nil, failure
+	})
+	transport := NewRetryTransport(base, RetryWithClock(&recordingClock{}))
+	if _, err := transport.RoundTrip(newRequest("query")); !errors.Is(err, failure) {
+		t.Fatalf("got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("got %d attempts, want 1", calls)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Initial: 100 * time.Millisecond, Multiplier: 2, Max: time.Second}
+	for attempt, ceiling := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		for i := 0; i < 100; i++ {
+			if d := b.Delay(attempt); d < 0 || d > ceiling {
+				t.Fatalf("attempt %d: got %s, want at most %s", attempt, d, ceiling)
+			}
+		}
+	}
+}
+
+// stoppedClock is a Clock whose Sleep fails with err.
+type stoppedClock struct{ err error }
+
+func (stoppedClock) Now() time.Time { return time.Time{} }
+
+func (c stoppedClock) Sleep(context.Context, time.Duration) error { return c.err }
+
+func TestRetryTransportClock(t *testing.T) {
+	base, bodies := statuses(503, 200)
+	stop := errors.New("stop")
+	transport := NewRetryTransport(base, RetryWithClock(stoppedClock{stop}))
+	if _, err := transport.RoundTrip(newRequest("query")); !errors.Is(err, stop) {
+		t.Fatalf("got %v, want the error of the clock", err)
+	}
+	if len(*bodies) != 1 {
+		t.Errorf("got %d attempts, want 1", len(*bodies))
+	}
+}
+
+func TestSystemClockSleep(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := (systemClock{}).Sleep(ctx, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	start := time.Now()
+	if err := (systemClock{}).Sleep(ctx, time.Hour); !errors.Is(err, context.Canceled) || time.Since(start) > time.Second {
+		t.Errorf("got %v after %s, want context.Canceled at once", err, time.Since(start))
+	}
+}
+
+// sequenceServer answers the successive requests with the given statuses,
+// the last one repeated, counting the requests. 429 responses ask to
+// retry after a minute.
+func sequenceServer(codes ...int) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := codes[min(int(requests.Add(1)), len(codes))-1]
+		if code == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "60")
+		}
+		w.WriteHeader(code)
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	return srv, &requests
+}
+
+func TestClientBackoff(t *testing.T) {
+	srv, requests := sequenceServer(503, 502, 504, 200)
+	defer srv.Close()
+	clock := &recordingClock{}
+	client := NewClient(srv.URL, WithClock(clock), WithBackoff(100*time.Millisecond, 2, 300*time.Millisecond))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 4 || len(clock.sleeps) != 3 {
+		t.Fatalf("got %d requests and sleeps %v", requests.Load(), clock.sleeps)
+	}
+	for i, ceiling := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond} {
+		if clock.sleeps[i] < 0 || clock.sleeps[i] > ceiling {
+			t.Errorf("got sleep %d of %s, want at most %s", i, clock.sleeps[i], ceiling)
+		}
+	}
+}
+
+func TestClientRetryPolicy(t *testing.T) {
+	srv, requests := sequenceServer(400, 200)
+	defer srv.Close()
+	clock := &recordingClock{}
+	var attempts []int
+	policy := RetryPolicyFunc(func(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool) {
+		attempts = append(attempts, attempt)
+		return time.Second, resp != nil && resp.StatusCode == http.StatusBadRequest
+	})
+	client := NewClient(srv.URL, WithClock(clock), WithRetryPolicy(policy), WithBackoff(time.Hour, 1, time.Hour))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 2 || len(clock.sleeps) != 1 || clock.sleeps[0] != time.Second {
+		t.Errorf("got %d requests and sleeps %v, want the 400 retried after the delay of the policy", requests.Load(), clock.sleeps)
+	}
+	if len(attempts) != 2 || attempts[0] != 0 || attempts[1] != 1 {
+		t.Errorf("got the policy called for attempts %v, want 0 and 1", attempts)
+	}
+}
+
+func TestRetrySleepCanceled(t *testing.T) {
+	srv, requests := sequenceServer(429)
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	err := client.Run(ctx, NewRequest("{ a }"), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s, want promptly after the cancellation", elapsed)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("got %d requests, want 1", requests.Load())
+	}
+}
+
+func TestClientMaxRetryElapsed(t *testing.T) {
+	srv, requests := sequenceServer(429)
+	defer srv.Close()
+	clock := &recordingClock{}
+	client := NewClient(srv.URL, WithClock(clock), WithMaxRetryElapsed(90*time.Second))
+	err := client.Run(context.Background(), NewRequest("{ a }"), nil)
+	var status *StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("got %v, want the last 429", err)
+	}
+	if requests.Load() != 2 || len(clock.sleeps) != 1 {
+		t.Errorf("got %d requests and sleeps %v, want one retry within 90s", requests.Load(), clock.sleeps)
+	}
+}
+
+func TestRequestRetryOverrides(t *testing.T) {
+	for name, tt := range map[string]struct {
+		set  func(*Request)
+		want int32
+	}{
+		"default":     {func(*Request) {}, RetryCount + 1},
+		"max retries": {func(r *Request) { r.SetMaxRetries(0) }, 1},
+		"more":        {func(r *Request) { r.SetMaxRetries(RetryCount + 2) }, RetryCount + 3},
+		"policy": {func(r *Request) {
+			r.SetRetryPolicy(RetryPolicyFunc(func(int, *http.Request, *http.Response, error) (time.Duration, bool) {
+				return 0, false
+			}))
+		}, 1},
+	} {
+		srv, requests := sequenceServer(503)
+		client := NewClient(srv.URL, WithClock(&recordingClock{}))
+		req := NewRequest("{ a }")
+		tt.set(req)
+		if err := client.Run(context.Background(), req, nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if requests.Load() != tt.want {
+			t.Errorf("%s: got %d requests, want %d", name, requests.Load(), tt.want)
+		}
+		srv.Close()
+	}
+}
+
+func TestClientOnRetry(t *testing.T) {
+	srv, _ := sequenceServer(429, 503, 200)
+	defer srv.Close()
+	clock := &recordingClock{}
+	var calls []string
+	client := NewClient(srv.URL, WithClock(clock), WithOnRetry(func(attempt int, delay time.Duration, cause error, req *http.Request) error {
+		var status *StatusError
+		if !errors.As(cause, &status) || req.URL.String() != srv.URL {
+			t.Errorf("got cause %v for %s", cause, req.URL)
+			return nil
+		}
+		calls = append(calls, fmt.Sprint(attempt, " ", status.StatusCode))
+		if attempt == 1 && delay != time.Minute {
+			t.Errorf("got a delay of %s, want the Retry-After", delay)
+		}
+		return nil
+	}))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(calls, ","); got != "1 429,2 503" {
+		t.Errorf("got hook calls %q", got)
+	}
+}
+
+func TestRetryExhaustedErrorHistory(t *testing.T) {
+	srv, _ := sequenceServer(429, 503)
+	defer srv.Close()
+	req := NewRequest("{ a }")
+	req.SetMaxRetries(2)
+	err := NewClient(srv.URL, WithClock(&recordingClock{}), WithBackoff(time.Second, 1, time.Second)).Run(context.Background(), req, nil)
+	var exhausted *RetryExhaustedError
+	if !errors.As(err, &exhausted) {
+		t.Fatalf("got %v, want a RetryExhaustedError", err)
+	}
+	want := []int{429, 503, 503}
+	if len(exhausted.Attempts) != len(want) {
+		t.Fatalf("got attempts %+v", exhausted.Attempts)
+	}
+	for i, a := range exhausted.Attempts {
+		if a.StatusCode != want[i] {
+			t.Errorf("attempt %d: got status %d, want %d", i, a.StatusCode, want[i])
+		}
+	}
+	if exhausted.Attempts[0].Wait != time.Minute || exhausted.Attempts[2].Wait != 0 {
+		t.Errorf("got attempts %+v, want the waits recorded", exhausted.Attempts)
+	}
+	if !strings.Contains(err.Error(), "retry limit reached after 3 attempts: 429 (waited 1m0s), 503") {
+		t.Errorf("got message %q", err)
+	}
+}
+
+func TestAttemptTimeout(t *testing.T) {
+	srv, requests := hangingServer(make(chan struct{}, 1))
+	defer srv.Close()
+	client := NewClient(srv.URL, WithClock(&recordingClock{}), WithAttemptTimeout(50*time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Run(ctx, NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("got %d requests, want the hung attempt retried", requests.Load())
+	}
+}
+
+func TestWithoutRetry(t *testing.T) {
+	srv, requests := sequenceServer(503)
+	defer srv.Close()
+	err := NewClient(srv.URL, WithoutRetry()).Run(context.Background(), NewRequest("{ a }"), nil)
+	var status *StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got %v, want the raw 503", err)
+	}
+	var exhausted *RetryExhaustedError
+	if errors.As(err, &exhausted) || requests.Load() != 1 {
+		t.Errorf("got %v after %d requests, want a single attempt", err, requests.Load())
+	}
+}
@@ -0,0 +1,451 @@
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// document is a GraphQL document parsed down to the selection sets of its
+// operations and fragments, which WithNormalizedEntities needs to answer
+// queries from the entities.
+type document struct {
+	operations []operationDefinition
+	fragments  map[string]fragmentDefinition
+}
+
+// operationDefinition is an operation of a document with its selections.
+type operationDefinition struct {
+	operation
+	selections []selection
+}
+
+// fragmentDefinition is a named fragment with its type condition.
+type fragmentDefinition struct {
+	on         string
+	selections []selection
+}
+
+// selection is a field, a fragment spread or an inline fragment of a
+// selection set.
+type selection struct {
+	// alias and name are those of a field; name is empty for fragments.
+	alias, name string
+	args        map[string]interface{}
+	// spread is the name of the fragment of a spread, and on the type
+	// condition of an inline fragment, if any.
+	spread, on string
+	directives bool
+	selections []selection
+}
+
+// responseName returns the key of the field in the response.
+func (s selection) responseName() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+// variable is a reference to a variable in an argument value.
+type variable string
+
+// errUnsupportedDocument is returned for the documents parseDocument
+// doesn't understand, invalid ones and those with block strings.
+var errUnsupportedDocument = errors.New("graphql: unsupported document")
+
+// parseDocument parses doc. Variable definitions are skipped, and argument
+// values are kept with their variables unresolved: integers and floats as
+// json.Number, strings and enum values as strings.
+func parseDocument(doc string) (*document, error) {
+	p := &parser{doc: doc}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	d := &document{fragments: make(map[string]fragmentDefinition)}
+	for p.kind != tokenEOF {
+		if p.punct("{") {
+			set, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			d.operations = append(d.operations, operationDefinition{operation: operation{typ: OperationQuery}, selections: set})
+			continue
+		}
+		word, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		switch word {
+		case OperationQuery, OperationMutation, OperationSubscription:
+			op := operationDefinition{operation: operation{typ: word}}
+			if p.kind == tokenName {
+				if op.name, err = p.name(); err != nil {
+					return nil, err
+				}
+			}
+			if p.punct("(") {
+				if err := p.skipGroup(); err != nil {
+					return nil, err
+				}
+			}
+			if _, err := p.directives(); err != nil {
+				return nil, err
+			}
+			if op.selections, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+			d.operations = append(d.operations, op)
+		case "fragment":
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if on, err := p.name(); err != nil || on != "on" {
+				return nil, errUnsupportedDocument
+			}
+			var fragment fragmentDefinition
+			if fragment.on, err = p.name(); err != nil {
+				return nil, err
+			}
+			if _, err := p.directives(); err != nil {
+				return nil, err
+			}
+			if fragment.selections, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+			d.fragments[name] = fragment
+		default:
+			return nil, errUnsupportedDocument
+		}
+	}
+	return d, nil
+}
+
+// operation returns the definition of the operation that will be
+// executed, as selectOperation does.
+func (d *document) operation(name string) (*operationDefinition, bool) {
+	for i := range d.operations {
+		if name == "" || d.operations[i].name == name {
+			return &d.operations[i], true
+		}
+	}
+	return nil, false
+}
+
+// tokenKind is the kind of a lexical token of a document.
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenNumber
+	tokenString
+)
+
+// parser reads a document token by token, the current one being kind
+// and text.
+type parser struct {
+	doc  string
+	i    int
+	kind tokenKind
+	text string
+}
+
+// next moves to the next token, skipping whitespace, commas and comments.
+func (p *parser) next() error {
+	for p.i < len(p.doc) {
+		ch := p.doc[p.i]
+		if ch == '#' {
+			for p.i < len(p.doc) && p.doc[p.i] != '\n' && p.doc[p.i] != '\r' {
+				p.i++
+			}
+			continue
+		}
+		if ch != ' ' && ch != '\t' && ch != '\n' && ch != '\r' && ch != ',' {
+			break
+		}
+		p.i++
+	}
+	start := p.i
+	switch {
+	case p.i >= len(p.doc):
+		p.kind = tokenEOF
+	case isNameStart(p.doc[p.i]):
+		for p.i < len(p.doc) && isNameContinue(p.doc[p.i]) {
+			p.i++
+		}
+		p.kind = tokenName
+	case p.doc[p.i] == '-' || (p.doc[p.i] >= '0' && p.doc[p.i] <= '9'):
+		p.i++
+		for p.i < len(p.doc) && (isNameContinue(p.doc[p.i]) || strings.IndexByte(".+-", p.doc[p.i]) >= 0) {
+			p.i++
+		}
+		p.kind = tokenNumber
+	case strings.HasPrefix(p.doc[p.i:], `"""`):
+		return errUnsupportedDocument
+	case p.doc[p.i] == '"':
+		p.i = skipString(p.doc, p.i)
+		p.kind = tokenString
+	case strings.HasPrefix(p.doc[p.i:], "..."):
+		p.i += 3
+		p.kind = tokenPunct
+	case strings.IndexByte("!$&()=:@[]{}|", p.doc[p.i]) >= 0:
+		p.i++
+		p.kind = tokenPunct
+	default:
+		return errUnsupportedDocument
+	}
+	p.text = p.doc[start:p.i]
+	return nil
+}
+
+// punct reports whether the current token is the punctuator s.
+func (p *parser) punct(s string) bool {
+	return p.kind == tokenPunct && p.text == s
+}
+
+// expect moves past the punctuator s.
+func (p *parser) expect(s string) error {
+	if !p.punct(s) {
+		return errUnsupportedDocument
+	}
+	return p.next()
+}
+
+// name returns the current token, a name, moving past it.
+func (p *parser) name() (string, error) {
+	if p.kind != tokenName {
+		return "", errUnsupportedDocument
+	}
+	name := p.text
+	return name, p.next()
+}
+
+// skipGroup moves past a parenthesised group, such as variable
+// definitions.
+func (p *parser) skipGroup() error {
+	for depth := 0; ; {
+		switch {
+		case p.kind == tokenEOF:
+			return errUnsupportedDocument
+		case p.punct("("):
+			depth++
+		case p.punct(")"):
+			if depth--; depth == 0 {
+				return p.next()
+			}
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+	}
+}
+
+// directives moves past the directives at the current token, reporting
+// whether there were any.
+func (p *parser) directives() (bool, error) {
+	found := false
+	for p.punct("@") {
+		found = true
+		if err := p.next(); err != nil {
+			return false, err
+		}
+		if _, err := p.name(); err != nil {
+			return false, err
+		}
+		if p.punct("(") {
+			if _, err := p.arguments(); err != nil {
+				return false, err
+			}
+		}
+	}
+	return found, nil
+}
+
+func (p *parser) selectionSet() ([]selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var set []selection
+	for !p.punct("}") {
+		s, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, s)
+	}
+	return set, p.next()
+}
+
+func (p *parser) selection() (selection, error) {
+	var s selection
+	var err error
+	if p.punct("...") {
+		if err := p.next(); err != nil {
+			return s, err
+		}
+		if p.kind == tokenName && p.text != "on" {
+			if s.spread, err = p.name(); err != nil {
+				return s, err
+			}
+			s.directives, err = p.directives()
+			return s, err
+		}
+		if p.kind == tokenName {
+			if err := p.next(); err != nil {
+				return s, err
+			}
+			if s.on, err = p.name(); err != nil {
+				return s, err
+			}
+		}
+		if s.directives, err = p.directives(); err != nil {
+			return s, err
+		}
+		s.selections, err = p.selectionSet()
+		return s, err
+	}
+	if s.name, err = p.name(); err != nil {
+		return s, err
+	}
+	if p.punct(":") {
+		if err := p.next(); err != nil {
+			return s, err
+		}
+		s.alias = s.name
+		if s.name, err = p.name(); err != nil {
+			return s, err
+		}
+	}
+	if p.punct("(") {
+		if s.args, err = p.arguments(); err != nil {
+			return s, err
+		}
+	}
+	if s.directives, err = p.directives(); err != nil {
+		return s, err
+	}
+	if p.punct("{") {
+		s.selections, err = p.selectionSet()
+	}
+	return s, err
+}
+
+func (p *parser) arguments() (map[string]interface{}, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args := make(map[string]interface{})
+	for !p.punct(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.value(); err != nil {
+			return nil, err
+		}
+	}
+	return args, p.next()
+}
+
+func (p *parser) value() (interface{}, error) {
+	text := p.text
+	switch {
+	case p.kind == tokenNumber:
+		if !json.Valid([]byte(text)) {
+			return nil, errUnsupportedDocument
+		}
+		return json.Number(text), p.next()
+	case p.kind == tokenString:
+		var s string
+		if err := json.Unmarshal([]byte(text), &s); err != nil {
+			return nil, errUnsupportedDocument
+		}
+		return s, p.next()
+	case p.kind == tokenName:
+		var v interface{}
+		switch text {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+		default:
+			// an enum value
+			v = text
+		}
+		return v, p.next()
+	case p.punct("$"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return variable(name), err
+	case p.punct("["):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for !p.punct("]") {
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.next()
+	case p.punct("{"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		obj := make(map[string]interface{})
+		for !p.punct("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if obj[name], err = p.value(); err != nil {
+				return nil, err
+			}
+		}
+		return obj, p.next()
+	}
+	return nil, errUnsupportedDocument
+}
+
+// resolveVariables returns v with its variables replaced by their values
+// in vars, and whether they all have one.
+func resolveVariables(v interface{}, vars map[string]interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case variable:
+		value, ok := vars[string(v)]
+		return value, ok
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			var ok bool
+			if list[i], ok = resolveVariables(item, vars); !ok {
+				return nil, false
+			}
+		}
+		return list, true
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for name, field := range v {
+			var ok bool
+			if obj[name], ok = resolveVariables(field, vars); !ok {
+				return nil, false
+			}
+		}
+		return obj, true
+	}
+	return v, true
+}
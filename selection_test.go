@@ -0,0 +1,63 @@
+package graphql
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseDocument(t *testing.T) {
+	doc, err := parseDocument(`
+		# the user
+		query GetUser($id: ID!, $n: Int = 10) @cached {
+			me: user(id: $id, filter: {tags: ["a", "b\"c"], min: -1.5, on: true, role: ADMIN, x: null}) {
+				name @include(if: true)
+				...Fields
+				... on User { id }
+			}
+		}
+		fragment Fields on User { email }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op, ok := doc.operation("GetUser")
+	if !ok || op.typ != OperationQuery || len(op.selections) != 1 {
+		t.Fatalf("got %+v, %v", op, ok)
+	}
+	user := op.selections[0]
+	if user.responseName() != "me" || user.name != "user" || user.args["id"] != variable("id") {
+		t.Errorf("got %+v", user)
+	}
+	filter := map[string]interface{}{"tags": []interface{}{"a", `b"c`}, "min": json.Number("-1.5"), "on": true, "role": "ADMIN", "x": nil}
+	if !reflect.DeepEqual(user.args["filter"], filter) {
+		t.Errorf("got filter %#v", user.args["filter"])
+	}
+	if len(user.selections) != 3 || !user.selections[0].directives || user.selections[1].spread != "Fields" || user.selections[2].on != "User" {
+		t.Errorf("got selections %+v", user.selections)
+	}
+	if fragment := doc.fragments["Fields"]; fragment.on != "User" || len(fragment.selections) != 1 {
+		t.Errorf("got fragment %+v", fragment)
+	}
+	if resolved, ok := resolveVariables(user.args["id"], map[string]interface{}{"id": "1"}); !ok || resolved != "1" {
+		t.Errorf("got %v, %v", resolved, ok)
+	}
+	if _, ok := resolveVariables(user.args["id"], nil); ok {
+		t.Error("resolved a missing variable")
+	}
+}
+
+func TestParseDocumentUnsupported(t *testing.T) {
+	for _, doc := range []string{
+		`{ a(s: """block""") }`,
+		`{ a(n: 01) }`,
+		`{ a { b }`,
+		`query ($a: Int { a }`,
+		`fragment F User { a }`,
+		`{ a } %`,
+	} {
+		if _, err := parseDocument(doc); err == nil {
+			t.Errorf("%s: no error", doc)
+		}
+	}
+}
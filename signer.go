@@ -0,0 +1,48 @@
+package graphql
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Signer signs requests, e.g. with AWS SigV4 for AppSync IAM auth or the
+// HMAC scheme of a gateway. Sign is called for every attempt, retries
+// included, right before it is sent with its final headers, so signatures
+// carry a fresh timestamp. It may set headers of req and read its body
+// from req.GetBody, which leaves req.Body untouched; GetBody is nil for
+// streamed multipart bodies that can't be read twice.
+type Signer interface {
+	Sign(req *http.Request) error
+}
+
+// SignerFunc adapts an ordinary function to a Signer.
+type SignerFunc func(req *http.Request) error
+
+// Sign calls f(req).
+func (f SignerFunc) Sign(req *http.Request) error {
+	return f(req)
+}
+
+// WithSigner signs every request sent by the client with s.
+func WithSigner(s Signer) ClientOption {
+	return func(client *Client) {
+		client.signer = s
+	}
+}
+
+// signingTransport signs requests before sending them.
+type signingTransport struct {
+	transport http.RoundTripper
+	signer    Signer
+}
+
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if err := t.signer.Sign(req); err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, fmt.Errorf("sign request: %w", err)
+	}
+	return t.transport.RoundTrip(req)
+}
@@ -0,0 +1,64 @@
+package graphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestSigner(t *testing.T) {
+	var signatures []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(append(body, r.Header.Get("X-Attempt")...))
+		if r.Header.Get("X-Signature") != hex.EncodeToString(sum[:]) {
+			t.Error("got a request whose signature doesn't match its body")
+		}
+		signatures = append(signatures, r.Header.Get("X-Signature"))
+		if len(signatures) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	attempt := 0
+	signer := SignerFunc(func(req *http.Request) error {
+		attempt++
+		body, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		b, _ := io.ReadAll(body)
+		req.Header.Set("X-Attempt", strconv.Itoa(attempt))
+		sum := sha256.Sum256(append(b, req.Header.Get("X-Attempt")...))
+		req.Header.Set("X-Signature", hex.EncodeToString(sum[:]))
+		return nil
+	})
+	client := NewClient(srv.URL, WithSigner(signer), WithClock(&recordingClock{}))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(signatures) != 2 || signatures[0] == signatures[1] {
+		t.Errorf("got signatures %q, want the retry signed again", signatures)
+	}
+}
+
+func TestSignerError(t *testing.T) {
+	srv, requests := countingServer(http.StatusOK)
+	defer srv.Close()
+	denied := errors.New("no credentials")
+	client := NewClient(srv.URL, WithSigner(SignerFunc(func(*http.Request) error { return denied })))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); !errors.Is(err, denied) {
+		t.Errorf("got %v, want the error of the signer", err)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("got %d requests, want none unsigned", requests.Load())
+	}
+}
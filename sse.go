@@ -0,0 +1,373 @@
+package graphql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SSEMode selects how subscriptions use the GraphQL over Server-Sent
+// Events protocol, see WithSSESubscriptions.
+type SSEMode int
+
+const (
+	// SSEDistinctConnections streams each subscription in the response to
+	// its own request.
+	SSEDistinctConnections SSEMode = iota + 1
+	// SSESingleConnection streams all the subscriptions of the client over
+	// one event stream, reserved with a PUT request and opened with a
+	// GET, while operations are POSTed with the token of the stream.
+	SSESingleConnection
+)
+
+// sseTokenHeader carries the token of a single connection event stream.
+const sseTokenHeader = "X-GraphQL-Event-Stream-Token"
+
+// WithSSESubscriptions makes Subscribe use the GraphQL over Server-Sent
+// Events protocol (graphql-sse) in mode rather than WebSockets, where
+// those are blocked. The requests go through the HTTP client of the
+// client, so its per-attempt timeout, if any, bounds the streams too.
+func WithSSESubscriptions(mode SSEMode) ClientOption {
+	return func(client *Client) {
+		client.sseMode = mode
+	}
+}
+
+// sseEndpoint returns the endpoint of event streams.
+func (c *Client) sseEndpoint() string {
+	if c.subscriptionEndpoint != "" {
+		return unixEndpoint(c.subscriptionEndpoint)
+	}
+	return unixEndpoint(c.endpoint)
+}
+
+// subscribeSSE starts the subscription req over an event stream.
+func (c *Client) subscribeSSE(ctx context.Context, req *Request) (*subscription, error) {
+	c.logDebugRequest(ctx, req)
+	if c.sseMode == SSESingleConnection {
+		for {
+			conn, err := c.sseConn(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			sub, err := conn.subscribe(ctx, req)
+			if errors.Is(err, errConnectionClosed) {
+				continue
+			}
+			return sub, err
+		}
+	}
+	streamCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	r, err := c.newSSERequest(streamCtx, http.MethodPost, req, c.envelope(req))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp, err := c.openEventStream(r)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	sub := c.newSubscription("", req)
+	sub.cancel = cancel
+	sub.done = cancel
+	go func() {
+		defer resp.Body.Close()
+		events := newSSEReader(resp.Body)
+		for {
+			event, data, err := events.next()
+			if err != nil {
+				if streamCtx.Err() == nil {
+					sub.deliver(lostMessage(err))
+				}
+				return
+			}
+			switch event {
+			case "next":
+				sub.deliver(nextMessage(json.RawMessage(data)))
+			case "complete":
+				sub.deliver(SubscriptionMessage{End: SubscriptionCompleted})
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// newSSERequest builds a request for an event stream endpoint, whose body
+// is env if not nil.
+func (c *Client) newSSERequest(ctx context.Context, method string, req *Request, env interface{}) (*http.Request, error) {
+	var body io.Reader
+	if env != nil {
+		b, err := json.Marshal(env)
+		if err != nil {
+			return nil, fmt.Errorf("encode body: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	r, err := http.NewRequestWithContext(ctx, method, c.sseEndpoint(), body)
+	if err != nil {
+		return nil, err
+	}
+	if env != nil {
+		r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	r.Header.Set("Accept", "text/event-stream")
+	if err := c.setHeaders(ctx, r, req); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// openEventStream sends r and returns the response if it is an event
+// stream.
+func (c *Client) openEventStream(r *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		drainBody(resp)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		drainBody(resp)
+		return nil, fmt.Errorf("graphql: expected an event stream, got %q", resp.Header.Get("Content-Type"))
+	}
+	return resp, nil
+}
+
+// sseReader reads the events of an event stream.
+type sseReader struct {
+	r *bufio.Reader
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	return &sseReader{r: bufio.NewReader(r)}
+}
+
+// next returns the type and data of the next event.
+func (s *sseReader) next() (event, data string, err error) {
+	var lines []string
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", "", err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			if event == "" && lines == nil {
+				continue
+			}
+			if event == "" {
+				event = "message"
+			}
+			return event, strings.Join(lines, "\n"), nil
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			lines = append(lines, value)
+		}
+	}
+}
+
+// sseConn is the single connection event stream of a client.
+type sseConn struct {
+	client *Client
+	token  string
+	// cancel closes the stream.
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	subs   map[string]*subscription
+	nextID uint64
+	closed bool
+}
+
+// sseConn returns the single connection event stream of the client,
+// opening one if needed.
+func (c *Client) sseConn(ctx context.Context, req *Request) (*sseConn, error) {
+	c.subscriptionMu.Lock()
+	defer c.subscriptionMu.Unlock()
+	if c.sseStream != nil {
+		return c.sseStream, nil
+	}
+	r, err := c.newSSERequest(ctx, http.MethodPut, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Accept", "text/plain")
+	token, status, err := c.doRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer putBuffer(token)
+	if status != http.StatusCreated {
+		return nil, fmt.Errorf("reserve event stream: %w", &StatusError{StatusCode: status})
+	}
+	streamCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	r, err = c.newSSERequest(streamCtx, http.MethodGet, req, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	conn := &sseConn{client: c, token: strings.TrimSpace(token.String()), cancel: cancel, subs: make(map[string]*subscription)}
+	r.Header.Set(sseTokenHeader, conn.token)
+	resp, err := c.openEventStream(r)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	c.sseStream = conn
+	go conn.read(resp.Body)
+	return conn, nil
+}
+
+// subscribe registers a subscription to req and sends the operation.
+func (sc *sseConn) subscribe(ctx context.Context, req *Request) (*subscription, error) {
+	sc.mu.Lock()
+	if sc.closed {
+		sc.mu.Unlock()
+		return nil, errConnectionClosed
+	}
+	sc.nextID++
+	sub := sc.client.newSubscription(strconv.FormatUint(sc.nextID, 10), req)
+	sub.cancel = func() { sc.stop(ctx, sub) }
+	sub.done = func() { sc.remove(sub.id) }
+	sc.subs[sub.id] = sub
+	sc.mu.Unlock()
+	env := sc.client.envelope(req)
+	env.Extensions = make(map[string]interface{}, len(req.extensions)+1)
+	for key, value := range req.extensions {
+		env.Extensions[key] = value
+	}
+	env.Extensions["operationId"] = sub.id
+	r, err := sc.client.newSSERequest(ctx, http.MethodPost, req, env)
+	if err == nil {
+		err = sc.send(r, http.StatusAccepted)
+	}
+	if err != nil {
+		sc.remove(sub.id)
+		return nil, err
+	}
+	return sub, nil
+}
+
+// send sends r with the token of the stream, expecting status.
+func (sc *sseConn) send(r *http.Request, status int) error {
+	r.Header.Set(sseTokenHeader, sc.token)
+	buf, got, err := sc.client.doRequest(r)
+	if err != nil {
+		return err
+	}
+	putBuffer(buf)
+	if got != status && got != http.StatusOK {
+		return &StatusError{StatusCode: got}
+	}
+	return nil
+}
+
+// read dispatches the events of the stream to the subscriptions until it
+// ends.
+func (sc *sseConn) read(body io.ReadCloser) {
+	defer body.Close()
+	events := newSSEReader(body)
+	for {
+		event, data, err := events.next()
+		if err != nil {
+			sc.lost(err)
+			return
+		}
+		var msg struct {
+			ID      string
+			Payload json.RawMessage
+		}
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			continue
+		}
+		sc.mu.Lock()
+		sub := sc.subs[msg.ID]
+		sc.mu.Unlock()
+		if sub == nil {
+			continue
+		}
+		switch event {
+		case "next":
+			sub.deliver(nextMessage(msg.Payload))
+		case "complete":
+			sub.deliver(SubscriptionMessage{End: SubscriptionCompleted})
+		}
+	}
+}
+
+// lost ends the subscriptions of the stream after it failed with err.
+func (sc *sseConn) lost(err error) {
+	sc.mu.Lock()
+	subs := sc.end()
+	sc.mu.Unlock()
+	for _, sub := range subs {
+		sub.deliver(lostMessage(err))
+	}
+}
+
+// end closes the stream for good and returns its subscriptions. The lock
+// of sc must be held.
+func (sc *sseConn) end() map[string]*subscription {
+	if sc.closed {
+		return nil
+	}
+	sc.closed = true
+	sc.cancel()
+	subs := sc.subs
+	sc.subs = nil
+	c := sc.client
+	c.subscriptionMu.Lock()
+	if c.sseStream == sc {
+		c.sseStream = nil
+	}
+	c.subscriptionMu.Unlock()
+	return subs
+}
+
+// stop tells the server to stop sub, and unregisters it.
+func (sc *sseConn) stop(ctx context.Context, sub *subscription) {
+	r, err := sc.client.newSSERequest(context.WithoutCancel(ctx), http.MethodDelete, sub.req, nil)
+	if err == nil {
+		query := r.URL.Query()
+		query.Set("operationId", sub.id)
+		r.URL.RawQuery = query.Encode()
+		if err := sc.send(r, http.StatusOK); err != nil {
+			sc.client.logDebugw(ctx, "stopping subscription failed", "id", sub.id, "error", err)
+		}
+	}
+	sc.remove(sub.id)
+}
+
+// remove unregisters subscription id, closing the stream when it was the
+// last one.
+func (sc *sseConn) remove(id string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.closed {
+		return
+	}
+	delete(sc.subs, id)
+	if len(sc.subs) == 0 {
+		sc.end()
+	}
+}
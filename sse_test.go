@@ -0,0 +1,97 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSSEReader(t *testing.T) {
+	events := newSSEReader(strings.NewReader(": comment\n\nevent: next\r\ndata: {\"a\":\ndata: 1}\r\n\r\ndata: x\n\nevent: complete\n"))
+	for _, want := range [][2]string{{"next", "{\"a\":\n1}"}, {"message", "x"}} {
+		event, data, err := events.next()
+		if err != nil || event != want[0] || data != want[1] {
+			t.Errorf("got %q, %q, %v, want %q, %q", event, data, err, want[0], want[1])
+		}
+	}
+	if _, _, err := events.next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, want io.ErrUnexpectedEOF for a truncated event", err)
+	}
+}
+
+func TestSSEDistinctConnections(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var env struct{ Query string }
+		json.NewDecoder(r.Body).Decode(&env)
+		if r.Method != http.MethodPost || r.Header.Get("Accept") != "text/event-stream" || env.Query != "subscription { tick }" {
+			t.Errorf("got %s %q with Accept %q", r.Method, env.Query, r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "event: next\ndata: {\"data\":{\"tick\":1}}\n\n: keepalive\n\nevent: complete\ndata:\n\n")
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, WithSSESubscriptions(SSEDistinctConnections))
+	messages, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, messages)
+	if len(got) != 2 || got[1].End != SubscriptionCompleted {
+		t.Fatalf("got %+v, want an event and a completion", got)
+	}
+	var data struct{ Tick int }
+	if err := got[0].Decode(&data); err != nil || data.Tick != 1 {
+		t.Errorf("got %+v, %v", data, err)
+	}
+}
+
+func TestSSESingleConnection(t *testing.T) {
+	operations := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut && r.Header.Get(sseTokenHeader) != "token" {
+			t.Errorf("%s without the token of the stream", r.Method)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, "token\n")
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.(http.Flusher).Flush()
+			select {
+			case id := <-operations:
+				fmt.Fprintf(w, "event: next\ndata: {\"id\":%q,\"payload\":{\"data\":{\"tick\":1}}}\n\n", id)
+				fmt.Fprintf(w, "event: complete\ndata: {\"id\":%q}\n\n", id)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+			}
+			<-r.Context().Done()
+		case http.MethodPost:
+			var env struct{ Extensions map[string]string }
+			json.NewDecoder(r.Body).Decode(&env)
+			w.WriteHeader(http.StatusAccepted)
+			operations <- env.Extensions["operationId"]
+		}
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, WithSSESubscriptions(SSESingleConnection))
+	messages, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, messages)
+	if len(got) != 2 || got[1].End != SubscriptionCompleted {
+		t.Fatalf("got %+v, want an event and a completion", got)
+	}
+	var data struct{ Tick int }
+	if err := got[0].Decode(&data); err != nil || data.Tick != 1 {
+		t.Errorf("got %+v, %v", data, err)
+	}
+}
@@ -0,0 +1,263 @@
+package graphql
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats are counters of the requests made by a client, see Client.Stats.
+type Stats struct {
+	// Requests is the number of Run and RunStream calls.
+	Requests uint64
+	// Failures is the number of those calls that returned an error.
+	Failures uint64
+	// Attempts is the number of HTTP requests sent by the default HTTP
+	// client, retries included.
+	Attempts uint64
+	// Retries counts the retries of the default HTTP client by reason:
+	// the status code retried, such as "503", or "error" for transport
+	// errors.
+	Retries map[string]uint64
+	// TooManyRequestsWaits is the number of waits after a 429 response
+	// and TooManyRequestsWait the total time spent waiting.
+	TooManyRequestsWaits uint64
+	TooManyRequestsWait  time.Duration
+	// BytesOut and BytesIn count the request and response bodies of the
+	// attempts.
+	BytesOut uint64
+	BytesIn  uint64
+	// Operations holds the statistics of each operation by name,
+	// anonymous operations under "". Up to 256 operations are tracked by
+	// name, the calls of the operations seen after them being counted
+	// together under OtherOperations.
+	Operations map[string]OperationStats
+	// Subscriptions are the counters of the subscriptions.
+	Subscriptions SubscriptionStats
+}
+
+// SubscriptionStats are counters of the subscriptions of a client.
+type SubscriptionStats struct {
+	// Active is the number of subscriptions in progress.
+	Active int64
+	// Messages is the number of events received for subscriptions.
+	Messages uint64
+	// Reconnects is the number of times a lost subscription connection
+	// was reestablished, see WithSubscriptionReconnect.
+	Reconnects uint64
+	// AverageLatency is the mean time events waited between their
+	// reception and their delivery to the consumer.
+	AverageLatency time.Duration
+}
+
+// operationSamples is the number of recent calls of an operation its
+// rolling statistics are computed over.
+const operationSamples = 512
+
+// maxOperations bounds the number of operations tracked by name, so that
+// clients running generated operation names don't grow without bound.
+const maxOperations = 256
+
+// OtherOperations is the key of Stats.Operations under which the calls of
+// the operations beyond the first 256 names are counted.
+const OtherOperations = "(other)"
+
+// OperationStats are the statistics of the calls of one operation. The
+// latencies and error rate are computed over its most recent calls, up
+// to 512 of them, to reflect its current health.
+type OperationStats struct {
+	// Requests and Failures count all the calls of the operation.
+	Requests uint64
+	Failures uint64
+	// Samples is the number of recent calls the fields below are
+	// computed over.
+	Samples int
+	// ErrorRate is the share of those calls that failed, from 0 to 1.
+	ErrorRate float64
+	// Latency percentiles and maximum of those calls.
+	P50, P90, P99, Max time.Duration
+}
+
+// Stats returns a snapshot of the counters of the client, to see how often
+// requests fail, backoff kicks in and each operation performs, e.g. to
+// report GraphQL health on an admin endpoint.
+func (c *Client) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// clientStats holds the counters behind Stats.
+type clientStats struct {
+	requests             atomic.Uint64
+	failures             atomic.Uint64
+	attempts             atomic.Uint64
+	tooManyRequestsWaits atomic.Uint64
+	tooManyRequestsWait  atomic.Int64
+	bytesOut             atomic.Uint64
+	bytesIn              atomic.Uint64
+
+	subscriptionsActive  atomic.Int64
+	subscriptionMessages atomic.Uint64
+	reconnects           atomic.Uint64
+	// delivered counts the events delivered to consumers, and latency
+	// the time they waited in total.
+	delivered atomic.Uint64
+	latency   atomic.Int64
+
+	mu         sync.Mutex
+	retries    map[string]uint64
+	operations map[string]*operationStats
+}
+
+// done counts a Run or RunStream call of operation that took d, sent and
+// received the bodies counted in info and returned err.
+func (s *clientStats) done(operation string, d time.Duration, info *runInfo, err error) {
+	s.requests.Add(1)
+	s.bytesOut.Add(uint64(info.bytesOut.Load()))
+	s.bytesIn.Add(uint64(info.bytesIn.Load()))
+	if err != nil {
+		s.failures.Add(1)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.operations == nil {
+		s.operations = make(map[string]*operationStats)
+	}
+	op := s.operations[operation]
+	if op == nil {
+		if len(s.operations) >= maxOperations {
+			operation = OtherOperations
+			op = s.operations[operation]
+		}
+		if op == nil {
+			op = &operationStats{}
+			s.operations[operation] = op
+		}
+	}
+	op.add(d, err != nil)
+}
+
+// retry counts a retry of resp or err after waiting for wait.
+func (s *clientStats) retry(resp *http.Response, err error, wait time.Duration) {
+	reason := "error"
+	if err == nil {
+		reason = strconv.Itoa(resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			s.tooManyRequestsWaits.Add(1)
+			s.tooManyRequestsWait.Add(int64(wait))
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.retries == nil {
+		s.retries = make(map[string]uint64)
+	}
+	s.retries[reason]++
+}
+
+func (s *clientStats) snapshot() Stats {
+	s.mu.Lock()
+	retries := make(map[string]uint64, len(s.retries))
+	for reason, n := range s.retries {
+		retries[reason] = n
+	}
+	operations := make(map[string]OperationStats, len(s.operations))
+	for name, op := range s.operations {
+		operations[name] = op.snapshot()
+	}
+	s.mu.Unlock()
+	return Stats{
+		Operations:           operations,
+		Requests:             s.requests.Load(),
+		Failures:             s.failures.Load(),
+		Attempts:             s.attempts.Load(),
+		Retries:              retries,
+		TooManyRequestsWaits: s.tooManyRequestsWaits.Load(),
+		TooManyRequestsWait:  time.Duration(s.tooManyRequestsWait.Load()),
+		BytesOut:             s.bytesOut.Load(),
+		BytesIn:              s.bytesIn.Load(),
+		Subscriptions:        s.subscriptionSnapshot(),
+	}
+}
+
+func (s *clientStats) subscriptionSnapshot() SubscriptionStats {
+	stats := SubscriptionStats{
+		Active:     s.subscriptionsActive.Load(),
+		Messages:   s.subscriptionMessages.Load(),
+		Reconnects: s.reconnects.Load(),
+	}
+	if delivered := s.delivered.Load(); delivered > 0 {
+		stats.AverageLatency = time.Duration(s.latency.Load() / int64(delivered))
+	}
+	return stats
+}
+
+// deliveredEvent counts an event delivered to the consumer of a
+// subscription after waiting for d.
+func (s *clientStats) deliveredEvent(d time.Duration) {
+	s.delivered.Add(1)
+	s.latency.Add(int64(d))
+}
+
+// totalRetries returns the number of retries of all reasons.
+func (s *clientStats) totalRetries() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n uint64
+	for _, retries := range s.retries {
+		n += retries
+	}
+	return n
+}
+
+// operationStats holds the counters of an operation and a ring of its
+// recent calls.
+type operationStats struct {
+	requests, failures uint64
+	latencies          [operationSamples]time.Duration
+	failed             [operationSamples]bool
+	next, n            int
+}
+
+func (o *operationStats) add(d time.Duration, failed bool) {
+	o.requests++
+	if failed {
+		o.failures++
+	}
+	o.latencies[o.next] = d
+	o.failed[o.next] = failed
+	o.next = (o.next + 1) % operationSamples
+	o.n = min(o.n+1, operationSamples)
+}
+
+func (o *operationStats) snapshot() OperationStats {
+	stats := OperationStats{Requests: o.requests, Failures: o.failures, Samples: o.n}
+	if o.n == 0 {
+		return stats
+	}
+	latencies := make([]time.Duration, o.n)
+	copy(latencies, o.latencies[:o.n])
+	slices.Sort(latencies)
+	failures := 0
+	for _, failed := range o.failed[:o.n] {
+		if failed {
+			failures++
+		}
+	}
+	stats.ErrorRate = float64(failures) / float64(o.n)
+	stats.P50 = percentile(latencies, 0.50)
+	stats.P90 = percentile(latencies, 0.90)
+	stats.P99 = percentile(latencies, 0.99)
+	stats.Max = latencies[o.n-1]
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted, by the nearest-rank
+// method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
@@ -0,0 +1,106 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStatsOperations(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	for _, q := range []string{"query A { a }", "query A { a }", "{ b }"} {
+		if err := client.Run(context.Background(), NewRequest(q), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := client.Stats()
+	if stats.Requests != 3 || stats.Operations["A"].Requests != 2 || stats.Operations[""].Requests != 1 {
+		t.Errorf("got %d requests, by operation %+v", stats.Requests, stats.Operations)
+	}
+}
+
+func TestStatsOperationsBounded(t *testing.T) {
+	s := &clientStats{}
+	for i := 0; i < maxOperations+10; i++ {
+		s.done(fmt.Sprintf("op%d", i), time.Millisecond, &runInfo{}, nil)
+	}
+	s.done("op0", time.Millisecond, &runInfo{}, nil)
+	s.done("op300", time.Millisecond, &runInfo{}, errors.New("boom"))
+	operations := s.snapshot().Operations
+	if len(operations) != maxOperations+1 {
+		t.Fatalf("got %d operations, want %d and the others", len(operations), maxOperations)
+	}
+	if other := operations[OtherOperations]; other.Requests != 11 || other.Failures != 1 {
+		t.Errorf("got %+v, want the 11 calls beyond the bound", other)
+	}
+	if operations["op0"].Requests != 2 {
+		t.Errorf("got %+v, want a tracked operation still counted by name", operations["op0"])
+	}
+}
+
+func TestStatsRetries(t *testing.T) {
+	srv, _ := sequenceServer(429, 503, 200, 400)
+	defer srv.Close()
+	client := NewClient(srv.URL, WithClock(&recordingClock{}))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err == nil {
+		t.Fatal("expected the 400 to fail")
+	}
+	stats := client.Stats()
+	if stats.Requests != 2 || stats.Failures != 1 || stats.Attempts != 4 {
+		t.Errorf("got %d requests, %d failures and %d attempts", stats.Requests, stats.Failures, stats.Attempts)
+	}
+	if len(stats.Retries) != 2 || stats.Retries["429"] != 1 || stats.Retries["503"] != 1 {
+		t.Errorf("got retries %v", stats.Retries)
+	}
+	if stats.TooManyRequestsWaits != 1 || stats.TooManyRequestsWait != time.Minute {
+		t.Errorf("got %d waits of %s after 429", stats.TooManyRequestsWaits, stats.TooManyRequestsWait)
+	}
+}
+
+func TestStatsSubscriptions(t *testing.T) {
+	var connections atomic.Int32
+	release := make(chan struct{})
+	srv := newWSServer(t, []string{ProtocolGraphQLTransportWS}, func(p *wsPeer, protocol string) {
+		n := connections.Add(1)
+		readWSMessage(t, p)
+		writeWSMessage(t, p, `{"type":"connection_ack"}`)
+		sub := readWSMessage(t, p)
+		if n == 1 {
+			return
+		}
+		writeWSMessage(t, p, `{"id":"`+sub.ID+`","type":"next","payload":{"data":{"tick":1}}}`)
+		writeWSMessage(t, p, `{"id":"`+sub.ID+`","type":"next","payload":{"data":{"tick":2}}}`)
+		<-release
+		writeWSMessage(t, p, `{"id":"`+sub.ID+`","type":"complete"}`)
+		p.readFrame()
+	})
+	defer srv.Close()
+	client := NewClient(srv.URL, WithClock(&recordingClock{}), WithSubscriptionReconnect(DefaultSubscriptionReconnect))
+	messages, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-messages
+	<-messages
+	if stats := client.Stats().Subscriptions; stats.Active != 1 || stats.Messages != 2 || stats.Reconnects != 1 {
+		t.Errorf("got %+v, want an active subscription with 2 events after a reconnect", stats)
+	}
+	close(release)
+	collect(t, messages)
+	if stats := client.Stats().Subscriptions; stats.Active != 0 || stats.Messages != 2 || stats.AverageLatency <= 0 {
+		t.Errorf("got %+v, want the subscription ended, and the latency of its events", stats)
+	}
+}
@@ -0,0 +1,876 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WebSocket subprotocols of subscriptions.
+const (
+	// ProtocolGraphQLTransportWS is the graphql-transport-ws protocol of
+	// the graphql-ws library.
+	ProtocolGraphQLTransportWS = "graphql-transport-ws"
+	// ProtocolGraphQLWS is the legacy protocol of the
+	// subscriptions-transport-ws library, still spoken by many servers.
+	ProtocolGraphQLWS = "graphql-ws"
+)
+
+// defaultSubscriptionProtocols are the protocols offered by default, in
+// order of preference.
+var defaultSubscriptionProtocols = []string{ProtocolGraphQLTransportWS, ProtocolGraphQLWS}
+
+// connectionAckTimeout is how long the server has to acknowledge a new
+// subscription connection.
+const connectionAckTimeout = 10 * time.Second
+
+// subscriptionBuffer is the default number of events of a subscription
+// held while its consumer is busy.
+const subscriptionBuffer = 16
+
+// Backpressure is what a subscription does with an event arriving while
+// its buffer is full, see WithSubscriptionBuffer.
+type Backpressure int
+
+const (
+	// BackpressureBlock waits for the consumer: reading from the
+	// connection stops, holding back the subscriptions sharing it.
+	BackpressureBlock Backpressure = iota
+	// BackpressureDropOldest discards the oldest buffered event to make
+	// room.
+	BackpressureDropOldest
+	// BackpressureFail stops the subscription, which ends with
+	// ErrSlowConsumer after the buffered events.
+	BackpressureFail
+)
+
+// ErrSlowConsumer ends a subscription with BackpressureFail whose
+// consumer didn't keep up with its events.
+var ErrSlowConsumer = errors.New("graphql: subscription consumer too slow")
+
+// WithSubscriptionBuffer sets the number of events each subscription
+// holds while its consumer is busy, at least one, and what happens to
+// the events arriving when they are all taken. By default 16 events are
+// held with BackpressureBlock.
+func WithSubscriptionBuffer(size int, strategy Backpressure) ClientOption {
+	return func(client *Client) {
+		client.subscriptionBuffer = max(size, 1)
+		client.backpressure = strategy
+	}
+}
+
+// SubscriptionReconnect configures how subscriptions survive the loss of
+// their connection, see WithSubscriptionReconnect.
+type SubscriptionReconnect struct {
+	// Backoff is the randomized wait before each attempt to reconnect.
+	Backoff Backoff
+	// MaxAttempts bounds the attempts to reconnect after a loss, zero for
+	// no limit.
+	MaxAttempts int
+	// Resume, if set, is called with the request of each active
+	// subscription before it is sent again on the new connection, e.g. to
+	// set a variable to the cursor of the last event received so the
+	// server resumes after it. It may run while events are consumed.
+	Resume func(req *Request)
+}
+
+// DefaultSubscriptionReconnect reconnects with DefaultBackoff, without
+// limit.
+var DefaultSubscriptionReconnect = SubscriptionReconnect{Backoff: DefaultBackoff}
+
+// WithSubscriptionReconnect makes subscriptions survive the loss of their
+// connection: the client reconnects, initializes the new connection and
+// subscribes to the active subscriptions again. They end with
+// ErrConnectionLost once config.MaxAttempts attempts failed in a row, or
+// when the server closes the connection as it rejects the requests of the
+// client.
+func WithSubscriptionReconnect(config SubscriptionReconnect) ClientOption {
+	return func(client *Client) {
+		client.subscriptionReconnect = &config
+	}
+}
+
+// SubscriptionKeepalive configures the pings that keep subscription
+// connections alive and detect dead ones, see WithSubscriptionKeepalive.
+type SubscriptionKeepalive struct {
+	// Interval is the time between pings.
+	Interval time.Duration
+	// Timeout is how long the server has to answer a ping, or send
+	// anything else, before the connection is deemed dead. Zero waits for
+	// Interval.
+	Timeout time.Duration
+}
+
+// WithSubscriptionKeepalive pings the server over WebSocket connections
+// every config.Interval, so that load balancers don't close them for
+// being idle. A connection the server doesn't answer within
+// config.Timeout is closed and lost, then reestablished with
+// WithSubscriptionReconnect.
+func WithSubscriptionKeepalive(config SubscriptionKeepalive) ClientOption {
+	return func(client *Client) {
+		client.subscriptionKeepalive = &config
+	}
+}
+
+// errKeepaliveTimeout is the cause of the loss of a connection that
+// didn't answer a ping.
+var errKeepaliveTimeout = errors.New("graphql: no answer to keepalive ping")
+
+// ErrConnectionLost is returned through a subscription whose connection
+// was lost.
+var ErrConnectionLost = errors.New("graphql: subscription connection lost")
+
+// WithSubscriptionEndpoint sets the endpoint of subscriptions: a ws or
+// wss URL, or the URL of the event streams with WithSSESubscriptions. By
+// default subscriptions use the endpoint of the client.
+func WithSubscriptionEndpoint(endpoint string) ClientOption {
+	return func(client *Client) {
+		client.subscriptionEndpoint = endpoint
+	}
+}
+
+// WithSubscriptionProtocol sets the subscription protocols offered to the
+// server, in order of preference. By default both ProtocolGraphQLTransportWS
+// and ProtocolGraphQLWS are offered and the server picks one; a server
+// that doesn't pick is assumed to speak the first.
+func WithSubscriptionProtocol(protocols ...string) ClientOption {
+	return func(client *Client) {
+		client.subscriptionProtocols = protocols
+	}
+}
+
+// WithConnectionInitPayload sets the payload of the connection_init
+// message a WebSocket connection starts with, commonly carrying the token
+// of servers that authenticate subscriptions there. payload is called for
+// every connection, reconnections included, so it can return a freshly
+// fetched token; its error fails the connection. A nil payload is left
+// out of the message.
+func WithConnectionInitPayload(payload func(ctx context.Context) (interface{}, error)) ClientOption {
+	return func(client *Client) {
+		client.connectionInit = payload
+	}
+}
+
+// SubscriptionEnd tells how a subscription ended.
+type SubscriptionEnd int
+
+const (
+	// SubscriptionCompleted is the end of a subscription the server
+	// completed.
+	SubscriptionCompleted SubscriptionEnd = iota + 1
+	// SubscriptionFailed is the end of a subscription the server reported
+	// an error for, or which the client gave up, as with ErrSlowConsumer.
+	SubscriptionFailed
+	// SubscriptionCanceled is the end of a subscription whose context
+	// was done.
+	SubscriptionCanceled
+	// SubscriptionConnectionLost is the end of a subscription whose
+	// connection was lost, with ErrConnectionLost.
+	SubscriptionConnectionLost
+)
+
+// SubscriptionMessage is an event of a subscription.
+type SubscriptionMessage struct {
+	// Data is the data field of the event.
+	Data json.RawMessage
+	// Err is the first GraphQL error of the event, or the error that
+	// ended the subscription, as the last message.
+	Err error
+	// End is set on the last message of the subscription, which carries
+	// no data, to tell how it ended. Its Err is nil only when the server
+	// completed it.
+	End SubscriptionEnd
+
+	// received is when the event was received, for Stats.
+	received time.Time
+}
+
+// Decode unmarshals the data of the message into v.
+func (m SubscriptionMessage) Decode(v interface{}) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	return json.Unmarshal(m.Data, v)
+}
+
+// Subscribe starts the subscription req over a WebSocket, or an event
+// stream with WithSSESubscriptions, and returns the channel its events are
+// delivered on. The channel is closed when the subscription ends, after a
+// last message whose End tells whether the server completed it, the
+// server or the client failed it, ctx was done or the connection was
+// lost. Except with
+// SSEDistinctConnections, the subscriptions of a client share a
+// connection, opened when needed and closed when the last one ends; the
+// headers of the first request are sent with its handshake. See
+// WithSubscriptionProtocol for the WebSocket protocols spoken.
+func (c *Client) Subscribe(ctx context.Context, req *Request) (<-chan SubscriptionMessage, error) {
+	if err := c.checkPersisted(req); err != nil {
+		return nil, err
+	}
+	if err := c.beforeSubscribe(ctx, req); err != nil {
+		return nil, err
+	}
+	sub, err := c.subscribe(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	// The room for a message lets the end of a canceled subscription be
+	// delivered even when its consumer stopped reading.
+	out := make(chan SubscriptionMessage, 1)
+	c.stats.subscriptionsActive.Add(1)
+	go sub.pump(ctx, out)
+	return out, nil
+}
+
+// subscribe starts the subscription req with the transport of the client.
+func (c *Client) subscribe(ctx context.Context, req *Request) (*subscription, error) {
+	if c.sseMode != 0 {
+		return c.subscribeSSE(ctx, req)
+	}
+	for {
+		conn, err := c.subscriptionConn(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		c.logDebugRequest(ctx, req)
+		sub, err := conn.subscribe(req)
+		if errors.Is(err, errConnectionClosed) {
+			// The connection closed in between, open another one.
+			continue
+		}
+		return sub, err
+	}
+}
+
+// errConnectionClosed is returned when subscribing through a closed
+// connection.
+var errConnectionClosed = errors.New("graphql: subscription connection closed")
+
+// wsMessage is a message of a subscription protocol.
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// subscriptionConn is the connection carrying the subscriptions of a
+// client. With WithSubscriptionReconnect, its WebSocket is replaced when
+// it is lost.
+type subscriptionConn struct {
+	client *Client
+	// header is sent with the handshakes of the connection.
+	header http.Header
+	// ctx is done once the connection is closed for good.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu sync.Mutex
+	// ws is the current WebSocket, nil while reconnecting.
+	ws *wsConn
+	// protocol is the subscription protocol spoken over ws.
+	protocol string
+	subs     map[string]*subscription
+	nextID   uint64
+	closed   bool
+}
+
+// subscription is an active subscription of a connection.
+type subscription struct {
+	id  string
+	req *Request
+	// events are the events received for the subscription, read by pump.
+	events chan SubscriptionMessage
+	// stopped is closed once pump returned.
+	stopped chan struct{}
+	// cancel tells the server to stop the subscription, which the client
+	// gave up, and unregisters it; done unregisters it once it ended.
+	cancel, done func()
+	// buffer is the number of events held, with backpressure applied
+	// beyond; failed is set once the subscription failed for it.
+	buffer       int
+	backpressure Backpressure
+	failed       atomic.Bool
+	hooks        []SubscriptionHooks
+	stats        *clientStats
+}
+
+// newSubscription returns a subscription to req with the given id.
+func (c *Client) newSubscription(id string, req *Request) *subscription {
+	buffer := c.subscriptionBuffer
+	if buffer == 0 {
+		buffer = subscriptionBuffer
+	}
+	sub := &subscription{
+		id:           id,
+		req:          req,
+		stopped:      make(chan struct{}),
+		buffer:       buffer,
+		backpressure: c.backpressure,
+		hooks:        c.subscriptionHooks,
+		stats:        c.stats,
+	}
+	if sub.backpressure == BackpressureFail {
+		// Keep room for the final error.
+		buffer++
+	}
+	sub.events = make(chan SubscriptionMessage, buffer)
+	return sub
+}
+
+// deliver passes msg to sub, applying its backpressure while its
+// buffer is full.
+func (sub *subscription) deliver(msg SubscriptionMessage) {
+	if msg.End == 0 {
+		sub.stats.subscriptionMessages.Add(1)
+		msg.received = time.Now()
+	}
+	switch sub.backpressure {
+	case BackpressureDropOldest:
+		for {
+			select {
+			case sub.events <- msg:
+				return
+			case <-sub.stopped:
+				return
+			default:
+			}
+			select {
+			case <-sub.events:
+			default:
+			}
+		}
+	case BackpressureFail:
+		if sub.failed.Load() {
+			return
+		}
+		if len(sub.events) >= sub.buffer && msg.End == 0 {
+			sub.failed.Store(true)
+			sub.cancel()
+			msg = SubscriptionMessage{Err: ErrSlowConsumer, End: SubscriptionFailed}
+		}
+	}
+	select {
+	case sub.events <- msg:
+	case <-sub.stopped:
+	}
+}
+
+// subscriptionConn returns the subscription connection of the client,
+// opening one if needed.
+func (c *Client) subscriptionConn(ctx context.Context, req *Request) (*subscriptionConn, error) {
+	c.subscriptionMu.Lock()
+	defer c.subscriptionMu.Unlock()
+	if c.subscriptions != nil {
+		return c.subscriptions, nil
+	}
+	header := req.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	if c.userAgent != "" && header.Get("User-Agent") == "" {
+		header.Set("User-Agent", c.userAgent)
+	}
+	ws, protocol, err := c.openSubscriptions(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+	conn := &subscriptionConn{client: c, header: header, ws: ws, protocol: protocol, subs: make(map[string]*subscription)}
+	conn.ctx, conn.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	c.subscriptions = conn
+	go conn.read(ws)
+	return conn, nil
+}
+
+// openSubscriptions opens a WebSocket for subscriptions and initializes
+// it. It returns the protocol spoken over it.
+func (c *Client) openSubscriptions(ctx context.Context, header http.Header) (*wsConn, string, error) {
+	endpoint := c.subscriptionEndpoint
+	if endpoint == "" {
+		endpoint = c.endpoint
+	}
+	protocols := c.subscriptionProtocols
+	if len(protocols) == 0 {
+		protocols = defaultSubscriptionProtocols
+	}
+	initPayload, err := c.connectionInitPayload(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	c.logDebugw(ctx, ">> subscription connection", "endpoint", endpoint)
+	ws, err := dialWebSocket(ctx, c.webSocketTransport, unixEndpoint(endpoint), header, protocols, c.subscriptionCompression)
+	if err != nil {
+		return nil, "", err
+	}
+	protocol := ws.protocol
+	if protocol == "" {
+		protocol = protocols[0]
+	}
+	if err := initSubscriptions(ctx, ws, protocol, initPayload); err != nil {
+		ws.close(wsCloseNormal, "")
+		return nil, "", err
+	}
+	return ws, protocol, nil
+}
+
+// connectionInitPayload returns the encoded payload of connection_init,
+// nil for none.
+func (c *Client) connectionInitPayload(ctx context.Context) (json.RawMessage, error) {
+	if c.connectionInit == nil {
+		return nil, nil
+	}
+	payload, err := c.connectionInit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connection_init payload: %w", err)
+	}
+	if payload == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encode connection_init payload: %w", err)
+	}
+	return b, nil
+}
+
+// initSubscriptions sends connection_init with payload over ws and waits
+// for the server to acknowledge it.
+func initSubscriptions(ctx context.Context, ws *wsConn, protocol string, payload json.RawMessage) error {
+	if err := sendMessage(ws, wsMessage{Type: "connection_init", Payload: payload}); err != nil {
+		return err
+	}
+	timer := time.AfterFunc(connectionAckTimeout, func() { ws.conn.Close() })
+	defer timer.Stop()
+	stop := context.AfterFunc(ctx, func() { ws.conn.Close() })
+	defer stop()
+	for {
+		msg, err := receiveMessage(ws, protocol)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("graphql: waiting for connection_ack: %w", err)
+		}
+		switch msg.Type {
+		case "connection_ack":
+			return nil
+		case "connection_error":
+			return fmt.Errorf("graphql: connection rejected: %w", payloadError(msg.Payload))
+		case "ping":
+			if err := sendMessage(ws, wsMessage{Type: "pong"}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendMessage writes msg to ws.
+func sendMessage(ws *wsConn, msg wsMessage) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return ws.writeText(b)
+}
+
+// receiveMessage reads the next message of ws. Messages of the legacy
+// protocol are given the type of their graphql-transport-ws counterpart.
+func receiveMessage(ws *wsConn, protocol string) (wsMessage, error) {
+	var msg wsMessage
+	b, err := ws.readMessage()
+	if err != nil {
+		return msg, err
+	}
+	if err := json.Unmarshal(b, &msg); err != nil {
+		return msg, fmt.Errorf("graphql: decoding subscription message: %w", err)
+	}
+	if protocol == ProtocolGraphQLWS && msg.Type == "data" {
+		msg.Type = "next"
+	}
+	return msg, nil
+}
+
+// messageType returns the type of a message sent by the client in
+// protocol, given its graphql-transport-ws type.
+func messageType(protocol, typ string) string {
+	if protocol != ProtocolGraphQLWS {
+		return typ
+	}
+	switch typ {
+	case "subscribe":
+		return "start"
+	case "complete":
+		return "stop"
+	}
+	return typ
+}
+
+// payloadError returns the first error of an error payload: a list of
+// GraphQL errors, or a single one with the legacy protocol.
+func payloadError(payload json.RawMessage) error {
+	var errs []graphErr
+	if err := json.Unmarshal(payload, &errs); err != nil {
+		var single graphErr
+		if err := json.Unmarshal(payload, &single); err != nil || single.Message == "" {
+			return errors.New("graphql: subscription failed")
+		}
+		return single
+	}
+	if len(errs) == 0 {
+		return errors.New("graphql: subscription failed")
+	}
+	return errs[0]
+}
+
+// subscribe registers a subscription to req and sends it, unless the
+// connection is being reestablished, which sends it once done.
+func (sc *subscriptionConn) subscribe(req *Request) (*subscription, error) {
+	payload, err := json.Marshal(sc.client.envelope(req))
+	if err != nil {
+		return nil, fmt.Errorf("encode subscription: %w", err)
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.closed {
+		return nil, errConnectionClosed
+	}
+	sc.nextID++
+	sub := sc.client.newSubscription(strconv.FormatUint(sc.nextID, 10), req)
+	sub.cancel = func() { sc.stop(sub.id) }
+	sub.done = func() { sc.remove(sub.id) }
+	if sc.ws != nil {
+		if err := sendMessage(sc.ws, wsMessage{ID: sub.id, Type: messageType(sc.protocol, "subscribe"), Payload: payload}); err != nil {
+			return nil, err
+		}
+	}
+	sc.subs[sub.id] = sub
+	return sub, nil
+}
+
+// read dispatches the messages of ws to the subscriptions until it fails.
+func (sc *subscriptionConn) read(ws *wsConn) {
+	sc.mu.Lock()
+	protocol := sc.protocol
+	sc.mu.Unlock()
+	if config := sc.client.subscriptionKeepalive; config != nil && config.Interval > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go sc.keepalive(ws, *config, done)
+	}
+	for {
+		msg, err := receiveMessage(ws, protocol)
+		if err != nil {
+			if ws.timedOut.Load() {
+				err = errKeepaliveTimeout
+			}
+			sc.lost(ws, err)
+			return
+		}
+		// The server isn't heard while its messages wait for consumers.
+		ws.busy.Store(true)
+		switch msg.Type {
+		case "next":
+			sc.dispatch(msg.ID, nextMessage(msg.Payload))
+		case "error":
+			sc.dispatch(msg.ID, SubscriptionMessage{Err: payloadError(msg.Payload), End: SubscriptionFailed})
+		case "complete":
+			sc.dispatch(msg.ID, SubscriptionMessage{End: SubscriptionCompleted})
+		case "ping":
+			sendMessage(ws, wsMessage{Type: "pong"})
+		}
+		ws.busy.Store(false)
+	}
+}
+
+// keepalive pings the server over ws until done is closed, and closes ws
+// when a ping isn't answered in time.
+func (sc *subscriptionConn) keepalive(ws *wsConn, config SubscriptionKeepalive, done <-chan struct{}) {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = config.Interval
+	}
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		sent := time.Now().UnixNano()
+		if err := ws.writeFrame(wsOpPing, nil); err != nil {
+			return
+		}
+		timer := time.NewTimer(timeout)
+		select {
+		case <-done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if ws.lastRead.Load() < sent && !ws.busy.Load() {
+			sc.client.logWarnw(sc.ctx, "subscription connection: no answer to ping, closing it", "timeout", timeout)
+			ws.timedOut.Store(true)
+			ws.conn.Close()
+			return
+		}
+	}
+}
+
+// nextMessage decodes the payload of a next message, a GraphQL response.
+func nextMessage(payload json.RawMessage) SubscriptionMessage {
+	var resp struct {
+		Data   json.RawMessage
+		Errors []graphErr
+	}
+	if err := json.Unmarshal(payload, &resp); err != nil {
+		return SubscriptionMessage{Err: fmt.Errorf("decoding response: %w", err)}
+	}
+	msg := SubscriptionMessage{Data: resp.Data}
+	if len(resp.Errors) > 0 {
+		msg.Err = resp.Errors[0]
+	}
+	return msg
+}
+
+// dispatch passes msg to subscription id.
+func (sc *subscriptionConn) dispatch(id string, msg SubscriptionMessage) {
+	sc.mu.Lock()
+	sub := sc.subs[id]
+	sc.mu.Unlock()
+	if sub != nil {
+		sub.deliver(msg)
+	}
+}
+
+// lost handles the failure of ws with err: it is reestablished with
+// WithSubscriptionReconnect, otherwise its subscriptions end.
+func (sc *subscriptionConn) lost(ws *wsConn, err error) {
+	sc.mu.Lock()
+	if sc.closed || sc.ws != ws {
+		sc.mu.Unlock()
+		return
+	}
+	ws.conn.Close()
+	if sc.client.subscriptionReconnect != nil && len(sc.subs) > 0 && !fatalClose(err) {
+		sc.ws = nil
+		sc.mu.Unlock()
+		sc.client.logWarnw(sc.ctx, "subscription connection lost, reconnecting", "error", err)
+		go sc.reconnect(err)
+		return
+	}
+	subs := sc.end()
+	sc.mu.Unlock()
+	sc.fail(subs, err)
+}
+
+// fatalClose reports whether err closed a connection because the server
+// rejects the requests of the client, which reconnecting won't fix.
+func fatalClose(err error) bool {
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) {
+		return false
+	}
+	switch closeErr.Code {
+	case wsCloseProtocolError, 4400, 4406, 4409:
+		return true
+	}
+	return false
+}
+
+// reconnect reestablishes the connection after it was lost with cause,
+// and subscribes to the active subscriptions again.
+func (sc *subscriptionConn) reconnect(cause error) {
+	config := sc.client.subscriptionReconnect
+	clock := sc.client.clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	for attempt := 0; config.MaxAttempts == 0 || attempt < config.MaxAttempts; attempt++ {
+		if err := clock.Sleep(sc.ctx, config.Backoff.Delay(attempt)); err != nil {
+			return
+		}
+		ws, protocol, err := sc.client.openSubscriptions(sc.ctx, sc.header)
+		if err != nil {
+			if sc.ctx.Err() != nil {
+				return
+			}
+			sc.client.logDebugw(sc.ctx, "subscription reconnect failed", "attempt", attempt+1, "error", err)
+			cause = err
+			if fatalClose(err) {
+				break
+			}
+			continue
+		}
+		if sc.resubscribe(ws, protocol) {
+			sc.client.stats.reconnects.Add(1)
+			sc.client.loggerFor(sc.ctx).Info("subscription connection reestablished")
+			go sc.read(ws)
+		}
+		return
+	}
+	sc.mu.Lock()
+	subs := sc.end()
+	sc.mu.Unlock()
+	if subs != nil {
+		sc.fail(subs, cause)
+	}
+}
+
+// resubscribe makes ws the WebSocket of the connection and sends the
+// active subscriptions over it, reporting false if the connection was
+// closed in the meantime.
+func (sc *subscriptionConn) resubscribe(ws *wsConn, protocol string) bool {
+	sc.mu.Lock()
+	subs := make([]*subscription, 0, len(sc.subs))
+	for _, sub := range sc.subs {
+		subs = append(subs, sub)
+	}
+	sc.mu.Unlock()
+	payloads := make(map[string]json.RawMessage, len(subs))
+	for _, sub := range subs {
+		if resume := sc.client.subscriptionReconnect.Resume; resume != nil {
+			resume(sub.req)
+		}
+		payload, err := json.Marshal(sc.client.envelope(sub.req))
+		if err != nil {
+			sc.dispatch(sub.id, SubscriptionMessage{Err: fmt.Errorf("encode subscription: %w", err), End: SubscriptionFailed})
+			continue
+		}
+		payloads[sub.id] = payload
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.closed {
+		ws.close(wsCloseNormal, "")
+		return false
+	}
+	sc.ws, sc.protocol = ws, protocol
+	for id, sub := range sc.subs {
+		payload, ok := payloads[id]
+		if !ok {
+			// Subscribed while reconnecting.
+			var err error
+			if payload, err = json.Marshal(sc.client.envelope(sub.req)); err != nil {
+				continue
+			}
+		}
+		sendMessage(ws, wsMessage{ID: id, Type: messageType(protocol, "subscribe"), Payload: payload})
+	}
+	return true
+}
+
+// end closes the connection for good and returns its subscriptions. The
+// lock of sc must be held.
+func (sc *subscriptionConn) end() map[string]*subscription {
+	if sc.closed {
+		return nil
+	}
+	sc.closed = true
+	sc.cancel()
+	subs := sc.subs
+	sc.subs = nil
+	c := sc.client
+	c.subscriptionMu.Lock()
+	if c.subscriptions == sc {
+		c.subscriptions = nil
+	}
+	c.subscriptionMu.Unlock()
+	return subs
+}
+
+// fail ends subs after their connection was lost with err.
+func (sc *subscriptionConn) fail(subs map[string]*subscription, err error) {
+	for _, sub := range subs {
+		sub.deliver(lostMessage(err))
+	}
+}
+
+// remove unregisters subscription id, closing the connection when it was
+// the last one.
+func (sc *subscriptionConn) remove(id string) {
+	sc.mu.Lock()
+	if sc.closed {
+		sc.mu.Unlock()
+		return
+	}
+	delete(sc.subs, id)
+	if len(sc.subs) > 0 {
+		sc.mu.Unlock()
+		return
+	}
+	ws, protocol := sc.ws, sc.protocol
+	sc.end()
+	sc.mu.Unlock()
+	if ws != nil {
+		if protocol == ProtocolGraphQLWS {
+			sendMessage(ws, wsMessage{Type: "connection_terminate"})
+		}
+		ws.close(wsCloseNormal, "")
+	}
+}
+
+// lostMessage returns the last message of a subscription whose
+// connection was lost with err.
+func lostMessage(err error) SubscriptionMessage {
+	return SubscriptionMessage{Err: fmt.Errorf("%w: %w", ErrConnectionLost, err), End: SubscriptionConnectionLost}
+}
+
+// pump delivers the events of sub to out until the subscription ends,
+// then closes out. When ctx is done first, the subscription is canceled.
+func (sub *subscription) pump(ctx context.Context, out chan SubscriptionMessage) {
+	defer close(out)
+	defer close(sub.stopped)
+	defer sub.stats.subscriptionsActive.Add(-1)
+	for {
+		select {
+		case msg := <-sub.events:
+			msg = sub.intercept(msg)
+			select {
+			case out <- msg:
+				if !msg.received.IsZero() {
+					sub.stats.deliveredEvent(time.Since(msg.received))
+				}
+			case <-ctx.Done():
+				sub.canceled(ctx, out)
+				return
+			}
+			if msg.End != 0 {
+				sub.done()
+				return
+			}
+		case <-ctx.Done():
+			sub.canceled(ctx, out)
+			return
+		}
+	}
+}
+
+// canceled cancels sub after ctx was done, and ends out with a message
+// saying so in place of any message not received yet, which the consumer
+// gave up on.
+func (sub *subscription) canceled(ctx context.Context, out chan SubscriptionMessage) {
+	sub.cancel()
+	select {
+	case <-out:
+	default:
+	}
+	out <- sub.intercept(SubscriptionMessage{Err: ctx.Err(), End: SubscriptionCanceled})
+}
+
+// stop tells the server to complete subscription id and unregisters it.
+func (sc *subscriptionConn) stop(id string) {
+	sc.mu.Lock()
+	_, active := sc.subs[id]
+	ws, protocol := sc.ws, sc.protocol
+	sc.mu.Unlock()
+	if active && ws != nil {
+		sendMessage(ws, wsMessage{ID: id, Type: messageType(protocol, "complete")})
+	}
+	sc.remove(id)
+}
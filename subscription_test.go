@@ -0,0 +1,433 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// readWSMessage reads the next message of the client.
+func readWSMessage(t *testing.T, p *wsPeer) wsMessage {
+	t.Helper()
+	text, err := p.readText()
+	if err != nil {
+		t.Errorf("reading client message: %v", err)
+		return wsMessage{}
+	}
+	var msg wsMessage
+	if err := json.Unmarshal([]byte(text), &msg); err != nil {
+		t.Errorf("decoding client message %s: %v", text, err)
+	}
+	return msg
+}
+
+// writeWSMessage sends msg to the client.
+func writeWSMessage(t *testing.T, p *wsPeer, msg string) {
+	t.Helper()
+	if err := p.writeFrame(true, wsOpText, []byte(msg)); err != nil {
+		t.Errorf("writing %s: %v", msg, err)
+	}
+}
+
+// collect reads the messages of a subscription until its channel closes.
+func collect(t *testing.T, messages <-chan SubscriptionMessage) []SubscriptionMessage {
+	t.Helper()
+	var got []SubscriptionMessage
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return got
+			}
+			got = append(got, msg)
+		case <-timeout:
+			t.Fatalf("subscription not ended, got %+v", got)
+		}
+	}
+}
+
+func TestSubscribeTransportWS(t *testing.T) {
+	done := make(chan struct{})
+	srv := newWSServer(t, []string{ProtocolGraphQLTransportWS}, func(p *wsPeer, protocol string) {
+		defer close(done)
+		init := readWSMessage(t, p)
+		if init.Type != "connection_init" || string(init.Payload) != `{"token":"secret"}` {
+			t.Errorf("got %+v, want connection_init with the payload", init)
+		}
+		writeWSMessage(t, p, `{"type":"connection_ack"}`)
+		sub := readWSMessage(t, p)
+		var payload struct{ Query string }
+		json.Unmarshal(sub.Payload, &payload)
+		if sub.Type != "subscribe" || sub.ID == "" || payload.Query != "subscription { tick }" {
+			t.Errorf("got %+v, want a subscribe message with the query", sub)
+		}
+		writeWSMessage(t, p, `{"type":"ping"}`)
+		if pong := readWSMessage(t, p); pong.Type != "pong" {
+			t.Errorf("got %+v, want a pong", pong)
+		}
+		writeWSMessage(t, p, `{"id":"`+sub.ID+`","type":"next","payload":{"data":{"tick":1}}}`)
+		writeWSMessage(t, p, `{"id":"`+sub.ID+`","type":"next","payload":{"data":{"tick":2}}}`)
+		writeWSMessage(t, p, `{"id":"`+sub.ID+`","type":"complete"}`)
+		p.readFrame()
+	})
+	defer srv.Close()
+	client := NewClient(srv.URL, WithConnectionInitPayload(func(ctx context.Context) (interface{}, error) {
+		return map[string]string{"token": "secret"}, nil
+	}))
+	messages, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, messages)
+	if len(got) != 3 {
+		t.Fatalf("got %d messages, want 3: %+v", len(got), got)
+	}
+	for i, msg := range got[:2] {
+		var data struct{ Tick int }
+		if err := msg.Decode(&data); err != nil || data.Tick != i+1 {
+			t.Errorf("message %d: got %+v, %v", i, data, err)
+		}
+	}
+	if last := got[2]; last.End != SubscriptionCompleted || last.Err != nil {
+		t.Errorf("got last message %+v, want a completion", last)
+	}
+	<-done
+}
+
+func TestSubscribeError(t *testing.T) {
+	srv := newWSServer(t, []string{ProtocolGraphQLTransportWS}, func(p *wsPeer, protocol string) {
+		readWSMessage(t, p)
+		writeWSMessage(t, p, `{"type":"connection_ack"}`)
+		sub := readWSMessage(t, p)
+		writeWSMessage(t, p, `{"id":"`+sub.ID+`","type":"error","payload":[{"message":"boom"}]}`)
+		p.readFrame()
+	})
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	messages, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, messages)
+	if len(got) != 1 || got[0].End != SubscriptionFailed || got[0].Err == nil || got[0].Err.Error() != "graphql: boom" {
+		t.Fatalf("got %+v, want a failure with the server's error", got)
+	}
+}
+
+func TestSubscribeCancelSendsComplete(t *testing.T) {
+	completed := make(chan wsMessage, 1)
+	srv := newWSServer(t, []string{ProtocolGraphQLTransportWS}, func(p *wsPeer, protocol string) {
+		readWSMessage(t, p)
+		writeWSMessage(t, p, `{"type":"connection_ack"}`)
+		readWSMessage(t, p)
+		completed <- readWSMessage(t, p)
+		p.readFrame()
+	})
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	messages, err := client.Subscribe(ctx, NewRequest("subscription { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	got := collect(t, messages)
+	if len(got) != 1 || got[0].End != SubscriptionCanceled || !errors.Is(got[0].Err, context.Canceled) {
+		t.Fatalf("got %+v, want a cancellation", got)
+	}
+	select {
+	case msg := <-completed:
+		if msg.Type != "complete" || msg.ID == "" {
+			t.Errorf("got %+v, want a complete message", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no complete message sent")
+	}
+}
+
+func TestSubscribeLegacyProtocol(t *testing.T) {
+	stopped := make(chan wsMessage, 1)
+	srv := newWSServer(t, []string{ProtocolGraphQLWS}, func(p *wsPeer, protocol string) {
+		readWSMessage(t, p)
+		writeWSMessage(t, p, `{"type":"connection_ack"}`)
+		writeWSMessage(t, p, `{"type":"ka"}`)
+		start := readWSMessage(t, p)
+		if start.Type != "start" {
+			t.Errorf("got %+v, want a start message", start)
+		}
+		writeWSMessage(t, p, `{"id":"`+start.ID+`","type":"data","payload":{"data":{"tick":1}}}`)
+		stopped <- readWSMessage(t, p)
+		p.readFrame()
+	})
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages, err := client.Subscribe(ctx, NewRequest("subscription { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := <-messages
+	var data struct{ Tick int }
+	if err := msg.Decode(&data); err != nil || data.Tick != 1 {
+		t.Fatalf("got %+v, %v", data, err)
+	}
+	cancel()
+	collect(t, messages)
+	if stop := <-stopped; stop.Type != "stop" {
+		t.Errorf("got %+v, want a stop message", stop)
+	}
+}
+
+func TestSubscribeConnectionRejected(t *testing.T) {
+	srv := newWSServer(t, []string{ProtocolGraphQLTransportWS}, func(p *wsPeer, protocol string) {
+		readWSMessage(t, p)
+		writeWSMessage(t, p, `{"type":"connection_error","payload":{"message":"unauthorized"}}`)
+		p.readFrame()
+	})
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	if _, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }")); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestSubscribeReconnect(t *testing.T) {
+	var connections atomic.Int32
+	ids := make(chan string, 2)
+	srv := newWSServer(t, []string{ProtocolGraphQLTransportWS}, func(p *wsPeer, protocol string) {
+		n := connections.Add(1)
+		if init := readWSMessage(t, p); init.Type != "connection_init" {
+			t.Errorf("got %+v, want connection_init", init)
+		}
+		writeWSMessage(t, p, `{"type":"connection_ack"}`)
+		sub := readWSMessage(t, p)
+		ids <- sub.ID
+		if n == 1 {
+			// Drop the connection.
+			return
+		}
+		var payload struct{ Variables map[string]string }
+		json.Unmarshal(sub.Payload, &payload)
+		if payload.Variables["after"] != "1" {
+			t.Errorf("got variables %v, want the resumed cursor", payload.Variables)
+		}
+		writeWSMessage(t, p, `{"id":"`+sub.ID+`","type":"next","payload":{"data":{"tick":2}}}`)
+		writeWSMessage(t, p, `{"id":"`+sub.ID+`","type":"complete"}`)
+		p.readFrame()
+	})
+	defer srv.Close()
+	client := NewClient(srv.URL, WithClock(&recordingClock{}), WithSubscriptionReconnect(SubscriptionReconnect{
+		Backoff: DefaultBackoff,
+		Resume:  func(req *Request) { req.Var("after", "1") },
+	}))
+	messages, err := client.Subscribe(context.Background(), NewRequest("subscription($after: String) { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, messages)
+	if len(got) != 2 || got[1].End != SubscriptionCompleted {
+		t.Fatalf("got %+v, want the event of the new connection and a completion", got)
+	}
+	if first, second := <-ids, <-ids; first != second {
+		t.Errorf("resubscribed as %q, want %q", second, first)
+	}
+	if connections.Load() != 2 {
+		t.Errorf("got %d connections, want 2", connections.Load())
+	}
+}
+
+func TestSubscribeReconnectFatalClose(t *testing.T) {
+	var connections atomic.Int32
+	srv := newWSServer(t, []string{ProtocolGraphQLTransportWS}, func(p *wsPeer, protocol string) {
+		connections.Add(1)
+		readWSMessage(t, p)
+		writeWSMessage(t, p, `{"type":"connection_ack"}`)
+		readWSMessage(t, p)
+		p.writeFrame(true, wsOpClose, []byte{4400 >> 8, 4400 & 0xff})
+		p.readFrame()
+	})
+	defer srv.Close()
+	client := NewClient(srv.URL, WithClock(&recordingClock{}), WithSubscriptionReconnect(DefaultSubscriptionReconnect))
+	messages, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, messages)
+	if len(got) != 1 || got[0].End != SubscriptionConnectionLost || !errors.Is(got[0].Err, ErrConnectionLost) {
+		t.Fatalf("got %+v, want the connection lost", got)
+	}
+	if connections.Load() != 1 {
+		t.Errorf("got %d connections, want no reconnect after a fatal close", connections.Load())
+	}
+}
+
+func TestConnectionInitPayloadOnReconnect(t *testing.T) {
+	var connections atomic.Int32
+	payloads := make(chan string, 2)
+	srv := newWSServer(t, []string{ProtocolGraphQLTransportWS}, func(p *wsPeer, protocol string) {
+		n := connections.Add(1)
+		payloads <- string(readWSMessage(t, p).Payload)
+		writeWSMessage(t, p, `{"type":"connection_ack"}`)
+		sub := readWSMessage(t, p)
+		if n == 1 {
+			return
+		}
+		writeWSMessage(t, p, `{"id":"`+sub.ID+`","type":"complete"}`)
+		p.readFrame()
+	})
+	defer srv.Close()
+	var fetches atomic.Int32
+	client := NewClient(srv.URL, WithClock(&recordingClock{}), WithSubscriptionReconnect(DefaultSubscriptionReconnect),
+		WithConnectionInitPayload(func(ctx context.Context) (interface{}, error) {
+			return map[string]int32{"token": fetches.Add(1)}, nil
+		}))
+	messages, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collect(t, messages)
+	if first, second := <-payloads, <-payloads; first != `{"token":1}` || second != `{"token":2}` {
+		t.Errorf("got payloads %s and %s, want the payload fetched for each connection", first, second)
+	}
+}
+
+func TestConnectionInitPayloadError(t *testing.T) {
+	srv := newWSServer(t, []string{ProtocolGraphQLTransportWS}, func(p *wsPeer, protocol string) {
+		p.readFrame()
+	})
+	defer srv.Close()
+	expired := errors.New("token expired")
+	client := NewClient(srv.URL, WithConnectionInitPayload(func(ctx context.Context) (interface{}, error) {
+		return nil, expired
+	}))
+	if _, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }")); !errors.Is(err, expired) {
+		t.Fatalf("got %v, want the error of the payload", err)
+	}
+}
+
+func TestSubscriptionKeepalive(t *testing.T) {
+	pings := make(chan int, 1)
+	srv := newWSServer(t, []string{ProtocolGraphQLTransportWS}, func(p *wsPeer, protocol string) {
+		readWSMessage(t, p)
+		writeWSMessage(t, p, `{"type":"connection_ack"}`)
+		readWSMessage(t, p)
+		n := 0
+		for {
+			f, err := p.readFrame()
+			if err != nil {
+				break
+			}
+			if f.opcode != wsOpPing {
+				continue
+			}
+			// Answer the first pings only.
+			if n++; n <= 2 {
+				p.writeFrame(true, wsOpPong, f.payload)
+			}
+		}
+		pings <- n
+	})
+	defer srv.Close()
+	client := NewClient(srv.URL, WithSubscriptionKeepalive(SubscriptionKeepalive{Interval: 10 * time.Millisecond, Timeout: 50 * time.Millisecond}))
+	messages, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, messages)
+	if len(got) != 1 || got[0].End != SubscriptionConnectionLost || !errors.Is(got[0].Err, errKeepaliveTimeout) {
+		t.Fatalf("got %+v, want the connection lost for not answering a ping", got)
+	}
+	if n := <-pings; n != 3 {
+		t.Errorf("got %d pings, want the connection closed after the first unanswered one", n)
+	}
+}
+
+// buffered returns the data of the events held by sub.
+func buffered(sub *subscription) []string {
+	var got []string
+	for len(sub.events) > 0 {
+		msg := <-sub.events
+		if msg.Err != nil {
+			got = append(got, msg.Err.Error())
+			continue
+		}
+		got = append(got, string(msg.Data))
+	}
+	return got
+}
+
+func TestSubscriptionBackpressure(t *testing.T) {
+	for strategy, want := range map[Backpressure]string{
+		BackpressureDropOldest: "3,4",
+		BackpressureFail:       "1,2," + ErrSlowConsumer.Error(),
+	} {
+		client := NewClient("http://example.com", WithSubscriptionBuffer(2, strategy))
+		sub := client.newSubscription("1", NewRequest("subscription { tick }"))
+		canceled := 0
+		sub.cancel = func() { canceled++ }
+		for _, data := range []string{"1", "2", "3", "4"} {
+			sub.deliver(SubscriptionMessage{Data: json.RawMessage(data)})
+		}
+		if got := strings.Join(buffered(sub), ","); got != want {
+			t.Errorf("%d: got %s, want %s", strategy, got, want)
+		}
+		if wantCanceled := map[bool]int{true: 1}[strategy == BackpressureFail]; canceled != wantCanceled {
+			t.Errorf("%d: canceled %d times, want %d", strategy, canceled, wantCanceled)
+		}
+	}
+}
+
+func TestSubscriptionBackpressureBlock(t *testing.T) {
+	client := NewClient("http://example.com", WithSubscriptionBuffer(1, BackpressureBlock))
+	sub := client.newSubscription("1", NewRequest("subscription { tick }"))
+	sub.deliver(SubscriptionMessage{Data: json.RawMessage("1")})
+	delivered := make(chan struct{})
+	go func() {
+		sub.deliver(SubscriptionMessage{Data: json.RawMessage("2")})
+		close(delivered)
+	}()
+	select {
+	case <-delivered:
+		t.Fatal("event delivered to a full buffer")
+	case <-time.After(10 * time.Millisecond):
+	}
+	<-sub.events
+	<-delivered
+	if got := strings.Join(buffered(sub), ","); got != "2" {
+		t.Errorf("got %s, want the held event", got)
+	}
+}
+
+func TestSubscriptionEnds(t *testing.T) {
+	srv := newWSServer(t, []string{ProtocolGraphQLTransportWS}, func(p *wsPeer, protocol string) {
+		readWSMessage(t, p)
+		writeWSMessage(t, p, `{"type":"connection_ack"}`)
+		sub := readWSMessage(t, p)
+		writeWSMessage(t, p, `{"id":"`+sub.ID+`","type":"next","payload":{"data":{"tick":null},"errors":[{"message":"partial"}]}}`)
+	})
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	messages, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, messages)
+	if len(got) != 2 {
+		t.Fatalf("got %+v, want an event and the end", got)
+	}
+	if event := got[0]; event.End != 0 || event.Err == nil || event.Err.Error() != "graphql: partial" || string(event.Data) != `{"tick":null}` {
+		t.Errorf("got event %+v, want its data and first error", event)
+	}
+	if last := got[1]; last.End != SubscriptionConnectionLost || !errors.Is(last.Err, ErrConnectionLost) || last.Data != nil {
+		t.Errorf("got last message %+v, want the connection lost", last)
+	}
+	if err := got[1].Decode(new(interface{})); !errors.Is(err, ErrConnectionLost) {
+		t.Errorf("Decode returned %v, want the error of the message", err)
+	}
+}
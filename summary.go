@@ -0,0 +1,242 @@
+package graphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// RequestSummary describes a completed Run or RunStream call.
+type RequestSummary struct {
+	OperationName string
+	// OperationType is OperationQuery, OperationMutation or
+	// OperationSubscription.
+	OperationType string
+	// VariablesHash identifies the variables without revealing them: the
+	// first 16 hex digits of the SHA-256 of their JSON encoding.
+	VariablesHash string
+	Duration      time.Duration
+	// BytesOut and BytesIn count the request and response bodies of all
+	// attempts.
+	BytesOut int64
+	BytesIn  int64
+	// StatusCode is the status of the last response, zero if none.
+	StatusCode int
+	// Attempts is the number of HTTP requests made, retries included.
+	Attempts int
+	Err      error
+	// ErrorClass classifies Err, see ErrorClass.
+	ErrorClass string
+}
+
+// Retries returns the number of retries made.
+func (s RequestSummary) Retries() int {
+	if s.Attempts == 0 {
+		return 0
+	}
+	return s.Attempts - 1
+}
+
+// WithRequestSummary logs one structured "graphql request completed"
+// record per Run and RunStream call, at info level, or warn level when it
+// fails, in place of body dumps for production use.
+func WithRequestSummary() ClientOption {
+	return func(client *Client) {
+		client.logSummary = true
+	}
+}
+
+// Error classes of ErrorClass.
+const (
+	ErrorClassCanceled       = "canceled"
+	ErrorClassTimeout        = "timeout"
+	ErrorClassTransport      = "transport"
+	ErrorClassStatus         = "status"
+	ErrorClassRetryExhausted = "retry_exhausted"
+	ErrorClassCircuitOpen    = "circuit_open"
+	ErrorClassQueueTimeout   = "queue_timeout"
+	ErrorClassGraphQL        = "graphql"
+	ErrorClassOther          = "other"
+)
+
+// ErrorClass classifies an error returned by Run, for metrics and logs:
+// one of the ErrorClass constants, or an empty string for nil.
+func ErrorClass(err error) string {
+	var (
+		statusErr    *StatusError
+		exhaustedErr *RetryExhaustedError
+		gqlErr       graphErr
+		netErr       net.Error
+	)
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	case errors.Is(err, ErrQueueTimeout):
+		return ErrorClassQueueTimeout
+	case errors.Is(err, ErrCircuitOpen):
+		return ErrorClassCircuitOpen
+	case errors.As(err, &exhaustedErr):
+		return ErrorClassRetryExhausted
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrAttemptTimeout):
+		return ErrorClassTimeout
+	case errors.As(err, &statusErr):
+		return ErrorClassStatus
+	case errors.As(err, &gqlErr):
+		return ErrorClassGraphQL
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return ErrorClassTimeout
+		}
+		return ErrorClassTransport
+	}
+	return ErrorClassOther
+}
+
+// variablesHash returns the VariablesHash of vars.
+func variablesHash(vars map[string]interface{}) string {
+	if len(vars) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(vars)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// runInfo gathers what the attempts of a call did.
+type runInfo struct {
+	attempts   atomic.Int64
+	bytesOut   atomic.Int64
+	bytesIn    atomic.Int64
+	statusCode atomic.Int64
+	// debugSampled is set when the debug messages of the call are logged
+	// with WithDebugSampling.
+	debugSampled bool
+}
+
+// runInfoKey is the context key of the runInfo of a call.
+type runInfoKey struct{}
+
+// begin starts accounting a call of req.
+func (c *Client) begin(ctx context.Context, req *Request) (context.Context, *runInfo) {
+	info := &runInfo{}
+	if c.debugSampleRate > 0 {
+		info.debugSampled = rand.Float64() < c.debugSampleRate
+	}
+	for _, o := range c.observers {
+		o.Started(ctx, req)
+	}
+	ctx = context.WithValue(ctx, errorReporterKey{}, c.reportError)
+	return context.WithValue(ctx, runInfoKey{}, info), info
+}
+
+// finish accounts a call of req that started at start and returned err.
+func (c *Client) finish(ctx context.Context, req *Request, info *runInfo, start time.Time, err error) {
+	c.stats.done(req.OperationName(), time.Since(start), info, err)
+	audit := c.audits(req)
+	if !c.logSummary && len(c.observers) == 0 && !audit {
+		return
+	}
+	s := c.summary(req, info, start, err)
+	for _, o := range c.observers {
+		o.Completed(ctx, req, s)
+	}
+	if audit {
+		c.audit(ctx, MutationAudit{RequestSummary: s, Variables: c.auditVariables(req)})
+	}
+	if !c.logSummary {
+		return
+	}
+	kv := []interface{}{
+		"operation", s.OperationName,
+		"type", s.OperationType,
+		"variables", s.VariablesHash,
+		"duration", s.Duration,
+		"bytes_out", s.BytesOut,
+		"bytes_in", s.BytesIn,
+		"status", s.StatusCode,
+		"retries", s.Retries(),
+	}
+	if err != nil {
+		c.loggerFor(ctx).Warn("graphql request completed", append(kv, "error_class", s.ErrorClass, "error", err)...)
+		return
+	}
+	c.loggerFor(ctx).Info("graphql request completed", kv...)
+}
+
+// summary returns the RequestSummary of a call.
+func (c *Client) summary(req *Request, info *runInfo, start time.Time, err error) RequestSummary {
+	return RequestSummary{
+		OperationName: req.OperationName(),
+		OperationType: req.OperationType(),
+		VariablesHash: variablesHash(req.vars),
+		Duration:      time.Since(start),
+		BytesOut:      info.bytesOut.Load(),
+		BytesIn:       info.bytesIn.Load(),
+		StatusCode:    int(info.statusCode.Load()),
+		Attempts:      int(info.attempts.Load()),
+		Err:           err,
+		ErrorClass:    ErrorClass(err),
+	}
+}
+
+// meterTransport accounts the attempts of calls in their runInfo and calls
+// the hooks of the client.
+type meterTransport struct {
+	transport http.RoundTripper
+	hooks     []Hooks
+}
+
+func (t *meterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	info, ok := req.Context().Value(runInfoKey{}).(*runInfo)
+	if !ok {
+		info = &runInfo{}
+	}
+	attempt := int(info.attempts.Add(1))
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &countingBody{ReadCloser: req.Body, n: &info.bytesOut}
+	}
+	if len(t.hooks) == 0 {
+		return t.roundTrip(req, info)
+	}
+	t.beforeAttempt(req, attempt)
+	start := time.Now()
+	resp, err := t.roundTrip(req, info)
+	t.afterAttempt(req, resp, err, AttemptInfo{Attempt: attempt, Duration: time.Since(start), StatusCode: statusCode(resp)})
+	return resp, err
+}
+
+func (t *meterTransport) roundTrip(req *http.Request, info *runInfo) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	info.statusCode.Store(int64(resp.StatusCode))
+	resp.Body = &countingBody{ReadCloser: resp.Body, n: &info.bytesIn}
+	return resp, nil
+}
+
+// countingBody adds the bytes read from a body to n.
+type countingBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
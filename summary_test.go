@@ -0,0 +1,53 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRequestSummary(t *testing.T) {
+	srv := failingOnce(http.StatusServiceUnavailable)
+	defer srv.Close()
+	logger := &recordingLogger{}
+	client := NewClient(srv.URL, WithLeveledLogger(logger), WithRequestSummary(), WithClock(&recordingClock{}))
+	req := NewRequest("query Foo($id: ID) { a }")
+	req.Var("id", "1")
+	if err := client.Run(context.Background(), req, nil); err != nil {
+		t.Fatal(err)
+	}
+	e, ok := logger.find("graphql request completed")
+	if !ok {
+		t.Fatalf("no summary in %+v", logger.entries)
+	}
+	if e.level != "info" || e.fields["operation"] != "Foo" || e.fields["type"] != OperationQuery ||
+		e.fields["status"] != http.StatusOK || e.fields["retries"] != 1 || e.fields["variables"] != variablesHash(req.vars) {
+		t.Errorf("got %+v", e)
+	}
+	if n, _ := e.fields["bytes_out"].(int64); n <= 0 {
+		t.Errorf("got %v bytes out", e.fields["bytes_out"])
+	}
+	if variablesHash(req.vars) == "" || variablesHash(req.vars) == variablesHash(map[string]interface{}{"id": "2"}) {
+		t.Error("got variables hashed alike")
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	for err, want := range map[error]string{
+		nil:                                  "",
+		context.Canceled:                     ErrorClassCanceled,
+		fmt.Errorf("x: %w", ErrQueueTimeout): ErrorClassQueueTimeout,
+		ErrCircuitOpen:                       ErrorClassCircuitOpen,
+		&RetryExhaustedError{}:               ErrorClassRetryExhausted,
+		context.DeadlineExceeded:             ErrorClassTimeout,
+		&StatusError{StatusCode: 400}:        ErrorClassStatus,
+		graphErr{Message: "boom"}:            ErrorClassGraphQL,
+		errors.New("boom"):                   ErrorClassOther,
+	} {
+		if got := ErrorClass(err); got != want {
+			t.Errorf("%v: got %q, want %q", err, got, want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package graphql
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+)
+
+// SpanContext identifies the span a request is made in, for trace context
+// propagation, see WithTraceContext.
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Sampled    bool
+	TraceState string
+}
+
+// IsValid reports whether the trace and span IDs are set, as required by
+// W3C Trace Context.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// spanContextKey is the context key of a SpanContext.
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying sc, which requests
+// made with it propagate when the client uses WithTraceContext without an
+// extractor.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the SpanContext carried by ctx.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// SpanExtractor returns the span of a context, e.g. from the tracing
+// library of the application.
+type SpanExtractor func(ctx context.Context) (SpanContext, bool)
+
+// WithTraceContext injects the traceparent and tracestate headers of W3C
+// Trace Context into every request made in a span, so GraphQL calls show
+// up in distributed traces. extract finds the span of the request context;
+// if nil, SpanContextFromContext is used. An OpenTelemetry extractor is
+// a few lines:
+//
+//	func(ctx context.Context) (graphql.SpanContext, bool) {
+//		sc := trace.SpanContextFromContext(ctx)
+//		return graphql.SpanContext{
+//			TraceID:    sc.TraceID(),
+//			SpanID:     sc.SpanID(),
+//			Sampled:    sc.IsSampled(),
+//			TraceState: sc.TraceState().String(),
+//		}, sc.IsValid()
+//	}
+func WithTraceContext(extract SpanExtractor) ClientOption {
+	return func(client *Client) {
+		if extract == nil {
+			extract = SpanContextFromContext
+		}
+		client.spanExtractor = extract
+	}
+}
+
+// WithB3Headers also injects the X-B3 headers of Zipkin B3 propagation
+// with WithTraceContext.
+func WithB3Headers() ClientOption {
+	return func(client *Client) {
+		client.b3Headers = true
+	}
+}
+
+// traceTransport injects trace context headers.
+type traceTransport struct {
+	transport http.RoundTripper
+	extract   SpanExtractor
+	b3        bool
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sc, ok := t.extract(req.Context())
+	if !ok || !sc.IsValid() || req.Header.Get("traceparent") != "" {
+		return t.transport.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	traceID, spanID := hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:])
+	flags, sampled := "00", "0"
+	if sc.Sampled {
+		flags, sampled = "01", "1"
+	}
+	req.Header.Set("traceparent", "00-"+traceID+"-"+spanID+"-"+flags)
+	if sc.TraceState != "" {
+		req.Header.Set("tracestate", sc.TraceState)
+	}
+	if t.b3 {
+		req.Header.Set("X-B3-TraceId", traceID)
+		req.Header.Set("X-B3-SpanId", spanID)
+		req.Header.Set("X-B3-Sampled", sampled)
+	}
+	return t.transport.RoundTrip(req)
+}
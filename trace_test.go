@@ -0,0 +1,43 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// headerServer records the headers of each request.
+func headerServer(headers *[]http.Header) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*headers = append(*headers, r.Header.Clone())
+		io.WriteString(w, `{"data":{}}`)
+	}))
+}
+
+func TestTraceContext(t *testing.T) {
+	var headers []http.Header
+	srv := headerServer(&headers)
+	defer srv.Close()
+	sc := SpanContext{TraceState: "vendor=1", Sampled: true}
+	sc.TraceID[15], sc.SpanID[7] = 1, 2
+	client := NewClient(srv.URL, WithTraceContext(nil), WithB3Headers())
+	if err := client.Run(ContextWithSpanContext(context.Background(), sc), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	h := headers[0]
+	if got := h.Get("traceparent"); got != "00-00000000000000000000000000000001-0000000000000002-01" {
+		t.Errorf("got traceparent %q", got)
+	}
+	if h.Get("tracestate") != "vendor=1" || h.Get("X-B3-TraceId") != "00000000000000000000000000000001" ||
+		h.Get("X-B3-SpanId") != "0000000000000002" || h.Get("X-B3-Sampled") != "1" {
+		t.Errorf("got headers %v", h)
+	}
+	if headers[1].Get("traceparent") != "" {
+		t.Errorf("got traceparent %q outside a span", headers[1].Get("traceparent"))
+	}
+}
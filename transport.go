@@ -0,0 +1,162 @@
+package graphql
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// WithHTTP2 makes the default HTTP client negotiate HTTP/2 with TLS
+// servers and keep enough idle connections for high-throughput use.
+func WithHTTP2() ClientOption {
+	return func(client *Client) {
+		client.useHTTP2 = true
+	}
+}
+
+// WithBaseTransport replaces the http.Transport the default HTTP client
+// sends requests with, keeping the retry transport and the other layers
+// around it. It allows transports this package doesn't depend on, such as
+// the HTTP/3 transport of quic-go. The options configuring the
+// http.Transport have no effect then.
+func WithBaseTransport(transport http.RoundTripper) ClientOption {
+	return func(client *Client) {
+		client.baseTransport = transport
+	}
+}
+
+// WithTLSConfig sets the TLS configuration of the default HTTP client,
+// e.g. with the RootCAs of a private CA. The configuration is cloned.
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(client *Client) {
+		client.tlsConfig = config.Clone()
+	}
+}
+
+// WithClientCertificate makes the default HTTP client present cert to
+// servers requiring mutual TLS. It can be combined with WithTLSConfig.
+func WithClientCertificate(cert tls.Certificate) ClientOption {
+	return func(client *Client) {
+		client.clientCertificates = append(client.clientCertificates, cert)
+	}
+}
+
+// WithProxyFromEnvironment makes the default HTTP client use the proxies
+// given by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables,
+// see http.ProxyFromEnvironment.
+func WithProxyFromEnvironment() ClientOption {
+	return func(client *Client) {
+		client.proxy = http.ProxyFromEnvironment
+	}
+}
+
+// WithProxyURL makes the default HTTP client send all requests through the
+// proxy at u.
+func WithProxyURL(u *url.URL) ClientOption {
+	return func(client *Client) {
+		client.proxy = http.ProxyURL(u)
+	}
+}
+
+// WithSOCKS5Proxy makes the default HTTP client dial through the SOCKS5
+// proxy at addr (host:port), authenticating with user and password unless
+// user is empty.
+func WithSOCKS5Proxy(addr, user, password string) ClientOption {
+	return func(client *Client) {
+		u := &url.URL{Scheme: "socks5", Host: addr}
+		if user != "" {
+			u.User = url.UserPassword(user, password)
+		}
+		client.proxy = http.ProxyURL(u)
+	}
+}
+
+// ConnectionPool tunes the connections of the default HTTP client, see the
+// fields of the same name of http.Transport. Zero fields keep their
+// defaults.
+type ConnectionPool struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+}
+
+// WithConnectionPool tunes the connection pool of the default HTTP client,
+// whose Go defaults keep two idle connections per host, which throttles
+// highly concurrent workloads.
+func WithConnectionPool(pool ConnectionPool) ClientOption {
+	return func(client *Client) {
+		client.connectionPool = &pool
+	}
+}
+
+// Middleware wraps an http.RoundTripper, e.g. to add authentication,
+// tracing or metrics.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// WithTransportMiddleware wraps the transport of the HTTP client, the
+// retry transport for the default one, with middlewares. The first one is
+// the outermost: it sees a request first and its response last. They are
+// inside hedging and the circuit breaker, so they see each attempt made by
+// those, but not the retries of the retry transport. The option can be
+// given several times, adding middlewares inside the previous ones.
+func WithTransportMiddleware(middlewares ...Middleware) ClientOption {
+	return func(client *Client) {
+		client.middlewares = append(client.middlewares, middlewares...)
+	}
+}
+
+// http2 pool settings, close to the ones of http.DefaultTransport with
+// more idle connections per host.
+const (
+	http2MaxIdleConns        = 100
+	http2MaxIdleConnsPerHost = 100
+	http2IdleConnTimeout     = 90 * time.Second
+	http2TLSHandshakeTimeout = 10 * time.Second
+)
+
+// newBaseTransport returns the transport the default HTTP client sends
+// requests with.
+func (c *Client) newBaseTransport() http.RoundTripper {
+	if c.baseTransport != nil {
+		return c.baseTransport
+	}
+	transport := &http.Transport{
+		Proxy:       c.proxy,
+		DialContext: c.newDial(),
+	}
+	if c.expectContinue {
+		transport.ExpectContinueTimeout = c.expectContinueTimeout
+	}
+	if c.tlsConfig != nil || len(c.clientCertificates) > 0 {
+		config := c.tlsConfig.Clone()
+		if config == nil {
+			config = &tls.Config{}
+		}
+		config.Certificates = append(config.Certificates, c.clientCertificates...)
+		transport.TLSClientConfig = config
+	}
+	if c.useHTTP2 {
+		transport.ForceAttemptHTTP2 = true
+		transport.MaxIdleConns = http2MaxIdleConns
+		transport.MaxIdleConnsPerHost = http2MaxIdleConnsPerHost
+		transport.IdleConnTimeout = http2IdleConnTimeout
+		transport.TLSHandshakeTimeout = http2TLSHandshakeTimeout
+	}
+	if pool := c.connectionPool; pool != nil {
+		if pool.MaxIdleConns > 0 {
+			transport.MaxIdleConns = pool.MaxIdleConns
+		}
+		if pool.MaxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = pool.MaxIdleConnsPerHost
+		}
+		if pool.MaxConnsPerHost > 0 {
+			transport.MaxConnsPerHost = pool.MaxConnsPerHost
+		}
+		if pool.IdleConnTimeout > 0 {
+			transport.IdleConnTimeout = pool.IdleConnTimeout
+		}
+	}
+	return transport
+}
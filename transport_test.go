@@ -0,0 +1,252 @@
+package graphql
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// protoServer is a TLS server answering with the protocol of each request
+// in the Proto header.
+func protoServer(http2 bool) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Proto", r.Proto)
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	srv.EnableHTTP2 = http2
+	srv.StartTLS()
+	return srv
+}
+
+// trusting returns a TLS configuration trusting the certificate of srv.
+func trusting(srv *httptest.Server) *tls.Config {
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	return &tls.Config{RootCAs: roots}
+}
+
+// runProto runs a query against srv with a client created with opts and
+// returns the protocol the server saw.
+func runProto(t *testing.T, srv *httptest.Server, opts ...ClientOption) string {
+	t.Helper()
+	var proto string
+	opts = append(opts, WithHooks(Hooks{OnResponse: func(req *http.Request, resp *http.Response, info AttemptInfo) {
+		proto = resp.Header.Get("Proto")
+	}}))
+	if err := NewClient(srv.URL, opts...).Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	return proto
+}
+
+func TestHTTP2(t *testing.T) {
+	srv := protoServer(true)
+	defer srv.Close()
+	if got := runProto(t, srv, WithTLSConfig(trusting(srv))); got != "HTTP/1.1" {
+		t.Errorf("got %s without WithHTTP2", got)
+	}
+	if got := runProto(t, srv, WithTLSConfig(trusting(srv)), WithHTTP2()); got != "HTTP/2.0" {
+		t.Errorf("got %s with WithHTTP2", got)
+	}
+}
+
+func TestBaseTransport(t *testing.T) {
+	sent := 0
+	base := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		sent++
+		resp := response(http.StatusOK)
+		resp.Body = io.NopCloser(strings.NewReader(`{"data":{}}`))
+		return resp, nil
+	})
+	client := NewClient("http://example.invalid", WithBaseTransport(base))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if sent != 1 {
+		t.Errorf("got %d requests through the base transport, want 1", sent)
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+	if err := NewClient(srv.URL, WithoutRetry(), WithTLSConfig(trusting(srv))).Run(context.Background(), NewRequest("{ a }"), nil); err == nil {
+		t.Error("expected an error without a client certificate")
+	}
+	client := NewClient(srv.URL, WithTLSConfig(trusting(srv)), WithClientCertificate(srv.TLS.Certificates[0]))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	var hosts []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.URL.Host)
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer proxy.Close()
+	u, _ := url.Parse(proxy.URL)
+	client := NewClient("http://graphql.example/query", WithProxyURL(u))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || hosts[0] != "graphql.example" {
+		t.Errorf("got %q through the proxy", hosts)
+	}
+}
+
+// socks5Proxy starts a SOCKS5 proxy requiring user and password, which
+// records the addresses it connects to.
+func socks5Proxy(t *testing.T, user, password string) (string, *[]string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	var targets []string
+	handle := func(conn net.Conn) {
+		defer conn.Close()
+		read := func(n int) []byte {
+			b := make([]byte, n)
+			if _, err := io.ReadFull(conn, b); err != nil {
+				return nil
+			}
+			return b
+		}
+		// str reads a string prefixed with its length.
+		str := func() string {
+			n := read(1)
+			if n == nil {
+				return ""
+			}
+			return string(read(int(n[0])))
+		}
+		// The greeting, then the username/password authentication.
+		greeting := read(2)
+		if greeting == nil || read(int(greeting[1])) == nil {
+			return
+		}
+		conn.Write([]byte{5, 2})
+		if read(1) == nil {
+			return
+		}
+		if u, p := str(), str(); u != user || p != password {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+		// The CONNECT request.
+		head := read(4)
+		if head == nil {
+			return
+		}
+		var host string
+		switch head[3] {
+		case 1:
+			host = net.IP(read(4)).String()
+		case 3:
+			host = str()
+		default:
+			return
+		}
+		port := read(2)
+		if port == nil {
+			return
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1])))
+		mu.Lock()
+		targets = append(targets, addr)
+		mu.Unlock()
+		target, err := net.Dial("tcp", addr)
+		if err != nil {
+			return
+		}
+		defer target.Close()
+		conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		go io.Copy(target, conn)
+		io.Copy(conn, target)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return ln.Addr().String(), &targets
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	srv, requests := countingServer(http.StatusOK)
+	defer srv.Close()
+	addr, targets := socks5Proxy(t, "user", "secret")
+	client := NewClient(srv.URL, WithoutRetry(), WithSOCKS5Proxy(addr, "user", "wrong"))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err == nil {
+		t.Error("expected an error with the wrong password")
+	}
+	client = NewClient(srv.URL, WithSOCKS5Proxy(addr, "user", "secret"))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 1 || len(*targets) != 1 || "http://"+(*targets)[0] != srv.URL {
+		t.Errorf("got %d requests through %q", requests.Load(), *targets)
+	}
+}
+
+func TestConnectionPool(t *testing.T) {
+	client := NewClient("http://example.com", WithHTTP2(), WithConnectionPool(ConnectionPool{
+		MaxIdleConnsPerHost: 32,
+		MaxConnsPerHost:     64,
+		IdleConnTimeout:     time.Minute,
+	}))
+	transport := client.newBaseTransport().(*http.Transport)
+	if transport.MaxIdleConns != http2MaxIdleConns || transport.MaxIdleConnsPerHost != 32 ||
+		transport.MaxConnsPerHost != 64 || transport.IdleConnTimeout != time.Minute {
+		t.Errorf("got %d, %d, %d and %s", transport.MaxIdleConns, transport.MaxIdleConnsPerHost,
+			transport.MaxConnsPerHost, transport.IdleConnTimeout)
+	}
+}
+
+func TestTransportMiddleware(t *testing.T) {
+	srv, _ := sequenceServer(503, 200)
+	defer srv.Close()
+	var calls []string
+	middleware := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				calls = append(calls, name+">")
+				resp, err := next.RoundTrip(r)
+				calls = append(calls, "<"+name)
+				return resp, err
+			})
+		}
+	}
+	client := NewClient(srv.URL, WithClock(&recordingClock{}),
+		WithTransportMiddleware(middleware("a"), middleware("b")), WithTransportMiddleware(middleware("c")))
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(calls, " "); got != "a> b> c> <c <b <a" {
+		t.Errorf("got %s, want the middlewares nested in order around the retries", got)
+	}
+}
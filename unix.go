@@ -0,0 +1,60 @@
+package graphql
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"strings"
+)
+
+// unixScheme is the scheme of Unix domain socket endpoints, such as
+// unix:///var/run/api.sock/graphql. The socket path runs up to the first
+// element ending in ".sock", or is the whole path if there is none, in
+// which case the HTTP path is "/". They are sent as http URLs whose host
+// encodes the socket path, which the default HTTP client dials.
+const unixScheme = "unix://"
+
+// unixHostSuffix marks the hosts encoding a socket path.
+const unixHostSuffix = ".unix"
+
+// unixEndpoint rewrites a unix endpoint to the http URL it is sent to,
+// other endpoints are returned as they are.
+func unixEndpoint(endpoint string) string {
+	if !strings.HasPrefix(endpoint, unixScheme) {
+		return endpoint
+	}
+	rest := strings.TrimPrefix(endpoint, unixScheme)
+	query := ""
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		rest, query = rest[:i], rest[i:]
+	}
+	socket, path := rest, "/"
+	if i := strings.Index(rest, ".sock/"); i >= 0 {
+		socket, path = rest[:i+len(".sock")], rest[i+len(".sock"):]
+	}
+	return "http://" + hex.EncodeToString([]byte(socket)) + unixHostSuffix + path + query
+}
+
+// unixSocket returns the socket path encoded in the host of addr.
+func unixSocket(addr string) (string, bool) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || !strings.HasSuffix(host, unixHostSuffix) {
+		return "", false
+	}
+	socket, err := hex.DecodeString(strings.TrimSuffix(host, unixHostSuffix))
+	if err != nil {
+		return "", false
+	}
+	return string(socket), true
+}
+
+// dialUnix wraps dial to connect to the socket of unix endpoints.
+func dialUnix(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if socket, ok := unixSocket(addr); ok {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		return dial(ctx, network, addr)
+	}
+}
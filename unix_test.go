@@ -0,0 +1,45 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnixEndpoint(t *testing.T) {
+	for endpoint, want := range map[string]string{
+		"http://example.com/graphql":           "http://example.com/graphql",
+		"unix:///var/run/api.sock/graphql?x=1": "http://" + "2f7661722f72756e2f6170692e736f636b" + unixHostSuffix + "/graphql?x=1",
+		"unix:///var/run/api":                  "http://" + "2f7661722f72756e2f617069" + unixHostSuffix + "/",
+	} {
+		if got := unixEndpoint(endpoint); got != want {
+			t.Errorf("%s: got %s, want %s", endpoint, got, want)
+		}
+	}
+}
+
+func TestUnixSocketEndpoint(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "api.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip(err)
+	}
+	var paths []string
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		io.WriteString(w, `{"data":{}}`)
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+	client := NewClient("unix://" + socket + "/graphql")
+	if err := client.Run(context.Background(), NewRequest("{ a }"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(paths, ",") != "/graphql" {
+		t.Errorf("got paths %q", paths)
+	}
+}
@@ -0,0 +1,278 @@
+package graphql
+
+import (
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FileOption are functions that are passed into Request.File to
+// configure the upload of a file.
+type FileOption func(*File)
+
+// ProgressFunc reports the number of bytes of a file sent so far and the
+// total size of the file, or -1 if the size is unknown.
+type ProgressFunc func(bytesSent, total int64)
+
+// WithUploadProgress calls fn as the file is being sent, which lets
+// callers display progress or detect stalled uploads.
+func WithUploadProgress(fn ProgressFunc) FileOption {
+	return func(f *File) {
+		f.Progress = fn
+	}
+}
+
+// WithFileSize sets the size of the file reported to the ProgressFunc.
+// Without it the size is detected from readers that know their length,
+// such as *os.File, *bytes.Reader and *strings.Reader.
+func WithFileSize(size int64) FileOption {
+	return func(f *File) {
+		f.Size = size
+	}
+}
+
+// WithContentType sets the MIME type sent with the file part, for servers
+// that validate the type of uploads.
+func WithContentType(contentType string) FileOption {
+	return func(f *File) {
+		f.ContentType = contentType
+	}
+}
+
+// WithPartHeader adds a header to the file part.
+func WithPartHeader(key, value string) FileOption {
+	return func(f *File) {
+		if f.Header == nil {
+			f.Header = make(textproto.MIMEHeader)
+		}
+		f.Header.Add(key, value)
+	}
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// partHeader returns the MIME header of the file part named field.
+func (f File) partHeader(field string) textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader, len(f.Header)+2)
+	for key, values := range f.Header {
+		h[textproto.CanonicalMIMEHeaderKey(key)] = append([]string(nil), values...)
+	}
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(field), quoteEscaper.Replace(f.Name)))
+	contentType := f.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h.Set("Content-Type", contentType)
+	if f.digest != "" {
+		h.Set("Content-Digest", f.digest)
+	}
+	return h
+}
+
+// WithUploadLimits limits the size of each uploaded file to maxFileSize
+// bytes and the size of the whole multipart body to maxTotalSize bytes.
+// A limit of zero or less means no limit.
+// Files of known size are checked before anything is sent; files whose
+// size can't be determined are checked while they are streamed and the
+// request is aborted as soon as a limit is exceeded. Either way the error
+// is an *UploadTooLargeError.
+func WithUploadLimits(maxFileSize, maxTotalSize int64) ClientOption {
+	return func(client *Client) {
+		client.uploadLimits = uploadLimits{file: maxFileSize, total: maxTotalSize}
+	}
+}
+
+// UploadTooLargeError is returned when an upload exceeds the limits set
+// with WithUploadLimits.
+type UploadTooLargeError struct {
+	// File is the name of the file that exceeded a limit, or empty when
+	// the total limit was exceeded by the request as a whole.
+	File string
+	// Size is the size reached, which may be a lower bound when the file
+	// was being streamed.
+	Size  int64
+	Limit int64
+}
+
+func (e *UploadTooLargeError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("graphql: upload of %d bytes exceeds the total limit of %d bytes", e.Size, e.Limit)
+	}
+	return fmt.Sprintf("graphql: file %q of %d bytes exceeds the limit of %d bytes", e.File, e.Size, e.Limit)
+}
+
+type uploadLimits struct {
+	file  int64
+	total int64
+}
+
+// check validates the files of known size against the limits before the
+// request is sent.
+func (l uploadLimits) check(operations []byte, files []File) error {
+	if l.file <= 0 && l.total <= 0 {
+		return nil
+	}
+	total := int64(len(operations))
+	for _, f := range files {
+		size := f.size()
+		if size < 0 {
+			continue
+		}
+		if l.file > 0 && size > l.file {
+			return &UploadTooLargeError{File: f.Name, Size: size, Limit: l.file}
+		}
+		total += size
+	}
+	if l.total > 0 && total > l.total {
+		return &UploadTooLargeError{Size: total, Limit: l.total}
+	}
+	return nil
+}
+
+// reader returns the reader of f, enforcing the limits while it is read.
+// sent is the number of bytes already written to the body.
+func (l uploadLimits) reader(f File, sent int64) io.Reader {
+	if l.file <= 0 && l.total <= 0 {
+		return f.reader()
+	}
+	return &limitedReader{r: f.reader(), name: f.Name, limits: l, sent: sent}
+}
+
+type limitedReader struct {
+	r      io.Reader
+	name   string
+	limits uploadLimits
+	n      int64
+	sent   int64
+}
+
+func (lr *limitedReader) Read(b []byte) (int, error) {
+	n, err := lr.r.Read(b)
+	lr.n += int64(n)
+	if lr.limits.file > 0 && lr.n > lr.limits.file {
+		return 0, &UploadTooLargeError{File: lr.name, Size: lr.n, Limit: lr.limits.file}
+	}
+	if lr.limits.total > 0 && lr.sent+lr.n > lr.limits.total {
+		return 0, &UploadTooLargeError{Size: lr.sent + lr.n, Limit: lr.limits.total}
+	}
+	return n, err
+}
+
+// size returns the size of the file if it is known or can be detected,
+// or -1.
+func (f File) size() int64 {
+	if f.Size > 0 {
+		return f.Size
+	}
+	switch r := f.R.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len())
+	case *os.File:
+		if info, err := r.Stat(); err == nil && info.Mode().IsRegular() {
+			if offset, err := r.Seek(0, io.SeekCurrent); err == nil {
+				return info.Size() - offset
+			}
+		}
+	}
+	return -1
+}
+
+// reader returns the reader to copy the file contents from.
+func (f File) reader() io.Reader {
+	if f.Progress == nil {
+		return f.R
+	}
+	return &progressReader{r: f.R, total: f.size(), fn: f.Progress}
+}
+
+// progressReader reports the bytes read from r to fn.
+type progressReader struct {
+	r     io.Reader
+	sent  int64
+	total int64
+	fn    ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.sent += int64(n)
+		p.fn(p.sent, p.total)
+	}
+	return n, err
+}
+
+// Upload is a file passed directly as the value of an Upload scalar
+// variable:
+//
+//	req.Var("avatar", graphql.Upload{Name: "me.png", R: f})
+//
+// The client maps it to its variable path when building the multipart
+// request, so the Field is ignored.
+type Upload File
+
+// MarshalJSON encodes the upload as null, the placeholder the multipart
+// request specification uses for files in the operations part.
+func (Upload) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+// hasFiles reports whether the request contains any file to upload.
+func (req *Request) hasFiles() bool {
+	return len(req.files) > 0 || len(uploads(req.vars)) > 0
+}
+
+// uploadFiles returns the files set with File followed by the uploads
+// found in the variables.
+func (req *Request) uploadFiles() []File {
+	vars := uploads(req.vars)
+	return append(append(make([]File, 0, len(req.files)+len(vars)), req.files...), vars...)
+}
+
+// uploads walks the variables and returns each Upload found in them as a
+// File whose Field is the path of the variable. Lists of uploads, for
+// [Upload!]! variables, are mapped element by element in order.
+func uploads(vars map[string]interface{}) []File {
+	var files []File
+	walkUploads("variables", vars, &files)
+	return files
+}
+
+func walkUploads(path string, value interface{}, files *[]File) {
+	switch v := value.(type) {
+	case Upload:
+		f := File(v)
+		f.Field = path
+		*files = append(*files, f)
+	case *Upload:
+		if v != nil {
+			walkUploads(path, *v, files)
+		}
+	case []Upload:
+		for i := range v {
+			walkUploads(path+"."+strconv.Itoa(i), v[i], files)
+		}
+	case []*Upload:
+		for i := range v {
+			walkUploads(path+"."+strconv.Itoa(i), v[i], files)
+		}
+	case []interface{}:
+		for i := range v {
+			walkUploads(path+"."+strconv.Itoa(i), v[i], files)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			walkUploads(path+"."+key, v[key], files)
+		}
+	}
+}
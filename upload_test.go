@@ -0,0 +1,188 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// uploadPart is a part of a multipart request received by a server.
+type uploadPart struct {
+	name   string
+	header textproto.MIMEHeader
+	body   string
+}
+
+// uploadServer records the parts of the multipart requests it receives.
+func uploadServer(t *testing.T, parts *[]uploadPart) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			b, _ := io.ReadAll(p)
+			*parts = append(*parts, uploadPart{name: p.FormName(), header: p.Header, body: string(b)})
+		}
+		io.WriteString(w, `{"data":{}}`)
+	}))
+}
+
+// runUpload runs the mutation q with the files added by set, as
+// multipart.
+func runUpload(t *testing.T, client *Client, q string, set func(req *Request)) error {
+	t.Helper()
+	req := NewRequest(q)
+	set(req)
+	return client.Run(context.Background(), req, nil)
+}
+
+func TestUploadProgress(t *testing.T) {
+	var parts []uploadPart
+	srv := uploadServer(t, &parts)
+	defer srv.Close()
+	content := strings.Repeat("x", 1<<20)
+	var sent []int64
+	var total int64
+	err := runUpload(t, NewClient(srv.URL, UseMultipartForm()), "mutation($f: Upload!) { upload(file: $f) }", func(req *Request) {
+		req.File("f", "a.txt", strings.NewReader(content), WithUploadProgress(func(bytesSent, size int64) {
+			sent = append(sent, bytesSent)
+			total = size
+		}))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) < 2 || sent[len(sent)-1] != int64(len(content)) || total != int64(len(content)) {
+		t.Fatalf("got progress %v of %d, want it to reach %d", sent, total, len(content))
+	}
+	for i := 1; i < len(sent); i++ {
+		if sent[i] <= sent[i-1] {
+			t.Fatalf("got progress %v, want it increasing", sent)
+		}
+	}
+}
+
+func TestUploadPartHeaders(t *testing.T) {
+	var parts []uploadPart
+	srv := uploadServer(t, &parts)
+	defer srv.Close()
+	err := runUpload(t, NewClient(srv.URL, UseMultipartForm()), "mutation($a: Upload!, $b: Upload!) { upload(a: $a, b: $b) }", func(req *Request) {
+		req.File("a", "me.png", strings.NewReader("png"), WithContentType("image/png"), WithPartHeader("X-Origin", "camera"))
+		req.File("b", `we"ird.bin`, strings.NewReader("bin"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 4 {
+		t.Fatalf("got %d parts", len(parts))
+	}
+	if h := parts[2].header; h.Get("Content-Type") != "image/png" || h.Get("X-Origin") != "camera" || parts[2].body != "png" {
+		t.Errorf("got header %v", h)
+	}
+	if h := parts[3].header; h.Get("Content-Type") != "application/octet-stream" || h.Get("Content-Disposition") != `form-data; name="1"; filename="we\"ird.bin"` {
+		t.Errorf("got header %v", h)
+	}
+}
+
+func TestUploadVariables(t *testing.T) {
+	var parts []uploadPart
+	srv := uploadServer(t, &parts)
+	defer srv.Close()
+	err := runUpload(t, NewClient(srv.URL, UseMultipartForm()), "mutation($avatar: Upload!, $input: Input!) { update(avatar: $avatar, input: $input) }", func(req *Request) {
+		req.Var("avatar", Upload{Name: "me.png", R: strings.NewReader("png")})
+		req.Var("input", map[string]interface{}{"name": "me", "cover": &Upload{Name: "cover.jpg", R: strings.NewReader("jpg")}})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 4 {
+		t.Fatalf("got %d parts", len(parts))
+	}
+	if want := `{"query":"mutation($avatar: Upload!, $input: Input!) { update(avatar: $avatar, input: $input) }","variables":{"avatar":null,"input":{"cover":null,"name":"me"}}}`; parts[0].body != want {
+		t.Errorf("got operations %s", parts[0].body)
+	}
+	if want := `{"0":["variables.avatar"],"1":["variables.input.cover"]}`; parts[1].body != want {
+		t.Errorf("got map %s", parts[1].body)
+	}
+	if parts[2].body != "png" || parts[3].body != "jpg" {
+		t.Errorf("got files %q and %q", parts[2].body, parts[3].body)
+	}
+}
+
+func TestUploadLists(t *testing.T) {
+	var parts []uploadPart
+	srv := uploadServer(t, &parts)
+	defer srv.Close()
+	err := runUpload(t, NewClient(srv.URL, UseMultipartForm()), "mutation($files: [Upload!]!) { upload(files: $files) }", func(req *Request) {
+		req.Var("files", []Upload{
+			{Name: "a.txt", R: strings.NewReader("a")},
+			{Name: "b.txt", R: strings.NewReader("b")},
+			{Name: "c.txt", R: strings.NewReader("c")},
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 5 {
+		t.Fatalf("got %d parts", len(parts))
+	}
+	if want := `{"query":"mutation($files: [Upload!]!) { upload(files: $files) }","variables":{"files":[null,null,null]}}`; parts[0].body != want {
+		t.Errorf("got operations %s", parts[0].body)
+	}
+	if want := `{"0":["variables.files.0"],"1":["variables.files.1"],"2":["variables.files.2"]}`; parts[1].body != want {
+		t.Errorf("got map %s", parts[1].body)
+	}
+	if got := parts[2].body + parts[3].body + parts[4].body; got != "abc" {
+		t.Errorf("got files %q, want them in order", got)
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	srv, requests := countingServer(http.StatusOK)
+	defer srv.Close()
+	client := NewClient(srv.URL, UseMultipartForm(), WithUploadLimits(10, 1000))
+	upload := func(files ...io.Reader) *UploadTooLargeError {
+		err := runUpload(t, client, "mutation($f: [Upload!]!) { upload(files: $f) }", func(req *Request) {
+			for i, r := range files {
+				req.File("f."+strconv.Itoa(i), "a.txt", r)
+			}
+		})
+		var tooLarge *UploadTooLargeError
+		if !errors.As(err, &tooLarge) {
+			t.Fatalf("got %v, want an UploadTooLargeError", err)
+		}
+		return tooLarge
+	}
+	if err := upload(strings.NewReader(strings.Repeat("x", 11))); *err != (UploadTooLargeError{File: "a.txt", Size: 11, Limit: 10}) {
+		t.Errorf("got %+v, want the file limit exceeded", err)
+	}
+	var files []io.Reader
+	for i := 0; i < 200; i++ {
+		files = append(files, strings.NewReader("12345"))
+	}
+	if err := upload(files...); err.File != "" || err.Limit != 1000 {
+		t.Errorf("got %+v, want the total limit exceeded", err)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("got %d requests, want the files of known size refused before sending", requests.Load())
+	}
+	if err := upload(struct{ io.Reader }{strings.NewReader(strings.Repeat("x", 100))}); err.File != "a.txt" || err.Limit != 10 {
+		t.Errorf("got %+v, want the file limit exceeded while streaming", err)
+	}
+}
@@ -0,0 +1,39 @@
+package graphql
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+// modulePath is the path of this module, as found in build information.
+const modulePath = "github.com/v0vc/graphql"
+
+// WithUserAgent replaces the User-Agent sent with requests, which defaults
+// to one naming this library and its version. An empty userAgent leaves
+// the default of the HTTP client. A User-Agent header set on a Request
+// takes precedence.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(client *Client) {
+		client.userAgent = userAgent
+	}
+}
+
+// defaultUserAgent returns the User-Agent naming this library and its
+// version, as recorded in the build information of the program.
+var defaultUserAgent = sync.OnceValue(func() string {
+	version := "devel"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				if dep.Replace != nil {
+					dep = dep.Replace
+				}
+				if dep.Version != "" {
+					version = dep.Version
+				}
+				break
+			}
+		}
+	}
+	return "v0vc-graphql/" + version
+})
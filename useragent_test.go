@@ -0,0 +1,36 @@
+package graphql
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUserAgent(t *testing.T) {
+	var headers []http.Header
+	srv := headerServer(&headers)
+	defer srv.Close()
+	override := NewRequest("{ a }")
+	override.Header.Set("User-Agent", "request/1")
+	for _, run := range []struct {
+		client *Client
+		req    *Request
+	}{
+		{NewClient(srv.URL), NewRequest("{ a }")},
+		{NewClient(srv.URL, WithUserAgent("app/2")), NewRequest("{ a }")},
+		{NewClient(srv.URL, WithUserAgent("app/2")), override},
+		{NewClient(srv.URL, WithUserAgent("")), NewRequest("{ a }")},
+	} {
+		if err := run.client.Run(context.Background(), run.req, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for _, h := range headers {
+		got = append(got, h.Get("User-Agent"))
+	}
+	if !strings.HasPrefix(got[0], "v0vc-graphql/") || got[1] != "app/2" || got[2] != "request/1" || !strings.HasPrefix(got[3], "Go-http-client/") {
+		t.Errorf("got User-Agents %q", got)
+	}
+}
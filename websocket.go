@@ -0,0 +1,321 @@
+package graphql
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WebSocket opcodes.
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+)
+
+// WebSocket close codes.
+const (
+	wsCloseNormal        = 1000
+	wsCloseProtocolError = 1002
+	wsCloseNoStatus      = 1005
+)
+
+// wsMaxMessageSize bounds the messages read from a WebSocket, to protect
+// the client from a misbehaving server.
+const wsMaxMessageSize = 32 << 20
+
+// wsAcceptGUID is appended to the key of a WebSocket handshake to compute
+// the accept header of the server.
+const wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// CloseError reports that the server closed a WebSocket connection, with
+// the code and reason it gave.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("graphql: websocket closed with code %d", e.Code)
+	}
+	return fmt.Sprintf("graphql: websocket closed with code %d: %s", e.Code, e.Reason)
+}
+
+// wsConn is the client side of a WebSocket connection (RFC 6455). One
+// goroutine reads messages at a time while writes are serialized.
+type wsConn struct {
+	conn io.ReadWriteCloser
+	r    *bufio.Reader
+	// protocol is the subprotocol chosen by the server.
+	protocol string
+	// lastRead is the time the last frame was read, in Unix nanoseconds.
+	lastRead atomic.Int64
+	// busy is set while the reader is away handling a message, and
+	// timedOut once the connection was closed for not answering a ping.
+	busy, timedOut atomic.Bool
+	// inflater decompresses messages when permessage-deflate was
+	// negotiated, nil otherwise.
+	inflater *inflater
+
+	mu sync.Mutex
+}
+
+// webSocketTransport returns the transport the WebSocket handshake to u
+// is sent through: the base transport of the client, limited to HTTP/1.1
+// which connections are upgraded from, with the dialer and proxy of
+// subscriptions.
+func (c *Client) webSocketTransport(u *url.URL) http.RoundTripper {
+	base := c.newBaseTransport()
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return base
+	}
+	t = t.Clone()
+	t.ForceAttemptHTTP2 = false
+	t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	if t.TLSClientConfig != nil {
+		t.TLSClientConfig.NextProtos = nil
+	}
+	if c.subscriptionDial != nil {
+		t.DialContext = dialUnix(c.subscriptionDial)
+	}
+	if c.subscriptionProxy != nil {
+		t.Proxy = c.subscriptionProxy
+	}
+	tunnelPlainWebSocket(t, u)
+	return t
+}
+
+// dialWebSocket opens a WebSocket to endpoint through the transport
+// returned for its http or https URL, offering protocols, and
+// permessage-deflate if compress is set. The endpoint can be a ws, wss,
+// http or https URL.
+func dialWebSocket(ctx context.Context, transport func(u *url.URL) http.RoundTripper, endpoint string, header http.Header, protocols []string, compress bool) (*wsConn, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse websocket endpoint: %w", err)
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("graphql: unsupported websocket scheme %q", u.Scheme)
+	}
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, fmt.Errorf("generate websocket key: %w", err)
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	r.Header.Set("Sec-WebSocket-Key", key)
+	if len(protocols) > 0 {
+		r.Header.Set("Sec-WebSocket-Protocol", strings.Join(protocols, ", "))
+	}
+	if compress {
+		r.Header.Set("Sec-WebSocket-Extensions", deflateOffer)
+	}
+	resp, err := transport(u).RoundTrip(r)
+	if err != nil {
+		return nil, fmt.Errorf("websocket handshake: %w", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		drainBody(resp)
+		return nil, fmt.Errorf("websocket handshake: %w", &StatusError{StatusCode: resp.StatusCode})
+	}
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, errors.New("graphql: websocket handshake: the HTTP transport doesn't support upgrades")
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") || resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		conn.Close()
+		return nil, errors.New("graphql: websocket handshake: invalid upgrade response")
+	}
+	ws := &wsConn{conn: conn, r: bufio.NewReader(conn), protocol: resp.Header.Get("Sec-WebSocket-Protocol")}
+	if compress && acceptsDeflate(resp.Header.Get("Sec-WebSocket-Extensions")) {
+		ws.inflater = &inflater{}
+	}
+	return ws, nil
+}
+
+// wsAccept returns the accept header expected for key.
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// readMessage returns the next data message, reassembling fragments,
+// decompressing them and answering pings on the way. A close frame of the
+// server is answered and returned as a *CloseError.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	started, compressed := false, false
+	for {
+		fin, rsv1, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			closeErr := &CloseError{Code: wsCloseNoStatus}
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Reason = string(payload[2:])
+			}
+			c.writeFrame(wsOpClose, payload[:min(len(payload), 2)])
+			c.conn.Close()
+			return nil, closeErr
+		case wsOpContinuation:
+			if !started {
+				return nil, c.fail("unexpected continuation frame")
+			}
+			message = append(message, payload...)
+		case wsOpText, wsOpBinary:
+			if started {
+				return nil, c.fail("unfinished fragmented message")
+			}
+			started = true
+			compressed = rsv1
+			message = payload
+		default:
+			return nil, c.fail(fmt.Sprintf("unknown opcode %d", opcode))
+		}
+		if len(message) > wsMaxMessageSize {
+			return nil, c.fail("message too large")
+		}
+		if !fin {
+			continue
+		}
+		if compressed {
+			if message, err = c.inflater.inflate(message); err != nil {
+				return nil, c.fail("inflating message: " + err.Error())
+			}
+		}
+		return message, nil
+	}
+}
+
+// readFrame reads a frame of the server. rsv1 marks the first frame of a
+// compressed message.
+func (c *wsConn) readFrame() (fin, rsv1 bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return false, false, 0, nil, err
+	}
+	c.lastRead.Store(time.Now().UnixNano())
+	fin = header[0]&0x80 != 0
+	rsv1 = header[0]&0x40 != 0
+	opcode = header[0] & 0x0f
+	if header[0]&0x30 != 0 || rsv1 && (c.inflater == nil || (opcode != wsOpText && opcode != wsOpBinary)) {
+		return false, false, 0, nil, c.fail("reserved bits set")
+	}
+	if header[1]&0x80 != 0 {
+		return false, false, 0, nil, c.fail("masked server frame")
+	}
+	n := uint64(header[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxMessageSize {
+		return false, false, 0, nil, c.fail("frame too large")
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, false, 0, nil, err
+	}
+	return fin, rsv1, opcode, payload, nil
+}
+
+// writeText sends p as a text message.
+func (c *wsConn) writeText(p []byte) error {
+	return c.writeFrame(wsOpText, p)
+}
+
+// writeFrame sends payload in a single masked frame.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|opcode)
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// close sends a close frame with code and reason and closes the
+// connection.
+func (c *wsConn) close(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	c.writeFrame(wsOpClose, append(payload, reason...))
+	return c.conn.Close()
+}
+
+// fail closes the connection after a protocol error and returns it.
+func (c *wsConn) fail(reason string) error {
+	c.close(wsCloseProtocolError, reason)
+	return errors.New("graphql: websocket: " + reason)
+}
@@ -0,0 +1,312 @@
+package graphql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wsFrame is a frame as read by the server side of a test.
+type wsFrame struct {
+	fin     bool
+	opcode  byte
+	masked  bool
+	length  byte // the 7-bit length field of the header
+	payload []byte
+}
+
+// wsPeer is the server side of a WebSocket in tests.
+type wsPeer struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newWSPeer(conn net.Conn, r *bufio.Reader) *wsPeer {
+	if r == nil {
+		r = bufio.NewReader(conn)
+	}
+	return &wsPeer{conn: conn, r: r}
+}
+
+// writeFrame writes an unmasked frame.
+func (p *wsPeer) writeFrame(fin bool, opcode byte, payload []byte) error {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	_, err := p.conn.Write(append(frame, payload...))
+	return err
+}
+
+// readFrame reads a frame of the client, unmasking its payload.
+func (p *wsPeer) readFrame() (wsFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(p.r, header[:]); err != nil {
+		return wsFrame{}, err
+	}
+	f := wsFrame{fin: header[0]&0x80 != 0, opcode: header[0] & 0x0f, masked: header[1]&0x80 != 0, length: header[1] & 0x7f}
+	n := uint64(f.length)
+	switch f.length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(p.r, ext[:]); err != nil {
+			return f, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(p.r, ext[:]); err != nil {
+			return f, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	var mask [4]byte
+	if f.masked {
+		if _, err := io.ReadFull(p.r, mask[:]); err != nil {
+			return f, err
+		}
+	}
+	f.payload = make([]byte, n)
+	if _, err := io.ReadFull(p.r, f.payload); err != nil {
+		return f, err
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+	return f, nil
+}
+
+// readText reads the next text message of the client, answering nothing.
+func (p *wsPeer) readText() (string, error) {
+	f, err := p.readFrame()
+	if err != nil {
+		return "", err
+	}
+	if f.opcode != wsOpText {
+		return "", fmt.Errorf("got opcode %d, want a text frame", f.opcode)
+	}
+	return string(f.payload), nil
+}
+
+// wsPipe returns a client wsConn connected to a server peer in memory.
+func wsPipe() (*wsConn, *wsPeer) {
+	client, server := net.Pipe()
+	return &wsConn{conn: client, r: bufio.NewReader(client)}, newWSPeer(server, nil)
+}
+
+// newWSServer starts a server upgrading its requests to WebSockets,
+// choosing the first offered protocol in protocols, and handing them to
+// handle.
+func newWSServer(t *testing.T, protocols []string, handle func(p *wsPeer, protocol string)) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var protocol string
+		for _, offered := range strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",") {
+			for _, p := range protocols {
+				if strings.TrimSpace(offered) == p && protocol == "" {
+					protocol = p
+				}
+			}
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n", wsAccept(r.Header.Get("Sec-WebSocket-Key")))
+		if protocol != "" {
+			fmt.Fprintf(rw, "Sec-WebSocket-Protocol: %s\r\n", protocol)
+		}
+		rw.WriteString("\r\n")
+		rw.Flush()
+		handle(newWSPeer(conn, rw.Reader), protocol)
+	}))
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	srv := newWSServer(t, []string{"b"}, func(p *wsPeer, protocol string) {
+		p.writeFrame(true, wsOpText, []byte("hello"))
+		p.readFrame()
+	})
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	ws, err := dialWebSocket(context.Background(), client.webSocketTransport, srv.URL, nil, []string{"a", "b"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.close(wsCloseNormal, "")
+	if ws.protocol != "b" {
+		t.Errorf("got protocol %q, want b", ws.protocol)
+	}
+	message, err := ws.readMessage()
+	if err != nil || string(message) != "hello" {
+		t.Fatalf("got %q, %v", message, err)
+	}
+}
+
+func TestWebSocketHandshakeRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Upgrade", "websocket")
+		w.Header().Set("Connection", "Upgrade")
+		w.Header().Set("Sec-WebSocket-Accept", "wrong")
+		w.WriteHeader(http.StatusSwitchingProtocols)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	if _, err := dialWebSocket(context.Background(), client.webSocketTransport, srv.URL, nil, nil, false); err == nil {
+		t.Fatal("expected an error for a wrong accept header")
+	}
+	if _, err := dialWebSocket(context.Background(), client.webSocketTransport, "ftp://example.com", nil, nil, false); err == nil {
+		t.Fatal("expected an error for an unsupported scheme")
+	}
+}
+
+func TestWebSocketWriteFrameMasksAndEncodesLengths(t *testing.T) {
+	for _, tt := range []struct {
+		size   int
+		length byte
+	}{
+		{0, 0},
+		{125, 125},
+		{126, 126},
+		{0xffff, 126},
+		{65536, 127},
+	} {
+		ws, peer := wsPipe()
+		payload := bytes.Repeat([]byte{'a'}, tt.size)
+		errc := make(chan error, 1)
+		go func() { errc <- ws.writeText(payload) }()
+		f, err := peer.readFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+		if !f.fin || f.opcode != wsOpText || !f.masked {
+			t.Errorf("%d bytes: got fin %v, opcode %d, masked %v", tt.size, f.fin, f.opcode, f.masked)
+		}
+		if f.length != tt.length {
+			t.Errorf("%d bytes: got length field %d, want %d", tt.size, f.length, tt.length)
+		}
+		if !bytes.Equal(f.payload, payload) {
+			t.Errorf("%d bytes: payload differs after unmasking", tt.size)
+		}
+	}
+}
+
+func TestWebSocketReadFrameLengths(t *testing.T) {
+	for _, size := range []int{0, 125, 126, 65536} {
+		ws, peer := wsPipe()
+		payload := bytes.Repeat([]byte{'b'}, size)
+		go peer.writeFrame(true, wsOpBinary, payload)
+		message, err := ws.readMessage()
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if !bytes.Equal(message, payload) {
+			t.Errorf("%d bytes: got %d bytes", size, len(message))
+		}
+	}
+}
+
+func TestWebSocketFragmentationAndPing(t *testing.T) {
+	ws, peer := wsPipe()
+	pong := make(chan wsFrame, 1)
+	go func() {
+		peer.writeFrame(false, wsOpText, []byte("hel"))
+		peer.writeFrame(true, wsOpPing, []byte("are you there"))
+		f, _ := peer.readFrame()
+		pong <- f
+		peer.writeFrame(false, wsOpContinuation, []byte("lo "))
+		peer.writeFrame(true, wsOpPong, nil)
+		peer.writeFrame(true, wsOpContinuation, []byte("world"))
+	}()
+	message, err := ws.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(message) != "hello world" {
+		t.Errorf("got %q", message)
+	}
+	f := <-pong
+	if f.opcode != wsOpPong || string(f.payload) != "are you there" {
+		t.Errorf("got opcode %d with %q, want a pong echoing the ping", f.opcode, f.payload)
+	}
+}
+
+func TestWebSocketClose(t *testing.T) {
+	for _, tt := range []struct {
+		payload []byte
+		want    CloseError
+	}{
+		{append(binary.BigEndian.AppendUint16(nil, 4403), "forbidden"...), CloseError{Code: 4403, Reason: "forbidden"}},
+		{nil, CloseError{Code: wsCloseNoStatus}},
+	} {
+		ws, peer := wsPipe()
+		echo := make(chan wsFrame, 1)
+		go func() {
+			peer.writeFrame(true, wsOpClose, tt.payload)
+			f, _ := peer.readFrame()
+			echo <- f
+		}()
+		_, err := ws.readMessage()
+		var closeErr *CloseError
+		if !errors.As(err, &closeErr) || *closeErr != tt.want {
+			t.Errorf("got %v, want %v", err, &tt.want)
+		}
+		f := <-echo
+		if f.opcode != wsOpClose || !bytes.Equal(f.payload, tt.payload[:min(len(tt.payload), 2)]) {
+			t.Errorf("got opcode %d with %q, want the close code echoed", f.opcode, f.payload)
+		}
+	}
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	for name, frame := range map[string][]byte{
+		"masked":       {0x81, 0x81, 1, 2, 3, 4, 'x'},
+		"continuation": {0x80, 0x01, 'x'},
+		"reserved":     {0xa1, 0x01, 'x'},
+		"opcode":       {0x83, 0x01, 'x'},
+	} {
+		ws, peer := wsPipe()
+		closed := make(chan wsFrame, 1)
+		go func() {
+			peer.conn.Write(frame)
+			f, _ := peer.readFrame()
+			closed <- f
+		}()
+		if _, err := ws.readMessage(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		f := <-closed
+		if f.opcode != wsOpClose || len(f.payload) < 2 || binary.BigEndian.Uint16(f.payload) != wsCloseProtocolError {
+			t.Errorf("%s: got opcode %d with %q, want a close with code 1002", name, f.opcode, f.payload)
+		}
+	}
+}
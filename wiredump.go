@@ -0,0 +1,118 @@
+package graphql
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithWireDump writes the requests sent by the client and the responses
+// received to w as they go, to debug encoding issues such as multipart
+// boundaries or charsets. Bodies are written as the chunks read from
+// them, byte for byte, after compression; each chunk is preceded by a
+// line with the time, the direction (> sent, < received), the number of
+// the attempt and the size of the chunk. Values of credential headers
+// such as Authorization are redacted. Headers are written as handed to
+// the HTTP transport, without those it adds itself like Content-Length.
+func WithWireDump(w io.Writer) ClientOption {
+	return func(client *Client) {
+		client.wireDump = &wireDump{w: w}
+	}
+}
+
+// wireDump serializes the writes of concurrent attempts to w.
+type wireDump struct {
+	mu       sync.Mutex
+	w        io.Writer
+	attempts atomic.Uint64
+}
+
+// head writes the start line and headers of a message of attempt id.
+func (d *wireDump) head(id uint64, dir byte, line string, h http.Header) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w := bufio.NewWriter(d.w)
+	fmt.Fprintf(w, "%s %c #%d %s\n", time.Now().Format(time.RFC3339Nano), dir, id, line)
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range h[name] {
+			if redactedHeaders[http.CanonicalHeaderKey(name)] {
+				value = "REDACTED"
+			}
+			fmt.Fprintf(w, "%s: %s\n", name, value)
+		}
+	}
+	w.WriteString("\n")
+	w.Flush()
+}
+
+// chunk writes a chunk of the body of a message of attempt id.
+func (d *wireDump) chunk(id uint64, dir byte, p []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w := bufio.NewWriter(d.w)
+	fmt.Fprintf(w, "%s %c #%d %d bytes\n", time.Now().Format(time.RFC3339Nano), dir, id, len(p))
+	w.Write(p)
+	w.WriteString("\n")
+	w.Flush()
+}
+
+// line writes an event of attempt id, such as the end of a body.
+func (d *wireDump) line(id uint64, dir byte, event string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fmt.Fprintf(d.w, "%s %c #%d %s\n", time.Now().Format(time.RFC3339Nano), dir, id, event)
+}
+
+// wireDumpTransport dumps the attempts it sends.
+type wireDumpTransport struct {
+	transport http.RoundTripper
+	dump      *wireDump
+}
+
+func (t *wireDumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := t.dump.attempts.Add(1)
+	t.dump.head(id, '>', req.Method+" "+req.URL.String()+" "+req.Proto, req.Header)
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &wireDumpBody{ReadCloser: req.Body, dump: t.dump, id: id, dir: '>'}
+	}
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		t.dump.line(id, '<', "error: "+err.Error())
+		return nil, err
+	}
+	t.dump.head(id, '<', resp.Proto+" "+resp.Status, resp.Header)
+	resp.Body = &wireDumpBody{ReadCloser: resp.Body, dump: t.dump, id: id, dir: '<'}
+	return resp, nil
+}
+
+// wireDumpBody dumps the chunks read from a body.
+type wireDumpBody struct {
+	io.ReadCloser
+	dump *wireDump
+	id   uint64
+	dir  byte
+	eof  bool
+}
+
+func (b *wireDumpBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.dump.chunk(b.id, b.dir, p[:n])
+	}
+	if err == io.EOF && !b.eof {
+		b.eof = true
+		b.dump.line(b.id, b.dir, "end of body")
+	}
+	return n, err
+}
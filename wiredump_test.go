@@ -0,0 +1,55 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWireDump(t *testing.T) {
+	srv, _ := cachedServer(func(int32) string { return `{"data":{"a":1}}` })
+	defer srv.Close()
+	var dump lockedBuffer
+	client := NewClient(srv.URL, WithWireDump(&dump))
+	req := NewRequest("{ a }")
+	req.Header.Set("Authorization", "Bearer token")
+	if err := client.Run(context.Background(), req, nil); err != nil {
+		t.Fatal(err)
+	}
+	got := dump.String()
+	for _, want := range []string{
+		" > #1 POST " + srv.URL + " HTTP/1.1\n",
+		"\nAuthorization: REDACTED\n",
+		" > #1 35 bytes\n{\"query\":\"{ a }\",\"variables\":null}\n\n",
+		" < #1 HTTP/1.1 200 OK\n",
+		" < #1 16 bytes\n{\"data\":{\"a\":1}}\n",
+		" < #1 end of body\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got dump\n%s\nwithout %q", got, want)
+		}
+	}
+	if strings.Contains(got, "token") {
+		t.Error("got the credentials dumped")
+	}
+}
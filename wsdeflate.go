@@ -0,0 +1,81 @@
+package graphql
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"strings"
+)
+
+// permessageDeflate is the WebSocket extension compressing messages
+// (RFC 7692).
+const permessageDeflate = "permessage-deflate"
+
+// deflateOffer is the extension offered by the client. The client sends
+// its messages, which are small, uncompressed, so it keeps no context.
+const deflateOffer = permessageDeflate + "; client_no_context_takeover"
+
+// deflateWindow is the size of the LZ77 window of the server, the most
+// permessage-deflate allows.
+const deflateWindow = 32 << 10
+
+// deflateTail ends the payload of a compressed message: the tail removed
+// by the server, then an empty final block so the reader sees the end of
+// the stream.
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+// errMessageTooLarge is returned for a message that inflates beyond
+// wsMaxMessageSize.
+var errMessageTooLarge = errors.New("message too large")
+
+// WithSubscriptionCompression offers the permessage-deflate extension in
+// the WebSocket handshakes of subscriptions, so that servers supporting it
+// compress their messages, cutting the bandwidth of chatty subscriptions
+// with large payloads. Servers not supporting it send them as usual.
+func WithSubscriptionCompression() ClientOption {
+	return func(client *Client) {
+		client.subscriptionCompression = true
+	}
+}
+
+// acceptsDeflate reports whether the Sec-WebSocket-Extensions header of
+// a handshake response enables permessage-deflate.
+func acceptsDeflate(header string) bool {
+	for _, ext := range strings.Split(header, ",") {
+		name, _, _ := strings.Cut(ext, ";")
+		if strings.TrimSpace(name) == permessageDeflate {
+			return true
+		}
+	}
+	return false
+}
+
+// inflater decompresses the messages of a server, keeping the window they
+// may refer to across messages.
+type inflater struct {
+	r      io.ReadCloser
+	window []byte
+}
+
+// inflate returns the decompressed payload of a compressed message.
+func (f *inflater) inflate(payload []byte) ([]byte, error) {
+	src := io.MultiReader(bytes.NewReader(payload), bytes.NewReader(deflateTail))
+	if f.r == nil {
+		f.r = flate.NewReaderDict(src, f.window)
+	} else if err := f.r.(flate.Resetter).Reset(src, f.window); err != nil {
+		return nil, err
+	}
+	message, err := io.ReadAll(io.LimitReader(f.r, wsMaxMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(message) > wsMaxMessageSize {
+		return nil, errMessageTooLarge
+	}
+	f.window = append(f.window, message...)
+	if n := len(f.window); n > deflateWindow {
+		f.window = append(f.window[:0], f.window[n-deflateWindow:]...)
+	}
+	return message, nil
+}
@@ -0,0 +1,83 @@
+package graphql
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// deflateMessages compresses messages as a server keeping its context
+// does, each ending with a sync flush whose tail is removed.
+func deflateMessages(t *testing.T, messages ...string) [][]byte {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payloads [][]byte
+	for _, msg := range messages {
+		buf.Reset()
+		w.Write([]byte(msg))
+		w.Flush()
+		payloads = append(payloads, bytes.Clone(bytes.TrimSuffix(buf.Bytes(), []byte{0x00, 0x00, 0xff, 0xff})))
+	}
+	return payloads
+}
+
+func TestInflater(t *testing.T) {
+	msg := `{"type":"next","id":"1","payload":{"data":{"tick":1}}}`
+	payloads := deflateMessages(t, msg, msg)
+	if len(payloads[1]) >= len(payloads[0]) {
+		t.Fatalf("second message of %d bytes doesn't refer to the first of %d", len(payloads[1]), len(payloads[0]))
+	}
+	var f inflater
+	for i, payload := range payloads {
+		got, err := f.inflate(payload)
+		if err != nil || string(got) != msg {
+			t.Errorf("message %d: got %q, %v", i, got, err)
+		}
+	}
+}
+
+func TestInflaterTooLarge(t *testing.T) {
+	payloads := deflateMessages(t, strings.Repeat("a", wsMaxMessageSize+1))
+	var f inflater
+	if _, err := f.inflate(payloads[0]); err != errMessageTooLarge {
+		t.Errorf("got %v, want errMessageTooLarge", err)
+	}
+}
+
+func TestAcceptsDeflate(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                   false,
+		"permessage-deflate": true,
+		"x-other, permessage-deflate; server_no_context_takeover": true,
+		"permessage-deflated": false,
+	} {
+		if got := acceptsDeflate(header); got != want {
+			t.Errorf("%q: got %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestSubscriptionCompressionOffer(t *testing.T) {
+	offers := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offers <- r.Header.Get("Sec-WebSocket-Extensions")
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	for _, opts := range [][]ClientOption{nil, {WithSubscriptionCompression()}} {
+		client := NewClient(srv.URL, opts...)
+		if _, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }")); err == nil {
+			t.Fatal("expected the handshake to fail")
+		}
+	}
+	if without, with := <-offers, <-offers; without != "" || with != deflateOffer {
+		t.Errorf("got offers %q and %q, want none then %q", without, with, deflateOffer)
+	}
+}
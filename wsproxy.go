@@ -0,0 +1,142 @@
+package graphql
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// WithSubscriptionDialContext makes WebSocket subscriptions open their
+// connections with dial instead of the dialer of the default HTTP client.
+// With a proxy, dial connects to the proxy.
+func WithSubscriptionDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) ClientOption {
+	return func(client *Client) {
+		client.subscriptionDial = dial
+	}
+}
+
+// WithSubscriptionProxyURL sends WebSocket subscriptions through the
+// proxy at u instead of the proxy of the default HTTP client, if any.
+// HTTP proxies are asked to tunnel with CONNECT, also for ws endpoints
+// whose upgrade most proxies wouldn't forward otherwise.
+func WithSubscriptionProxyURL(u *url.URL) ClientOption {
+	return func(client *Client) {
+		client.subscriptionProxy = http.ProxyURL(u)
+	}
+}
+
+// tunnelPlainWebSocket makes t reach u, an http URL, through a CONNECT
+// tunnel when its proxy is an HTTP one, since http.Transport would send
+// the handshake to the proxy as a plain request otherwise.
+func tunnelPlainWebSocket(t *http.Transport, u *url.URL) {
+	if t.Proxy == nil || u.Scheme != "http" {
+		return
+	}
+	if _, ok := unixSocket(canonicalAddr(u)); ok {
+		return
+	}
+	proxy, err := t.Proxy(&http.Request{URL: u, Header: make(http.Header)})
+	if err != nil || proxy == nil {
+		// The transport reports the error, if any.
+		return
+	}
+	if proxy.Scheme != "http" && proxy.Scheme != "https" {
+		return
+	}
+	dial := dialFunc(t.DialContext)
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	t.Proxy = nil
+	t.DialContext = connectDial(dial, proxy, t.TLSClientConfig)
+}
+
+// connectDial returns a dial function opening connections through a
+// tunnel the HTTP proxy at proxy establishes with CONNECT. An https proxy
+// is connected to with config.
+func connectDial(dial dialFunc, proxy *url.URL, config *tls.Config) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, canonicalAddr(proxy))
+		if err != nil {
+			return nil, fmt.Errorf("dial proxy: %w", err)
+		}
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+		defer stop()
+		if proxy.Scheme == "https" {
+			config := config.Clone()
+			if config == nil {
+				config = &tls.Config{}
+			}
+			config.ServerName = proxy.Hostname()
+			config.NextProtos = nil
+			tlsConn := tls.Client(conn, config)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("proxy tls handshake: %w", err)
+			}
+			conn = tlsConn
+		}
+		req := &http.Request{
+			Method: http.MethodConnect,
+			URL:    &url.URL{Opaque: addr},
+			Host:   addr,
+			Header: make(http.Header),
+		}
+		if user := proxy.User; user != nil {
+			password, _ := user.Password()
+			credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+			req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+		}
+		if err := req.Write(conn); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy connect: %w", err)
+		}
+		r := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(r, req)
+		if err != nil {
+			conn.Close()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("proxy connect: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			conn.Close()
+			return nil, fmt.Errorf("proxy connect: %w", &StatusError{StatusCode: resp.StatusCode})
+		}
+		if r.Buffered() > 0 {
+			return &bufferedConn{Conn: conn, r: r}, nil
+		}
+		return conn, nil
+	}
+}
+
+// bufferedConn is a connection whose first bytes were read in r.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// canonicalAddr returns the host:port of u, with the default port of its
+// scheme if it has none.
+func canonicalAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
@@ -0,0 +1,126 @@
+package graphql
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// connectProxy starts an HTTP proxy tunneling with CONNECT, which answers
+// status other than 200 without connecting, and records the CONNECT
+// requests it receives.
+func connectProxy(t *testing.T, status int) (*url.URL, *[]*http.Request) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	var requests []*http.Request
+	handle := func(conn net.Conn) {
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		if req.Method != http.MethodConnect || status != http.StatusOK {
+			(&http.Response{StatusCode: status, ProtoMajor: 1, ProtoMinor: 1}).Write(conn)
+			return
+		}
+		target, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			return
+		}
+		defer target.Close()
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go io.Copy(target, r)
+		io.Copy(conn, target)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return &url.URL{Scheme: "http", User: url.UserPassword("user", "secret"), Host: ln.Addr().String()}, &requests
+}
+
+// completingWSServer completes the first subscription of each connection.
+func completingWSServer(t *testing.T) *httptest.Server {
+	return newWSServer(t, []string{ProtocolGraphQLTransportWS}, func(p *wsPeer, protocol string) {
+		readWSMessage(t, p)
+		writeWSMessage(t, p, `{"type":"connection_ack"}`)
+		sub := readWSMessage(t, p)
+		writeWSMessage(t, p, `{"id":"`+sub.ID+`","type":"complete"}`)
+		p.readFrame()
+	})
+}
+
+func TestSubscriptionProxyURL(t *testing.T) {
+	srv := completingWSServer(t)
+	defer srv.Close()
+	proxy, requests := connectProxy(t, http.StatusOK)
+	client := NewClient(srv.URL, WithSubscriptionProxyURL(proxy))
+	messages, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := collect(t, messages); len(got) != 1 || got[0].End != SubscriptionCompleted {
+		t.Fatalf("got %+v, want a completion through the proxy", got)
+	}
+	target, _ := url.Parse(srv.URL)
+	if len(*requests) != 1 {
+		t.Fatalf("got %d requests to the proxy, want 1", len(*requests))
+	}
+	req := (*requests)[0]
+	if req.Method != http.MethodConnect || req.Host != target.Host {
+		t.Errorf("got %s %s, want CONNECT %s", req.Method, req.Host, target.Host)
+	}
+	if got := req.Header.Get("Proxy-Authorization"); got != "Basic dXNlcjpzZWNyZXQ=" {
+		t.Errorf("got Proxy-Authorization %q", got)
+	}
+}
+
+func TestSubscriptionProxyRejected(t *testing.T) {
+	proxy, _ := connectProxy(t, http.StatusProxyAuthRequired)
+	client := NewClient("ws://graphql.example/query", WithSubscriptionProxyURL(proxy))
+	_, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }"))
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusProxyAuthRequired {
+		t.Fatalf("got %v, want the status of the proxy", err)
+	}
+}
+
+func TestSubscriptionDialContext(t *testing.T) {
+	srv := completingWSServer(t)
+	defer srv.Close()
+	var dialed []string
+	client := NewClient(srv.URL, WithSubscriptionDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}))
+	messages, err := client.Subscribe(context.Background(), NewRequest("subscription { tick }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collect(t, messages)
+	target, _ := url.Parse(srv.URL)
+	if len(dialed) != 1 || dialed[0] != target.Host {
+		t.Errorf("dialed %q, want %s", dialed, target.Host)
+	}
+}